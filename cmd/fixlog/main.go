@@ -0,0 +1,239 @@
+// Command fixlog decodes the session files written by the FIX DebugLog.
+//
+//	fixlog [flags] [file ...]
+//
+// Files may be rotated .gz files; with no files, or "-", it reads stdin.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"bcb-fix-microservice/pkg/fixlog"
+)
+
+type filters struct {
+	msgTypes map[string]bool
+	symbol   string
+	clOrdID  string
+	session  string
+	events   bool
+}
+
+/* entry is the JSON shape of one record */
+type entry struct {
+	File      string          `json:"file"`
+	Line      int             `json:"line"`
+	Session   string          `json:"session"`
+	Time      *time.Time      `json:"time,omitempty"`
+	Direction string          `json:"direction"`
+	Text      string          `json:"text,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Message   *fixlog.Message `json:"message,omitempty"`
+}
+
+func main() {
+	format := flag.String("format", "table", "output format: table or json (one object per line)")
+	msgTypes := flag.String("type", "", "comma separated MsgTypes or message names, e.g. 8,NewOrderSingle")
+	symbol := flag.String("symbol", "", "only messages with this Symbol(55), including inside groups")
+	clOrdID := flag.String("clordid", "", "only messages with this ClOrdID(11) or OrigClOrdID(41)")
+	session := flag.String("session", "", "only sessions whose name contains this text")
+	events := flag.Bool("events", false, "include session EVENT and ERROR lines")
+	specPath := flag.String("spec", "", "FIX 4.4 dictionary XML, defaults to the embedded copy")
+	flag.Parse()
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "fixlog: invalid -format %q, must be table or json\n", *format)
+		os.Exit(2)
+	}
+
+	dict, err := fixlog.LoadDictionary(*specPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fixlog: %v\n", err)
+		os.Exit(1)
+	}
+
+	f := filters{symbol: *symbol, clOrdID: *clOrdID, session: *session, events: *events}
+	if *msgTypes != "" {
+		f.msgTypes = make(map[string]bool)
+		for _, name := range strings.Split(*msgTypes, ",") {
+			name = strings.TrimSpace(name)
+			if msgType, ok := dict.MsgTypeByName(name); ok {
+				name = msgType
+			}
+			f.msgTypes[name] = true
+		}
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	out := &printer{format: *format, w: os.Stdout}
+	failed := false
+	for _, path := range paths {
+		if err := decodeFile(path, dict, f, out); err != nil {
+			fmt.Fprintf(os.Stderr, "fixlog: %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func decodeFile(path string, dict *fixlog.Dictionary, f filters, out *printer) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := fixlog.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	reader := fixlog.NewReader(r)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if f.session != "" && !strings.Contains(record.Session, f.session) {
+			continue
+		}
+
+		e := entry{File: path, Line: record.Line, Session: record.Session, Direction: direction(record.Kind)}
+		if !record.Time.IsZero() {
+			e.Time = &record.Time
+		}
+
+		if !record.IsMessage() {
+			if f.events && !f.filtering() {
+				e.Text = record.Text
+				out.print(e)
+			}
+			continue
+		}
+
+		message, err := dict.Decode(record.Text)
+		if err != nil {
+			/* keep undecodable lines visible unless the user narrowed the output */
+			if !f.filtering() {
+				e.Text = record.Text
+				e.Error = err.Error()
+				out.print(e)
+			}
+			continue
+		}
+
+		if !f.match(message) {
+			continue
+		}
+		e.Message = message
+		out.print(e)
+	}
+}
+
+func (f filters) filtering() bool {
+	return f.msgTypes != nil || f.symbol != "" || f.clOrdID != ""
+}
+
+func (f filters) match(message *fixlog.Message) bool {
+	if f.msgTypes != nil && !f.msgTypes[message.MsgType] {
+		return false
+	}
+	if f.symbol != "" && !contains(message.Values(55), f.symbol) {
+		return false
+	}
+	if f.clOrdID != "" && !contains(message.Values(11), f.clOrdID) && !contains(message.Values(41), f.clOrdID) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func direction(kind string) string {
+	switch kind {
+	case fixlog.KindIncoming:
+		return "in"
+	case fixlog.KindOutgoing:
+		return "out"
+	case fixlog.KindError:
+		return "error"
+	default:
+		return "event"
+	}
+}
+
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+func (p *printer) print(e entry) {
+	if p.format == "json" {
+		data, _ := json.Marshal(e)
+		fmt.Fprintln(p.w, string(data))
+		return
+	}
+
+	stamp := "-"
+	if e.Time != nil {
+		stamp = e.Time.Format("2006-01-02 15:04:05.000000")
+	}
+
+	switch {
+	case e.Message != nil:
+		name := e.Message.Name
+		if name == "" {
+			name = "Unknown"
+		}
+		fmt.Fprintf(p.w, "%s  %s  %-3s  %s (%s)  [%s:%d]\n", stamp, e.Session, strings.ToUpper(e.Direction), name, e.Message.MsgType, e.File, e.Line)
+
+		tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+		writeFields(tw, e.Message.Fields, 1)
+		tw.Flush()
+		fmt.Fprintln(p.w)
+	case e.Error != "":
+		fmt.Fprintf(p.w, "%s  %s  %-3s  undecodable: %s  [%s:%d]\n    %s\n\n", stamp, e.Session, strings.ToUpper(e.Direction), e.Error, e.File, e.Line, e.Text)
+	default:
+		fmt.Fprintf(p.w, "%s  %s  %-5s  %s\n", stamp, e.Session, strings.ToUpper(e.Direction), e.Text)
+	}
+}
+
+func writeFields(w io.Writer, fields []fixlog.Field, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, field := range fields {
+		name := field.Name
+		if name == "" {
+			name = "?"
+		}
+		fmt.Fprintf(w, "%s%s\t%s%s\t%s\t%s\n", indent, strconv.Itoa(field.Tag), indent, name, field.Value, field.Enum)
+
+		for n, group := range field.Groups {
+			fmt.Fprintf(w, "%s  #%d\t\t\t\n", indent, n+1)
+			writeFields(w, group, depth+1)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Command replay feeds recorded DebugLog session files back into the order
+// entry and market data clients and dumps the resulting order, execution and
+// quote state.
+//
+//	replay [flags] file ...
+//
+// With -golden the dump is compared against the file instead of printed and
+// the command exits 1 when they differ; add -update to rewrite the file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"bcb-fix-microservice/pkg/fixlog"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/replay"
+)
+
+func main() {
+	speed := flag.Float64("speed", 0, "timing: 0 replays as fast as possible, 1 keeps the recorded gaps, N replays N times faster")
+	golden := flag.String("golden", "", "compare the state dump with this file")
+	update := flag.Bool("update", false, "rewrite the -golden file with the state dump")
+	out := flag.String("out", "", "write the state dump to this file instead of stdout")
+	specPath := flag.String("spec", "", "FIX 4.4 dictionary XML, defaults to the embedded copy")
+	logLevel := flag.String("log-level", "warn", "client log level: debug, info, warn or error")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: replay [flags] file ...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if *update && *golden == "" {
+		fmt.Fprintln(os.Stderr, "replay: -update requires -golden")
+		os.Exit(2)
+	}
+
+	/* client logs go to stderr so that the dump on stdout stays clean */
+	if err := logging.Setup(os.Stderr, *logLevel, "text"); err != nil {
+		fail(err)
+	}
+
+	dict, err := fixlog.LoadDictionary(*specPath)
+	if err != nil {
+		fail(err)
+	}
+
+	records, err := replay.ReadFiles(flag.Args())
+	if err != nil {
+		fail(err)
+	}
+
+	harness, err := replay.New(replay.Options{Speed: *speed, Dictionary: dict})
+	if err != nil {
+		fail(err)
+	}
+
+	harness.Run(records)
+	dump, err := harness.State().Marshal()
+	harness.Close()
+	if err != nil {
+		fail(err)
+	}
+
+	switch {
+	case *update:
+		if err := os.WriteFile(*golden, dump, 0644); err != nil {
+			fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "replay: updated %s\n", *golden)
+
+	case *golden != "":
+		want, err := os.ReadFile(*golden)
+		if errors.Is(err, fs.ErrNotExist) {
+			fail(fmt.Errorf("%s does not exist, run with -update to create it", *golden))
+		}
+		if err != nil {
+			fail(err)
+		}
+
+		if diff := replay.Diff(want, dump); diff != "" {
+			fmt.Fprintf(os.Stderr, "replay: state differs from %s\n%s", *golden, diff)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "replay: state matches %s\n", *golden)
+
+	case *out != "":
+		if err := os.WriteFile(*out, dump, 0644); err != nil {
+			fail(err)
+		}
+
+	default:
+		os.Stdout.Write(dump)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+	os.Exit(1)
+}
@@ -1,65 +1,207 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"bcb-fix-microservice/pkg/algos"
 	"bcb-fix-microservice/pkg/api"
+	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/groups"
+	"bcb-fix-microservice/pkg/iceberg"
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/journal"
+	"bcb-fix-microservice/pkg/logging"
 	"bcb-fix-microservice/pkg/marketdata"
+	"bcb-fix-microservice/pkg/metrics"
 	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/ratelimit"
+	"bcb-fix-microservice/pkg/risk"
+	"bcb-fix-microservice/pkg/store"
+	"bcb-fix-microservice/pkg/tracing"
+	"bcb-fix-microservice/pkg/triggers"
+	"bcb-fix-microservice/pkg/webhooks"
 )
 
+var logger = logging.Component("main")
+
 func main() {
-	log.Println("[EVENT (MicroserviceStarting)]: BCB Markets FIX Microservice")
+	if err := logging.Setup(os.Stdout, getEnvString("LOG_LEVEL", "info"), getEnvString("LOG_FORMAT", "text")); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Info("MicroserviceStarting", "service", "BCB Markets FIX Microservice")
 
 	port := getEnvInt("PORT", 8085)
 	mdConfigPath := getEnvString("MD_CONFIG_PATH", "config/market_data.cfg")
 	oeConfigPath := getEnvString("OE_CONFIG_PATH", "config/order_entry.cfg")
+	storePath := getEnvString("STORE_PATH", "data/bcb.db")
+
+	shutdownTracing, err := tracing.Setup(tracing.Config{
+		Exporter:    getEnvString("TRACING_EXPORTER", tracing.ExporterNone),
+		FilePath:    getEnvString("TRACING_FILE", "log/traces.jsonl"),
+		SampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+	})
+	if err != nil {
+		fatal("TracingSetupFailed", err)
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+
+	st, err := store.Open(storePath)
+	if err != nil {
+		fatal("StoreOpenFailed", err)
+	}
 
-	mdClient := marketdata.NewMarketDataClient()
-	ordersClient := orders.NewOrdersClient()
+	defer st.Close()
 
-	log.Println("[EVENT (MarketDataClientStarting)]")
+	ids, err := idgen.New(getEnvString("INSTANCE_ID", idgen.DefaultInstanceID()), st)
+	if err != nil {
+		fatal("IDGeneratorFailed", err)
+	}
+
+	keyStore, err := auth.NewKeyStore(getEnvString("API_KEYS_PATH", "config/api_keys.json"), st)
+	if err != nil {
+		fatal("APIKeysLoadFailed", err)
+	}
+
+	mdClient := marketdata.NewMarketDataClient(ids)
+	ordersClient := orders.NewOrdersClient(st, ids)
+
+	metrics.RegisterQuoteAges(mdClient.QuoteTimes)
+
+	mdClient.SetThrottle(getThrottleConfig("FIX_THROTTLE_MD"))
+	ordersClient.SetThrottle(getThrottleConfig("FIX_THROTTLE_ORDERS"))
+
+	fixLogConfig := getFIXLogConfig()
+	mdClient.SetFIXLog(fixLogConfig)
+	ordersClient.SetFIXLog(fixLogConfig)
+
+	journalConfig := journal.DefaultConfig()
+	journalConfig.RedactTags = fixLogConfig.RedactTags
+	/* set but empty journals every MsgType */
+	if _, set := os.LookupEnv("JOURNAL_EXCLUDE_MSGTYPES"); set {
+		journalConfig.Exclude = getEnvList("JOURNAL_EXCLUDE_MSGTYPES")
+	}
+
+	messageJournal, err := journal.Open(getEnvString("JOURNAL_PATH", "data/journal.db"), journalConfig)
+	if err != nil {
+		fatal("JournalOpenFailed", err)
+	}
+
+	/* deferred before the clients so that it closes after their sessions stop */
+	defer messageJournal.Close()
+
+	mdClient.SetJournal(messageJournal)
+	ordersClient.SetJournal(messageJournal)
+
+	/* set but empty runs without pre-trade limits; a missing file is fatal */
+	riskConfigPath := "config/risk.json"
+	if value, set := os.LookupEnv("RISK_CONFIG_PATH"); set {
+		riskConfigPath = value
+	}
+
+	riskEngine, err := risk.NewEngine(riskConfigPath, mdClient, ordersClient)
+	if err != nil {
+		fatal("RiskLimitsLoadFailed", err)
+	}
+
+	ordersClient.SetPreTradeCheck(riskEngine.Check)
+
+	/* order listeners are registered before the session starts so that reports arriving on logon reach them */
+	triggerManager := triggers.NewManager(st, ordersClient, mdClient)
+	groupManager := groups.NewManager(st, ordersClient, triggerManager, ids)
+	algoEngine := algos.NewEngine(st, ordersClient, mdClient, ids)
+	icebergManager := iceberg.NewManager(st, ordersClient, ids)
+
+	logger.Info("MarketDataClientStarting")
 
 	if err := mdClient.Start(mdConfigPath); err != nil {
-		log.Fatalf("Failed to start Market Data client: %v", err)
+		fatal("MarketDataClientStartFailed", err)
 	}
 
 	defer mdClient.Stop()
 
 	time.Sleep(3 * time.Second)
 
-	log.Println("[EVENT (OrdersClientStarting)]")
+	logger.Info("OrdersClientStarting")
 
 	if err := ordersClient.Start(oeConfigPath); err != nil {
-		log.Fatalf("Failed to start Orders client: %v", err)
+		fatal("OrdersClientStartFailed", err)
 	}
 
 	defer ordersClient.Stop()
 
 	time.Sleep(3 * time.Second)
 
-	apiServer := api.NewServer(mdClient, ordersClient)
+	triggerManager.Start()
+	defer triggerManager.Stop()
+
+	webhookConfig := webhooks.DefaultConfig()
+	webhookConfig.MaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", webhookConfig.MaxAttempts)
+	webhookConfig.InitialBackoff = time.Duration(getEnvInt("WEBHOOK_INITIAL_BACKOFF_MS", 1000)) * time.Millisecond
+	webhookConfig.QueueSize = getEnvInt("WEBHOOK_QUEUE_SIZE", webhookConfig.QueueSize)
+	dispatcher := webhooks.NewDispatcher(st, webhookConfig)
+	defer dispatcher.Close()
+
+	apiConfig := api.DefaultConfig()
+	apiConfig.IdempotencyWindow = time.Duration(getEnvInt("IDEMPOTENCY_WINDOW_MINUTES", 1440)) * time.Minute
+	apiConfig.ReportingCurrency = getEnvString("REPORTING_CURRENCY", apiConfig.ReportingCurrency)
+	apiConfig.ConversionPairs = getEnvList("CONVERSION_PAIRS")
+	apiConfig.AuthDisabled = getEnvString("AUTH_DISABLED", "") == "true"
+	apiConfig.RateLimits[api.RateClassOrders] = getEnvLimit("RATE_LIMIT_ORDERS", apiConfig.RateLimits[api.RateClassOrders])
+	apiConfig.RateLimits[api.RateClassMarketData] = getEnvLimit("RATE_LIMIT_MARKETDATA", apiConfig.RateLimits[api.RateClassMarketData])
+	apiConfig.RateLimits[api.RateClassQuery] = getEnvLimit("RATE_LIMIT_QUERY", apiConfig.RateLimits[api.RateClassQuery])
+	apiConfig.RateLimits[api.RateClassAdmin] = getEnvLimit("RATE_LIMIT_ADMIN", apiConfig.RateLimits[api.RateClassAdmin])
+
+	if apiConfig.AuthDisabled {
+		logger.Warn("AuthDisabled", "detail", "every request runs with admin scope")
+	} else if keyStore.Empty() {
+		logger.Warn("NoAPIClients", "detail", "every API request will be rejected")
+	}
+
+	apiServer := api.NewServer(mdClient, ordersClient, st, dispatcher, keyStore, riskEngine, triggerManager, groupManager, algoEngine, icebergManager, ids, messageJournal, apiConfig)
 
 	go func() {
-		log.Printf("[EVENT (HTTPServerStarting)]: Port %d", port)
+		logger.Info("HTTPServerStarting", "port", port)
 
 		if err := apiServer.Start(port); err != nil {
-			log.Fatalf("Failed to start HTTP server: %v", err)
+			fatal("HTTPServerFailed", err)
 		}
 	}()
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-	log.Println("[EVENT (MicroserviceRunning)]: BCB Markets FIX Microservice")
+	logger.Info("MicroserviceRunning")
 
-	<-c
-	log.Println("[EVENT (MicroserviceShuttingDown)]")
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		if err := riskEngine.Reload(); err != nil {
+			logger.Error("RiskLimitsReload", logging.Err(err))
+		}
+	}
+	logger.Info("MicroserviceShuttingDown")
+}
+
+/* deferred cleanups do not run, the same as log.Fatal */
+func fatal(event string, err error) {
+	logger.Error(event, logging.Err(err))
+	os.Exit(1)
 }
 
 func getEnvString(key, defaultValue string) string {
@@ -77,3 +219,86 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+/* limits are written as "rate/burst", e.g. RATE_LIMIT_ORDERS=5/10 */
+func getEnvLimit(key string, defaultValue ratelimit.Limit) ratelimit.Limit {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		fatal("InvalidConfig", fmt.Errorf("%s: %w", key, err))
+	}
+	return limit
+}
+
+func getThrottleConfig(prefix string) ratelimit.ThrottleConfig {
+	config := ratelimit.DefaultThrottleConfig()
+	config.Limit = getEnvLimit(prefix, config.Limit)
+	config.Mode = getEnvString(prefix+"_MODE", config.Mode)
+	config.MaxWait = time.Duration(getEnvInt(prefix+"_MAX_WAIT_MS", int(config.MaxWait/time.Millisecond))) * time.Millisecond
+
+	if config.Mode != ratelimit.ModeQueue && config.Mode != ratelimit.ModeReject {
+		fatal("InvalidConfig", fmt.Errorf("%s_MODE must be %s or %s", prefix, ratelimit.ModeQueue, ratelimit.ModeReject))
+	}
+	return config
+}
+
+func getFIXLogConfig() logging.FIXLogConfig {
+	config := logging.DefaultFIXLogConfig()
+	config.Dir = getEnvString("FIX_LOG_DIR", config.Dir)
+	config.MaxSize = int64(getEnvInt("FIX_LOG_MAX_SIZE_MB", int(config.MaxSize>>20))) << 20
+	config.RotateEvery = time.Duration(getEnvInt("FIX_LOG_ROTATE_HOURS", int(config.RotateEvery/time.Hour))) * time.Hour
+	config.MaxBackups = getEnvInt("FIX_LOG_MAX_BACKUPS", config.MaxBackups)
+	config.MaxAge = time.Duration(getEnvInt("FIX_LOG_MAX_AGE_DAYS", int(config.MaxAge/(24*time.Hour)))) * 24 * time.Hour
+	config.Compress = getEnvString("FIX_LOG_COMPRESS", "true") == "true"
+	config.Stdout = getEnvString("FIX_LOG_STDOUT", config.Stdout)
+	config.RedactTags = getEnvTags("FIX_LOG_REDACT_TAGS")
+
+	switch config.Stdout {
+	case logging.StdoutNone, logging.StdoutEvents, logging.StdoutAll:
+	default:
+		fatal("InvalidConfig", fmt.Errorf("FIX_LOG_STDOUT must be %s, %s or %s", logging.StdoutNone, logging.StdoutEvents, logging.StdoutAll))
+	}
+	return config
+}
+
+/* extra tags masked in FIX logs on top of the built-in credentials, e.g. FIX_LOG_REDACT_TAGS=553,1 */
+func getEnvTags(key string) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var tags []int
+	for _, part := range strings.Split(value, ",") {
+		t, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || t <= 0 {
+			fatal("InvalidConfig", fmt.Errorf("%s: invalid tag %q", key, part))
+		}
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+/* comma separated values, e.g. JOURNAL_EXCLUDE_MSGTYPES=W,Y */
+func getEnvList(key string) []string {
+	var values []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
@@ -0,0 +1,641 @@
+package algos
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/marketdata"
+	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/store"
+)
+
+var logger = logging.Component("algos")
+
+const (
+	StrategyTWAP = "twap"
+	StrategyVWAP = "vwap"
+
+	StatusRunning   = "running"
+	StatusPaused    = "paused"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+
+	algosBucket = "algo_orders"
+
+	quoteTimeout = 2 * time.Second
+
+	/* bounds that keep one request from allocating or scheduling without limit */
+	maxSliceSeconds = 24 * 60 * 60
+	maxWindow       = 7 * 24 * time.Hour
+	maxSlices       = 10000
+
+	/* tolerates the gap between the handler defaulting start_time and Validate */
+	startTimeGrace = 5 * time.Second
+
+	/* a child carries at most this many slices' worth, so a backlog never hits the book at once */
+	maxCatchUpSlices = 2
+)
+
+var (
+	ErrAlgoNotFound = errors.New("algo order not found")
+	ErrAlgoClosed   = errors.New("algo order is no longer active")
+)
+
+type QuoteSource interface {
+	ReferenceQuote(symbol string, timeout time.Duration) (*marketdata.Quote, bool)
+}
+
+// Params describe a parent order. Children are IOC orders: limit at
+// LimitPrice if set, otherwise market. ParticipationRate caps each child at
+// that fraction of the size shown at the touch.
+type Params struct {
+	Strategy          string    `json:"strategy"`
+	Symbol            string    `json:"symbol"`
+	Side              string    `json:"side"`
+	TotalQty          float64   `json:"total_qty"`
+	StartTime         time.Time `json:"start_time"`
+	EndTime           time.Time `json:"end_time"`
+	SliceSeconds      int       `json:"slice_seconds"`
+	LimitPrice        float64   `json:"limit_price,omitempty"`
+	ParticipationRate float64   `json:"participation_rate,omitempty"`
+	MinChildQty       float64   `json:"min_child_qty,omitempty"`
+	VolumeProfile     []float64 `json:"volume_profile,omitempty"`
+	ClientID          string    `json:"client_id,omitempty"`
+}
+
+type Child struct {
+	ClOrdID  string    `json:"cl_ord_id"`
+	Slice    int       `json:"slice"`
+	OrderQty float64   `json:"order_qty"`
+	Status   string    `json:"status"`
+	CumQty   float64   `json:"cum_qty"`
+	AvgPx    float64   `json:"avg_px"`
+	SentAt   time.Time `json:"sent_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type Progress struct {
+	FilledQty     float64 `json:"filled_qty"`
+	WorkingQty    float64 `json:"working_qty"`
+	ScheduledQty  float64 `json:"scheduled_qty"`
+	AvgPx         float64 `json:"avg_px"`
+	PctComplete   float64 `json:"pct_complete"`
+	SlicesDone    int     `json:"slices_done"`
+	SlicesTotal   int     `json:"slices_total"`
+	ChildOrders   int     `json:"child_orders"`
+	SkippedSlices int     `json:"skipped_slices"`
+}
+
+type Algo struct {
+	ID        string    `json:"id"`
+	Params    Params    `json:"params"`
+	Status    string    `json:"status"`
+	Weights   []float64 `json:"weights"`
+	Children  []*Child  `json:"children"`
+	Progress  Progress  `json:"progress"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	wake chan struct{}
+}
+
+// Engine slices parent orders into child NewOrderSingles over a time window
+// and aggregates child executions into parent progress.
+type Engine struct {
+	store    *store.Store
+	orders   *orders.OrdersClient
+	quotes   QuoteSource
+	ids      *idgen.Generator
+	mu       sync.RWMutex
+	algos    map[string]*Algo
+	children map[string]string
+}
+
+func NewEngine(st *store.Store, ordersClient *orders.OrdersClient, quotes QuoteSource, ids *idgen.Generator) *Engine {
+	engine := &Engine{
+		store:    st,
+		orders:   ordersClient,
+		quotes:   quotes,
+		ids:      ids,
+		algos:    make(map[string]*Algo),
+		children: make(map[string]string),
+	}
+
+	loaded, err := store.LoadAll[Algo](st, algosBucket)
+	if err != nil {
+		logger.Error("AlgosStoreLoad", logging.Err(err))
+	}
+	for _, algo := range loaded {
+		/* schedules do not survive a restart unattended: resume explicitly */
+		if algo.Status == StatusRunning {
+			algo.Status = StatusPaused
+			algo.Error = "paused by service restart"
+			engine.save(algo)
+		}
+		engine.algos[algo.ID] = algo
+		for _, child := range algo.Children {
+			engine.children[child.ClOrdID] = algo.ID
+		}
+		if algo.Status == StatusPaused {
+			algo.wake = make(chan struct{}, 1)
+			go engine.run(algo.ID, algo.wake)
+		}
+	}
+
+	ordersClient.AddListener(engine.onOrderEvent)
+	return engine
+}
+
+func (params Params) interval() time.Duration {
+	return time.Duration(params.SliceSeconds) * time.Second
+}
+
+func (params Params) slices() int {
+	return int(math.Ceil(float64(params.EndTime.Sub(params.StartTime)) / float64(params.interval())))
+}
+
+func Validate(params *Params) error {
+	if params.Strategy != StrategyTWAP && params.Strategy != StrategyVWAP {
+		return fmt.Errorf("strategy must be '%s' or '%s'", StrategyTWAP, StrategyVWAP)
+	}
+	if params.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if params.Side != "1" && params.Side != "2" {
+		return fmt.Errorf("side must be '1' (Buy) or '2' (Sell)")
+	}
+	if params.TotalQty <= 0 {
+		return fmt.Errorf("total_qty must be positive")
+	}
+	if !params.EndTime.After(params.StartTime) {
+		return fmt.Errorf("end_time must be after start_time")
+	}
+	if params.StartTime.Before(time.Now().Add(-startTimeGrace)) {
+		return fmt.Errorf("start_time must not be in the past")
+	}
+	if params.EndTime.Sub(params.StartTime) > maxWindow {
+		return fmt.Errorf("the algo may run for at most %s", maxWindow)
+	}
+	if params.SliceSeconds < 1 || params.SliceSeconds > maxSliceSeconds {
+		return fmt.Errorf("slice_seconds must be between 1 and %d", maxSliceSeconds)
+	}
+	if slices := params.slices(); slices > maxSlices {
+		return fmt.Errorf("%d slices requested, at most %d are allowed; use a longer slice_seconds", slices, maxSlices)
+	}
+	if params.ParticipationRate < 0 || params.ParticipationRate > 1 {
+		return fmt.Errorf("participation_rate must be between 0 and 1")
+	}
+	if params.LimitPrice < 0 || params.MinChildQty < 0 {
+		return fmt.Errorf("limit_price and min_child_qty must not be negative")
+	}
+	for _, weight := range params.VolumeProfile {
+		if weight < 0 {
+			return fmt.Errorf("volume_profile weights must not be negative")
+		}
+	}
+	if len(params.VolumeProfile) > 0 && params.Strategy == StrategyVWAP {
+		/* checked after stretching, since a profile longer than the schedule is sampled */
+		total := 0.0
+		for _, weight := range sliceWeights(params.Strategy, params.slices(), params.StartTime, params.interval(), params.VolumeProfile) {
+			total += weight
+		}
+		if total <= 0 {
+			return fmt.Errorf("volume_profile weights must sum to a positive value over the slices")
+		}
+	}
+	return nil
+}
+
+func (engine *Engine) Start(params Params) (*Algo, error) {
+	if err := Validate(&params); err != nil {
+		return nil, err
+	}
+
+	slices := params.slices()
+	now := time.Now().UTC()
+
+	algo := &Algo{
+		ID:        engine.ids.Next(idgen.AlgoOrder),
+		Params:    params,
+		Status:    StatusRunning,
+		Weights:   sliceWeights(params.Strategy, slices, params.StartTime, params.interval(), params.VolumeProfile),
+		CreatedAt: now,
+		UpdatedAt: now,
+		wake:      make(chan struct{}, 1),
+	}
+	algo.Progress.SlicesTotal = slices
+
+	engine.mu.Lock()
+	engine.algos[algo.ID] = algo
+	engine.save(algo)
+	engine.mu.Unlock()
+
+	go engine.run(algo.ID, algo.wake)
+
+	logger.Info("AlgoStarted", "algo_id", algo.ID, logging.KeyClientID, params.ClientID, "strategy", params.Strategy, logging.KeySymbol, params.Symbol,
+		"side", params.Side, "total_qty", params.TotalQty, "slices", slices)
+	return engine.snapshot(algo.ID), nil
+}
+
+func (engine *Engine) Pause(id string) (*Algo, error) {
+	return engine.transition(id, StatusPaused, StatusRunning)
+}
+
+func (engine *Engine) Resume(id string) (*Algo, error) {
+	return engine.transition(id, StatusRunning, StatusPaused)
+}
+
+// PauseAll pauses every running algo, e.g. when the kill switch is engaged,
+// and returns how many were paused. They stay paused until resumed one by
+// one.
+func (engine *Engine) PauseAll(reason string) int {
+	engine.mu.Lock()
+	var paused []string
+	for id, algo := range engine.algos {
+		if engine.pauseLocked(algo, reason) {
+			paused = append(paused, id)
+		}
+	}
+	engine.mu.Unlock()
+
+	for _, id := range paused {
+		logger.Info("AlgoStatusChanged", "algo_id", id, "status", StatusPaused, "reason", reason)
+	}
+	return len(paused)
+}
+
+func (engine *Engine) pauseLocked(algo *Algo, reason string) bool {
+	if algo.Status != StatusRunning {
+		return false
+	}
+	algo.Status = StatusPaused
+	algo.Error = reason
+	algo.UpdatedAt = time.Now().UTC()
+	engine.save(algo)
+	return true
+}
+
+// Cancel stops the schedule and cancels any child that is still working.
+func (engine *Engine) Cancel(id string) (*Algo, error) {
+	algo, err := engine.transition(id, StatusCancelled, StatusRunning, StatusPaused)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range algo.Children {
+		if order, exists := engine.orders.GetOrderStatus(child.ClOrdID); exists && !order.IsTerminal() {
+			if _, err := engine.orders.CancelOrder(child.ClOrdID); err != nil {
+				logger.Error("AlgoCancelChild", "algo_id", id, logging.KeyClOrdID, child.ClOrdID, logging.Err(err))
+			}
+		}
+	}
+
+	return engine.snapshot(id), nil
+}
+
+func (engine *Engine) Get(id string) (*Algo, bool) {
+	algo := engine.snapshot(id)
+	return algo, algo != nil
+}
+
+// ParentOf returns the ID of the algo that sent the child order clOrdID.
+func (engine *Engine) ParentOf(clOrdID string) (string, bool) {
+	engine.mu.RLock()
+	defer engine.mu.RUnlock()
+	id, exists := engine.children[clOrdID]
+	return id, exists
+}
+
+func (engine *Engine) List(opts store.ListOptions) ([]*Algo, string, error) {
+	engine.mu.RLock()
+	var matched []*Algo
+	for _, algo := range engine.algos {
+		if opts.MatchClient(algo.Params.ClientID) && opts.Match(algo.Params.Symbol, algo.Params.Side, algo.Status, algo.CreatedAt) {
+			matched = append(matched, algo.copyLocked())
+		}
+	}
+	engine.mu.RUnlock()
+
+	return store.Paginate(matched, func(algo *Algo) store.SortKey {
+		return store.SortKey{Time: algo.CreatedAt, ID: algo.ID}
+	}, opts)
+}
+
+func (engine *Engine) transition(id, to string, from ...string) (*Algo, error) {
+	engine.mu.Lock()
+	algo, exists := engine.algos[id]
+	if !exists {
+		engine.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrAlgoNotFound, id)
+	}
+
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || algo.Status == status
+	}
+	if !allowed {
+		engine.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s is %s", ErrAlgoClosed, id, algo.Status)
+	}
+
+	algo.Status = to
+	algo.Error = ""
+	algo.UpdatedAt = time.Now().UTC()
+	engine.save(algo)
+	snapshot := algo.copyLocked()
+	wake := algo.wake
+	engine.mu.Unlock()
+
+	if wake != nil {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+
+	logger.Info("AlgoStatusChanged", "algo_id", id, "status", to)
+	return snapshot, nil
+}
+
+// run drives one parent order: at every slice boundary it works the parent
+// towards its cumulative schedule. Quantity missed while paused or blocked is
+// spread over the remaining slices, each child carrying at most
+// maxCatchUpSlices slices' worth, so it is caught up gradually rather than in
+// one order.
+func (engine *Engine) run(id string, wake chan struct{}) {
+	for {
+		engine.mu.RLock()
+		algo := engine.algos[id]
+		status := algo.Status
+		params := algo.Params
+		engine.mu.RUnlock()
+
+		if status != StatusRunning && status != StatusPaused {
+			return
+		}
+
+		now := time.Now()
+		if !now.Before(params.EndTime) {
+			engine.finish(id, StatusExpired)
+			return
+		}
+
+		var wait time.Duration
+		if now.Before(params.StartTime) {
+			wait = params.StartTime.Sub(now)
+		} else {
+			if status == StatusRunning {
+				engine.slice(id)
+			}
+			elapsed := now.Sub(params.StartTime)
+			wait = params.interval() - elapsed%params.interval()
+		}
+
+		if remaining := params.EndTime.Sub(now); wait > remaining {
+			wait = remaining
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-wake:
+		}
+	}
+}
+
+func (engine *Engine) slice(id string) {
+	/* children would only be refused, and the backlog must not go out in one burst after Rearm */
+	if state := engine.orders.KillSwitch(); state.Halted {
+		engine.mu.Lock()
+		paused := engine.pauseLocked(engine.algos[id], "paused by kill switch: "+state.Reason)
+		engine.mu.Unlock()
+		if paused {
+			logger.Warn("AlgoPausedByKillSwitch", "algo_id", id, "reason", state.Reason)
+		}
+		return
+	}
+
+	engine.mu.Lock()
+	algo := engine.algos[id]
+	params := algo.Params
+
+	if algo.Progress.FilledQty >= params.TotalQty {
+		engine.mu.Unlock()
+		engine.finish(id, StatusCompleted)
+		return
+	}
+
+	current := int(time.Since(params.StartTime) / params.interval())
+	if current >= len(algo.Weights) {
+		current = len(algo.Weights) - 1
+	}
+	algo.Progress.SlicesDone = current + 1
+
+	total, cumulative := 0.0, 0.0
+	for i, weight := range algo.Weights {
+		total += weight
+		if i <= current {
+			cumulative += weight
+		}
+	}
+	if total <= 0 {
+		engine.mu.Unlock()
+		engine.skip(id, "volume profile has no weight")
+		return
+	}
+	scheduled := params.TotalQty * cumulative / total
+	algo.Progress.ScheduledQty = scheduled
+
+	qty := scheduled - algo.Progress.FilledQty - algo.Progress.WorkingQty
+
+	/* this slice's share plus an even part of the backlog, capped; zero-weight slices cap at the average share */
+	sliceQty := params.TotalQty * algo.Weights[current] / total
+	if backlog := qty - sliceQty; backlog > 0 {
+		remaining := float64(len(algo.Weights) - current)
+		limit := math.Max(sliceQty, params.TotalQty/float64(len(algo.Weights))) * maxCatchUpSlices
+		qty = math.Min(sliceQty+backlog/remaining, limit)
+	}
+
+	last := current == len(algo.Weights)-1
+	engine.mu.Unlock()
+
+	if qty <= 0 {
+		return
+	}
+
+	if params.ParticipationRate > 0 {
+		quote, ok := engine.quotes.ReferenceQuote(params.Symbol, quoteTimeout)
+		if !ok || quote.Stale || quote.Size <= 0 {
+			engine.skip(id, "no fresh quote size for participation cap")
+			return
+		}
+		qty = math.Min(qty, quote.Size*params.ParticipationRate)
+	}
+
+	if qty < params.MinChildQty && !last {
+		engine.skip(id, fmt.Sprintf("child quantity %.8f below minimum %.8f", qty, params.MinChildQty))
+		return
+	}
+
+	child := &Child{ClOrdID: engine.orders.NextClOrdID(), Slice: current, OrderQty: qty, SentAt: time.Now().UTC()}
+
+	order := &orders.OrderInfo{
+		ClOrdID:     child.ClOrdID,
+		Symbol:      params.Symbol,
+		Side:        params.Side,
+		OrderQty:    qty,
+		OrdType:     "1",
+		TimeInForce: "3",
+		ClientID:    params.ClientID,
+	}
+	if params.LimitPrice > 0 {
+		order.OrdType = "2"
+		order.Price = params.LimitPrice
+	}
+
+	engine.mu.Lock()
+	engine.children[child.ClOrdID] = id
+	algo.Children = append(algo.Children, child)
+	algo.Progress.ChildOrders++
+	algo.Progress.WorkingQty += qty
+	engine.mu.Unlock()
+
+	err := engine.orders.NewOrderSingle(order)
+
+	engine.mu.Lock()
+	if err != nil {
+		child.Status = "8"
+		child.Error = err.Error()
+		algo.Progress.SkippedSlices++
+		logger.Error("AlgoChildSubmit", "algo_id", id, "slice", current, logging.Err(err))
+	} else if child.Status == "" {
+		child.Status = "A"
+	}
+	algo.recomputeLocked()
+	algo.UpdatedAt = time.Now().UTC()
+	engine.save(algo)
+	engine.mu.Unlock()
+}
+
+func (engine *Engine) skip(id, reason string) {
+	engine.mu.Lock()
+	algo := engine.algos[id]
+	algo.Progress.SkippedSlices++
+	algo.UpdatedAt = time.Now().UTC()
+	engine.save(algo)
+	engine.mu.Unlock()
+
+	logger.Warn("AlgoSliceSkipped", "algo_id", id, "reason", reason)
+}
+
+func (engine *Engine) finish(id, status string) {
+	engine.mu.Lock()
+	algo := engine.algos[id]
+	if algo.Status == StatusRunning || algo.Status == StatusPaused {
+		if status == StatusExpired && algo.Progress.FilledQty >= algo.Params.TotalQty {
+			status = StatusCompleted
+		}
+		algo.Status = status
+		algo.UpdatedAt = time.Now().UTC()
+		engine.save(algo)
+	}
+	engine.mu.Unlock()
+
+	logger.Info("AlgoFinished", "algo_id", id, "status", status)
+}
+
+func (engine *Engine) onOrderEvent(event orders.OrderEvent) {
+	if event.Type != orders.EventStatusChanged {
+		return
+	}
+
+	order := event.Order
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	id, exists := engine.children[order.Handle]
+	if !exists {
+		return
+	}
+	algo := engine.algos[id]
+
+	for _, child := range algo.Children {
+		if child.ClOrdID != order.Handle {
+			continue
+		}
+		child.Status = order.Status
+		child.CumQty = order.CumQty
+		child.AvgPx = order.AvgPx
+	}
+
+	algo.recomputeLocked()
+	algo.UpdatedAt = time.Now().UTC()
+	engine.save(algo)
+
+	if algo.Progress.FilledQty >= algo.Params.TotalQty && algo.wake != nil {
+		select {
+		case algo.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+/* progress is always derived from the children so it cannot drift */
+func (algo *Algo) recomputeLocked() {
+	filled, notional, working := 0.0, 0.0, 0.0
+	for _, child := range algo.Children {
+		filled += child.CumQty
+		notional += child.CumQty * child.AvgPx
+		if !isTerminalStatus(child.Status) {
+			working += child.OrderQty - child.CumQty
+		}
+	}
+
+	algo.Progress.FilledQty = filled
+	algo.Progress.WorkingQty = working
+	algo.Progress.AvgPx = 0
+	if filled > 0 {
+		algo.Progress.AvgPx = notional / filled
+	}
+	algo.Progress.PctComplete = math.Min(filled/algo.Params.TotalQty*100, 100)
+}
+
+func isTerminalStatus(status string) bool {
+	return status == "2" || status == "4" || status == "8" || status == "C"
+}
+
+func (algo *Algo) copyLocked() *Algo {
+	copied := *algo
+	copied.wake = nil
+	copied.Weights = append([]float64(nil), algo.Weights...)
+	copied.Children = make([]*Child, 0, len(algo.Children))
+	for _, child := range algo.Children {
+		childCopy := *child
+		copied.Children = append(copied.Children, &childCopy)
+	}
+	return &copied
+}
+
+func (engine *Engine) snapshot(id string) *Algo {
+	engine.mu.RLock()
+	defer engine.mu.RUnlock()
+
+	algo, exists := engine.algos[id]
+	if !exists {
+		return nil
+	}
+	return algo.copyLocked()
+}
+
+func (engine *Engine) save(algo *Algo) {
+	if err := engine.store.Put(algosBucket, algo.ID, algo); err != nil {
+		logger.Error("AlgoPersist", "algo_id", algo.ID, logging.Err(err))
+	}
+}
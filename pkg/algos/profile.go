@@ -0,0 +1,32 @@
+package algos
+
+import "time"
+
+// defaultVolumeProfile is the relative traded volume per UTC hour used for
+// VWAP when the request does not supply its own profile.
+var defaultVolumeProfile = [24]float64{
+	3.2, 2.9, 2.7, 2.6, 2.7, 3.0, 3.5, 4.1,
+	4.6, 4.9, 5.0, 4.9, 5.0, 5.4, 5.9, 6.0,
+	5.6, 4.9, 4.3, 3.9, 3.6, 3.4, 3.3, 3.2,
+}
+
+// sliceWeights returns the weight of each of n slices starting at start. TWAP
+// weights every slice equally; VWAP uses profile (one weight per slice) if
+// given, otherwise the default hourly profile.
+func sliceWeights(strategy string, n int, start time.Time, interval time.Duration, profile []float64) []float64 {
+	weights := make([]float64, n)
+
+	for i := range weights {
+		switch {
+		case strategy != StrategyVWAP:
+			weights[i] = 1
+		case len(profile) > 0:
+			/* stretch the supplied profile over the slices */
+			weights[i] = profile[i*len(profile)/n]
+		default:
+			weights[i] = defaultVolumeProfile[start.Add(time.Duration(i)*interval).UTC().Hour()]
+		}
+	}
+
+	return weights
+}
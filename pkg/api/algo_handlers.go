@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"bcb-fix-microservice/pkg/algos"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) startAlgoHandler(w http.ResponseWriter, r *http.Request) {
+	var req AlgoRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	params := algos.Params{
+		Strategy:          req.Strategy,
+		Symbol:            req.Symbol,
+		Side:              req.Side,
+		TotalQty:          req.TotalQty,
+		StartTime:         time.Now().UTC(),
+		SliceSeconds:      req.SliceSeconds,
+		LimitPrice:        req.LimitPrice,
+		ParticipationRate: req.ParticipationRate,
+		MinChildQty:       req.MinChildQty,
+		VolumeProfile:     req.VolumeProfile,
+		ClientID:          callerID(r),
+	}
+	if req.StartTime != nil {
+		params.StartTime = req.StartTime.UTC()
+	}
+
+	switch {
+	case req.EndTime != nil && req.DurationSeconds > 0:
+		s.writeError(w, "specify either end_time or duration_seconds", http.StatusBadRequest)
+		return
+	case req.EndTime != nil:
+		params.EndTime = req.EndTime.UTC()
+	default:
+		params.EndTime = params.StartTime.Add(time.Duration(req.DurationSeconds) * time.Second)
+	}
+
+	if err := algos.Validate(&params); err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	algo, err := s.algos.Start(params)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to start algo: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeSuccess(w, algo)
+}
+
+func (s *Server) getAlgoHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	algoID := vars["algoId"]
+
+	algo, exists := s.algos.Get(algoID)
+	if !exists || !canAccess(r, algo.Params.ClientID) {
+		s.writeError(w, "Algo order not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeSuccess(w, algo)
+}
+
+func (s *Server) listAlgosHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, nextCursor, err := s.algos.List(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: items, NextCursor: nextCursor})
+}
+
+func (s *Server) pauseAlgoHandler(w http.ResponseWriter, r *http.Request) {
+	s.controlAlgo(w, r, "pause", s.algos.Pause)
+}
+
+func (s *Server) resumeAlgoHandler(w http.ResponseWriter, r *http.Request) {
+	s.controlAlgo(w, r, "resume", s.algos.Resume)
+}
+
+func (s *Server) cancelAlgoHandler(w http.ResponseWriter, r *http.Request) {
+	s.controlAlgo(w, r, "cancel", s.algos.Cancel)
+}
+
+func (s *Server) controlAlgo(w http.ResponseWriter, r *http.Request, action string, fn func(id string) (*algos.Algo, error)) {
+	vars := mux.Vars(r)
+	algoID := vars["algoId"]
+
+	if owned, exists := s.algos.Get(algoID); !exists || !canAccess(r, owned.Params.ClientID) {
+		s.writeError(w, "Algo order not found", http.StatusNotFound)
+		return
+	}
+
+	algo, err := fn(algoID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, algos.ErrAlgoNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, algos.ErrAlgoClosed):
+			status = http.StatusConflict
+		}
+		s.writeError(w, fmt.Sprintf("Failed to %s algo: %v", action, err), status)
+		return
+	}
+
+	s.writeSuccess(w, algo)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bcb-fix-microservice/pkg/journal"
+	"bcb-fix-microservice/pkg/logging"
+)
+
+// listAuditMessagesHandler serves the message journal. order takes any ID of
+// an order and returns the wire history of its whole cancel/replace chain;
+// cl_ord_id, order_id and exec_id match single identifiers.
+func (s *Server) listAuditMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if s.journal == nil {
+		s.writeError(w, "Message journal is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	q, err := parseJournalQuery(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if id := r.URL.Query().Get("order"); id != "" {
+		order, exists := s.ordersClient.GetOrderStatus(id)
+		if !exists {
+			s.writeError(w, "Order not found", http.StatusNotFound)
+			return
+		}
+
+		q.ClOrdIDs = append(q.ClOrdIDs, order.ClOrdIDChain...)
+		if order.Pending != nil {
+			q.ClOrdIDs = append(q.ClOrdIDs, order.Pending.ClOrdID)
+		}
+		if order.OrderID != "" {
+			q.OrderIDs = append(q.OrderIDs, order.OrderID)
+		}
+	}
+
+	entries, nextCursor, err := s.journal.List(q)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if entries == nil {
+		entries = []*journal.Entry{}
+	}
+	s.writeSuccess(w, ListResponse{Items: entries, NextCursor: nextCursor})
+}
+
+func parseJournalQuery(r *http.Request) (journal.Query, error) {
+	query := r.URL.Query()
+
+	q := journal.Query{
+		Symbol:  query.Get("symbol"),
+		MsgType: query.Get("msg_type"),
+		Session: query.Get("session"),
+		Cursor:  query.Get("cursor"),
+	}
+
+	if id := query.Get("cl_ord_id"); id != "" {
+		q.ClOrdIDs = []string{id}
+	}
+	if id := query.Get("order_id"); id != "" {
+		q.OrderIDs = []string{id}
+	}
+	if id := query.Get("exec_id"); id != "" {
+		q.ExecIDs = []string{id}
+	}
+
+	switch direction := query.Get("direction"); direction {
+	case "", logging.DirIn, logging.DirOut:
+		q.Direction = direction
+	default:
+		return q, fmt.Errorf("direction must be 'in' or 'out'")
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return q, fmt.Errorf("from must be an RFC3339 timestamp")
+		}
+		q.From = t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return q, fmt.Errorf("to must be an RFC3339 timestamp")
+		}
+		q.To = t
+	}
+
+	switch query.Get("sort") {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, fmt.Errorf("sort must be 'asc' or 'desc'")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+		q.Limit = n
+	}
+
+	return q, nil
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/iceberg"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/triggers"
+	"github.com/gorilla/mux"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+type contextKey int
+
+const clientContextKey contextKey = iota
+
+/* used for every request when authentication is disabled */
+var anonymousAdmin = &auth.Client{ID: "anonymous", Name: "anonymous", Scopes: []string{auth.ScopeAdmin}}
+
+// require authenticates the request with its API key and rejects it unless
+// the client holds scope. An empty scope only requires a valid key.
+func (s *Server) require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := anonymousAdmin
+
+		if !s.config.AuthDisabled {
+			key := r.Header.Get(APIKeyHeader)
+			if bearer := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(bearer, "Bearer ") {
+				key = strings.TrimPrefix(bearer, "Bearer ")
+			}
+
+			authenticated, ok := s.keys.Authenticate(key)
+			if !ok {
+				logger.Warn("AuthFailed", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				s.writeError(w, "Missing or invalid API key", http.StatusUnauthorized)
+				return
+			}
+			client = authenticated
+		}
+
+		if scope != "" && !client.HasScope(scope) {
+			logger.Warn("AuthForbidden", logging.KeyClientID, client.ID, "scope", scope, "method", r.Method, "path", r.URL.Path)
+			s.writeError(w, fmt.Sprintf("API key lacks the '%s' scope", scope), http.StatusForbidden)
+			return
+		}
+
+		if !s.allowRequest(w, r, client.ID, rateClass(scope, r.Method)) {
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), clientContextKey, client)))
+	}
+}
+
+func callerFrom(r *http.Request) *auth.Client {
+	if client, ok := r.Context().Value(clientContextKey).(*auth.Client); ok {
+		return client
+	}
+	return anonymousAdmin
+}
+
+// callerID is the client ID recorded on resources the request creates.
+func callerID(r *http.Request) string {
+	return callerFrom(r).ID
+}
+
+// canAccess reports whether the caller may see a resource owned by ownerID.
+// Admins see everything; resources created before authentication existed
+// have no owner and are admin-only.
+func canAccess(r *http.Request, ownerID string) bool {
+	caller := callerFrom(r)
+	return caller.IsAdmin() || caller.ID == ownerID
+}
+
+/* resources owned by another client are reported as not found */
+func (s *Server) visibleOrder(r *http.Request, id string) (*orders.OrderInfo, bool) {
+	order, exists := s.ordersClient.GetOrderStatus(id)
+	if !exists || !canAccess(r, order.ClientID) {
+		return nil, false
+	}
+	return order, true
+}
+
+func (s *Server) visibleTrigger(r *http.Request, id string) (*triggers.Trigger, bool) {
+	trigger, exists := s.triggers.Get(id)
+	if !exists || !canAccess(r, trigger.ClientID) {
+		return nil, false
+	}
+	return trigger, true
+}
+
+func (s *Server) visibleIceberg(r *http.Request, id string) (*iceberg.Iceberg, bool) {
+	ice, exists := s.icebergs.Get(id)
+	if !exists || !canAccess(r, ice.ClientID) {
+		return nil, false
+	}
+	return ice, true
+}
+
+func (s *Server) createClientHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIClientRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client, key, err := s.keys.Create(req.ID, req.Name, req.Scopes)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client.KeyHash = ""
+	s.writeSuccess(w, APIClientResponse{Client: client, APIKey: key})
+}
+
+func (s *Server) listClientsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, s.keys.List())
+}
+
+func (s *Server) deleteClientHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientID := vars["clientId"]
+
+	if err := s.keys.Delete(clientID); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrClientNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrClientReadOnly):
+			status = http.StatusConflict
+		}
+		s.writeError(w, err.Error(), status)
+		return
+	}
+
+	s.writeSuccess(w, map[string]string{"id": clientID})
+}
+
+func (s *Server) whoAmIHandler(w http.ResponseWriter, r *http.Request) {
+	client := *callerFrom(r)
+	client.KeyHash = ""
+	s.writeSuccess(w, client)
+}
@@ -2,12 +2,15 @@ package api
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"bcb-fix-microservice/pkg/algos"
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
 	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/store"
 	"github.com/gorilla/mux"
 )
 
@@ -23,7 +26,7 @@ func (s *Server) createExchangeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exchangeID := generateExchangeID()
+	exchangeID := s.ids.Next(idgen.Exchange)
 
 	symbol, side, err := s.determineSymbolAndSide(req.FromCurrency, req.ToCurrency)
 	if err != nil {
@@ -31,57 +34,205 @@ func (s *Server) createExchangeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderInfo := &orders.OrderInfo{
-		ClOrdID:     generateOrderID(),
-		Symbol:      symbol,
-		Side:        side,
-		OrderQty:    req.Amount,
-		Price:       req.LimitPrice,
-		OrdType:     s.getOrderType(req.Type),
-		TimeInForce: "3",
+	exchange := &ExchangeResponse{
+		ExchangeID:     exchangeID,
+		FromCurrency:   req.FromCurrency,
+		ToCurrency:     req.ToCurrency,
+		Amount:         req.Amount,
+		Type:           req.Type,
+		Status:         "pending",
+		Symbol:         symbol,
+		Side:           side,
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
+		ClientID:       callerID(r),
+		CreatedAt:      time.Now(),
 	}
 
-	if err := s.ordersClient.NewOrderSingle(orderInfo); err != nil {
-		s.writeError(w, fmt.Sprintf("Failed to create exchange order: %v", err), http.StatusInternalServerError)
-		return
-	}
+	if req.Algo != nil {
+		params := s.exchangeAlgoParams(&req, symbol, side, exchange.ClientID)
+		if err := algos.Validate(&params); err != nil {
+			s.writeError(w, "algo: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	exchange := &ExchangeResponse{
-		ExchangeID:   exchangeID,
-		FromCurrency: req.FromCurrency,
-		ToCurrency:   req.ToCurrency,
-		Amount:       req.Amount,
-		Type:         req.Type,
-		Status:       "pending",
-		OrderID:      orderInfo.ClOrdID,
-		Symbol:       symbol,
-		Side:         side,
-		CreatedAt:    time.Now(),
+		algo, err := s.algos.Start(params)
+		if err != nil {
+			s.writeError(w, fmt.Sprintf("Failed to start exchange algo: %v", err), http.StatusInternalServerError)
+			return
+		}
+		exchange.AlgoID = algo.ID
+	} else {
+		orderInfo := &orders.OrderInfo{
+			ClOrdID:        s.ordersClient.NextClOrdID(),
+			Symbol:         symbol,
+			Side:           side,
+			OrderQty:       req.Amount,
+			Price:          req.LimitPrice,
+			OrdType:        s.getOrderType(req.Type),
+			TimeInForce:    "3",
+			IdempotencyKey: exchange.IdempotencyKey,
+			ClientID:       exchange.ClientID,
+		}
+
+		if err := s.ordersClient.NewOrderSingleContext(r.Context(), orderInfo); err != nil {
+			s.writeError(w, fmt.Sprintf("Failed to create exchange order: %v", err), orderErrorStatus(err))
+			return
+		}
+		exchange.OrderID = orderInfo.ClOrdID
 	}
 
-	s.exchanges[exchangeID] = exchange
+	s.mu.Lock()
+	s.indexExchangeLocked(exchange)
+	s.saveExchange(exchange)
+	s.mu.Unlock()
 
-	log.Printf("[EXCHANGE] Created: %s (%s %s %.6f) -> Order: %s",
-		exchangeID, req.FromCurrency, req.ToCurrency, req.Amount, orderInfo.ClOrdID)
+	logger.Info("ExchangeCreated", "exchange_id", exchangeID, logging.KeyClientID, exchange.ClientID, "from", req.FromCurrency,
+		"to", req.ToCurrency, "amount", req.Amount, logging.KeyClOrdID, exchange.OrderID, "algo_id", exchange.AlgoID)
 
 	s.writeSuccess(w, exchange)
 }
 
+/* a limit exchange caps every child at limit_price, a market exchange sends market children */
+func (s *Server) exchangeAlgoParams(req *ExchangeRequest, symbol, side, clientID string) algos.Params {
+	start := time.Now().UTC()
+	params := algos.Params{
+		Strategy:          req.Algo.Strategy,
+		Symbol:            symbol,
+		Side:              side,
+		TotalQty:          req.Amount,
+		StartTime:         start,
+		EndTime:           start.Add(time.Duration(req.Algo.DurationSeconds) * time.Second),
+		SliceSeconds:      req.Algo.SliceSeconds,
+		ParticipationRate: req.Algo.ParticipationRate,
+		MinChildQty:       req.Algo.MinChildQty,
+		ClientID:          clientID,
+	}
+	if req.Type == "limit" {
+		params.LimitPrice = req.LimitPrice
+	}
+	return params
+}
+
 func (s *Server) getExchangeStatusHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	exchangeID := vars["exchangeId"]
 
+	s.mu.Lock()
 	exchange, exists := s.exchanges[exchangeID]
-	if !exists {
+	if exists {
+		s.refreshExchangeStatus(exchange)
+		snapshot := *exchange
+		exchange = &snapshot
+	}
+	s.mu.Unlock()
+
+	if !exists || !canAccess(r, exchange.ClientID) {
 		s.writeError(w, "Exchange operation not found", http.StatusNotFound)
 		return
 	}
 
-	if order, exists := s.ordersClient.GetOrderStatus(exchange.OrderID); exists {
-		exchange.Status = s.mapOrderStatusToExchangeStatus(order.Status)
+	s.writeSuccess(w, exchange)
+}
+
+func (s *Server) listExchangesHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var matched []*ExchangeResponse
+	s.mu.Lock()
+	for _, exchange := range s.exchanges {
+		s.refreshExchangeStatus(exchange)
+
+		if opts.MatchClient(exchange.ClientID) && opts.Match(exchange.Symbol, exchange.Side, exchange.Status, exchange.CreatedAt) {
+			snapshot := *exchange
+			matched = append(matched, &snapshot)
+		}
 	}
+	s.mu.Unlock()
 
-	s.writeSuccess(w, exchange)
+	exchanges, nextCursor, err := store.Paginate(matched, func(exchange *ExchangeResponse) store.SortKey {
+		return store.SortKey{Time: exchange.CreatedAt, ID: exchange.ExchangeID}
+	}, opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: exchanges, NextCursor: nextCursor})
+}
+
+// refreshExchangeStatus must be called with s.mu held. It returns the previous
+// status when the exchange status changed.
+func (s *Server) refreshExchangeStatus(exchange *ExchangeResponse) (string, bool) {
+	var status string
+	if exchange.AlgoID != "" {
+		algo, exists := s.algos.Get(exchange.AlgoID)
+		if !exists {
+			return "", false
+		}
+		status = s.mapAlgoStatusToExchangeStatus(algo)
+	} else {
+		order, exists := s.ordersClient.GetOrderStatus(exchange.OrderID)
+		if !exists {
+			return "", false
+		}
+		status = s.mapOrderStatusToExchangeStatus(order.Status)
+	}
+
+	previousStatus := exchange.Status
+	if status == previousStatus {
+		return "", false
+	}
+
+	exchange.Status = status
+	s.saveExchange(exchange)
+	return previousStatus, true
+}
+
+// findExchangeByOrder must be called with s.mu held.
+func (s *Server) findExchangeByOrder(clOrdID string) *ExchangeResponse {
+	/* events of algo children belong to the exchange that owns the parent */
+	key := clOrdID
+	if algoID, isChild := s.algos.ParentOf(clOrdID); isChild {
+		key = algoID
+	}
+
+	exchangeID, exists := s.exchangeIndex[key]
+	if !exists {
+		return nil
+	}
+	return s.exchanges[exchangeID]
+}
+
+/* must be called with s.mu held */
+func (s *Server) indexExchangeLocked(exchange *ExchangeResponse) {
+	s.exchanges[exchange.ExchangeID] = exchange
+	if exchange.AlgoID != "" {
+		s.exchangeIndex[exchange.AlgoID] = exchange.ExchangeID
+	} else if exchange.OrderID != "" {
+		s.exchangeIndex[exchange.OrderID] = exchange.ExchangeID
+	}
+}
+
+func (s *Server) loadExchanges() {
+	exchanges, err := store.LoadAll[ExchangeResponse](s.store, store.ExchangesBucket)
+	if err != nil {
+		logger.Error("ExchangesStoreLoad", logging.Err(err))
+		return
+	}
+
+	for _, exchange := range exchanges {
+		s.indexExchangeLocked(exchange)
+	}
+}
+
+func (s *Server) saveExchange(exchange *ExchangeResponse) {
+	if err := s.store.Put(store.ExchangesBucket, exchange.ExchangeID, exchange); err != nil {
+		logger.Error("ExchangePersist", "exchange_id", exchange.ExchangeID, logging.Err(err))
+	}
 }
 
 func (s *Server) validateExchangeRequest(req *ExchangeRequest) error {
@@ -103,6 +254,9 @@ func (s *Server) validateExchangeRequest(req *ExchangeRequest) error {
 	if req.Type == "limit" && req.LimitPrice <= 0 {
 		return fmt.Errorf("limit_price is required for limit orders")
 	}
+	if req.Algo != nil && req.Algo.DurationSeconds <= 0 {
+		return fmt.Errorf("algo.duration_seconds must be positive")
+	}
 	return nil
 }
 
@@ -158,7 +312,7 @@ func (s *Server) mapOrderStatusToExchangeStatus(orderStatus string) string {
 	switch orderStatus {
 	case "A":
 		return "pending"
-	case "0":
+	case "0", "6", "E":
 		return "pending"
 	case "1":
 		return "partial"
@@ -173,6 +327,22 @@ func (s *Server) mapOrderStatusToExchangeStatus(orderStatus string) string {
 	}
 }
 
-func generateExchangeID() string {
-	return fmt.Sprintf("exch-%d", time.Now().UnixNano())
+func (s *Server) mapAlgoStatusToExchangeStatus(algo *algos.Algo) string {
+	filled := algo.Progress.FilledQty > 0
+	switch algo.Status {
+	case algos.StatusCompleted:
+		return "completed"
+	case algos.StatusCancelled:
+		return "cancelled"
+	case algos.StatusExpired:
+		if filled {
+			return "partial"
+		}
+		return "failed"
+	default:
+		if filled {
+			return "partial"
+		}
+		return "pending"
+	}
 }
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"bcb-fix-microservice/pkg/iceberg"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) createIcebergHandler(w http.ResponseWriter, r *http.Request) {
+	var req IcebergRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.TimeInForce == "" {
+		req.TimeInForce = "1"
+	}
+
+	ice := &iceberg.Iceberg{
+		Symbol:      req.Symbol,
+		Side:        req.Side,
+		TotalQty:    req.TotalQty,
+		DisplayQty:  req.DisplayQty,
+		Price:       req.Price,
+		TimeInForce: req.TimeInForce,
+		ClientID:    callerID(r),
+	}
+
+	if err := iceberg.Validate(ice); err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.icebergs.Create(ice)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to create iceberg order: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, created)
+}
+
+func (s *Server) getIcebergHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	icebergID := vars["icebergId"]
+
+	ice, exists := s.visibleIceberg(r, icebergID)
+	if !exists {
+		s.writeError(w, "Iceberg order not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeSuccess(w, ice)
+}
+
+func (s *Server) listIcebergsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, nextCursor, err := s.icebergs.List(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: items, NextCursor: nextCursor})
+}
+
+func (s *Server) cancelIcebergHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.cancelIceberg(w, r, vars["icebergId"])
+}
+
+func (s *Server) replaceIcebergHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req IcebergReplaceRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.replaceIceberg(w, r, vars["icebergId"], req)
+}
+
+func (s *Server) cancelIceberg(w http.ResponseWriter, r *http.Request, id string) {
+	if _, exists := s.visibleIceberg(r, id); !exists {
+		s.writeError(w, "Iceberg order not found", http.StatusNotFound)
+		return
+	}
+
+	ice, err := s.icebergs.Cancel(id)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to cancel iceberg order: %v", err), icebergErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, ice)
+}
+
+func (s *Server) replaceIceberg(w http.ResponseWriter, r *http.Request, id string, req IcebergReplaceRequest) {
+	if _, exists := s.visibleIceberg(r, id); !exists {
+		s.writeError(w, "Iceberg order not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Price < 0 || req.TotalQty < 0 || req.DisplayQty < 0 {
+		s.writeError(w, "price, total_qty and display_qty must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	ice, err := s.icebergs.Replace(id, iceberg.Amendment{Price: req.Price, TotalQty: req.TotalQty, DisplayQty: req.DisplayQty})
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to replace iceberg order: %v", err), icebergErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, ice)
+}
+
+func icebergErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, iceberg.ErrIcebergNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, iceberg.ErrIcebergClosed):
+		return http.StatusConflict
+	case errors.Is(err, iceberg.ErrInvalidAmend):
+		return http.StatusBadRequest
+	default:
+		return orderErrorStatus(err)
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	idempotencyBucket    = "idempotency"
+)
+
+type idempotencyRecord struct {
+	Key         string          `json:"key"`
+	Scope       string          `json:"scope"`
+	RequestHash string          `json:"request_hash"`
+	ClOrdID     string          `json:"cl_ord_id"`
+	StatusCode  int             `json:"status_code"`
+	Response    json.RawMessage `json:"response"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// idempotent replays the stored response for a repeated Idempotency-Key
+// within the configured window instead of submitting a second order.
+func (s *Server) idempotent(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			s.writeError(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.writeError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(hash[:])
+		/* keys are per client so that two clients cannot collide or replay each other */
+		recordKey := scope + ":" + callerID(r) + ":" + key
+
+		s.idempotencyMu.Lock()
+		var record idempotencyRecord
+		found, err := s.store.Get(idempotencyBucket, recordKey, &record)
+		if err != nil {
+			logger.Error("IdempotencyLookup", "key", recordKey, logging.Err(err))
+		}
+		if found && time.Since(record.CreatedAt) > s.config.IdempotencyWindow {
+			found = false
+		}
+		inFlight := s.idempotencyInFlight[recordKey]
+		if !found && !inFlight {
+			s.idempotencyInFlight[recordKey] = true
+		}
+		s.idempotencyMu.Unlock()
+
+		if inFlight {
+			s.writeError(w, "A request with this Idempotency-Key is already in progress", http.StatusConflict)
+			return
+		}
+
+		if found {
+			if record.RequestHash != requestHash {
+				s.writeError(w, "Idempotency-Key was already used with a different request body", http.StatusConflict)
+				return
+			}
+
+			logger.Info("IdempotentReplay", "key", recordKey, logging.KeyClOrdID, record.ClOrdID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Response)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r)
+
+		s.idempotencyMu.Lock()
+		defer s.idempotencyMu.Unlock()
+		delete(s.idempotencyInFlight, recordKey)
+
+		/* only successful submissions are cached so that failures can be retried */
+		if recorder.statusCode < 200 || recorder.statusCode >= 300 {
+			return
+		}
+
+		record = idempotencyRecord{
+			Key:         key,
+			Scope:       scope,
+			RequestHash: requestHash,
+			ClOrdID:     extractOrderID(recorder.body.Bytes()),
+			StatusCode:  recorder.statusCode,
+			Response:    json.RawMessage(bytes.TrimSpace(recorder.body.Bytes())),
+			CreatedAt:   time.Now().UTC(),
+		}
+
+		if err := s.store.Put(idempotencyBucket, recordKey, &record); err != nil {
+			logger.Error("IdempotencyPersist", "key", recordKey, logging.Err(err))
+		}
+	}
+}
+
+func (s *Server) pruneIdempotencyRecords() {
+	var expired []string
+
+	err := s.store.ForEach(idempotencyBucket, func(key string, data []byte) error {
+		var record idempotencyRecord
+		if err := json.Unmarshal(data, &record); err != nil || time.Since(record.CreatedAt) > s.config.IdempotencyWindow {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("IdempotencyPrune", logging.Err(err))
+		return
+	}
+
+	for _, key := range expired {
+		s.store.Delete(idempotencyBucket, key)
+	}
+}
+
+func extractOrderID(body []byte) string {
+	var response struct {
+		Data struct {
+			OrderID string `json:"order_id"`
+		} `json:"data"`
+	}
+
+	json.Unmarshal(body, &response)
+	return response.Data.OrderID
+}
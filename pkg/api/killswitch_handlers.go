@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/orders"
+)
+
+func (s *Server) massCancelHandler(w http.ResponseWriter, r *http.Request) {
+	var scope orders.MassCancelScope
+	if err := s.decodeJSON(r, &scope); err != nil && err != io.EOF {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if scope.Side != "" && scope.Side != "1" && scope.Side != "2" {
+		s.writeError(w, "side must be '1' (Buy) or '2' (Sell)", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.ordersClient.MassCancel(scope, 5*time.Second)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to mass cancel: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeSuccess(w, result)
+}
+
+func (s *Server) engageKillSwitchHandler(w http.ResponseWriter, r *http.Request) {
+	var req KillSwitchRequest
+	if err := s.decodeJSON(r, &req); err != nil && err != io.EOF {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Reason == "" {
+		req.Reason = "kill switch engaged via API"
+	}
+
+	response := KillSwitchResponse{State: s.ordersClient.Halt(req.Reason)}
+	response.PausedAlgos = s.algos.PauseAll("paused by kill switch: " + req.Reason)
+
+	result, err := s.ordersClient.MassCancel(orders.MassCancelScope{}, 5*time.Second)
+	if err != nil {
+		logger.Error("KillSwitchMassCancel", logging.Err(err))
+		response.Error = err.Error()
+	}
+	response.MassCancel = result
+
+	s.writeSuccess(w, response)
+}
+
+func (s *Server) getKillSwitchHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, KillSwitchResponse{State: s.ordersClient.KillSwitch()})
+}
+
+func (s *Server) rearmKillSwitchHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, KillSwitchResponse{State: s.ordersClient.Rearm()})
+}
@@ -1,11 +1,14 @@
 package api
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/ratelimit"
 )
 
 func (s *Server) subscribeMarketDataHandler(w http.ResponseWriter, r *http.Request) {
@@ -21,8 +24,8 @@ func (s *Server) subscribeMarketDataHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err := s.mdClient.SubscribeToMarketDataWithWait(req.Symbol, 10*time.Second); err != nil {
-		log.Printf("Subscribe to market data with timeout")
-		s.writeError(w, fmt.Sprintf("Failed to subscribe: %v", err), http.StatusInternalServerError)
+		logger.Warn("MarketDataSubscribeFailed", logging.KeySymbol, req.Symbol, logging.Err(err))
+		s.writeError(w, fmt.Sprintf("Failed to subscribe: %v", err), marketDataErrorStatus(err))
 		return
 	}
 
@@ -42,7 +45,7 @@ func (s *Server) unsubscribeMarketDataHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	if err := s.mdClient.UnsubscribeFromMarketData(req.Symbol); err != nil {
-		s.writeError(w, fmt.Sprintf("Failed to unsubscribe: %v", err), http.StatusInternalServerError)
+		s.writeError(w, fmt.Sprintf("Failed to unsubscribe: %v", err), marketDataErrorStatus(err))
 		return
 	}
 
@@ -51,7 +54,7 @@ func (s *Server) unsubscribeMarketDataHandler(w http.ResponseWriter, r *http.Req
 
 func (s *Server) requestSecuritiesHandler(w http.ResponseWriter, r *http.Request) {
 	if err := s.mdClient.RequestSecurityList(); err != nil {
-		s.writeError(w, fmt.Sprintf("Failed to request securities: %v", err), http.StatusInternalServerError)
+		s.writeError(w, fmt.Sprintf("Failed to request securities: %v", err), marketDataErrorStatus(err))
 		return
 	}
 
@@ -91,3 +94,10 @@ func (s *Server) getQuotesHandler(w http.ResponseWriter, r *http.Request) {
 
 	s.writeSuccess(w, response)
 }
+
+func marketDataErrorStatus(err error) int {
+	if errors.Is(err, ratelimit.ErrThrottled) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"bcb-fix-microservice/pkg/metrics"
+	"bcb-fix-microservice/pkg/tracing"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+var tracer = tracing.Tracer("api")
+
+// instrument starts the request span and records request latency labelled
+// with the route template rather than the path, so that IDs do not create new
+// series. An incoming traceparent header continues the caller's trace.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+		))
+		if span.SpanContext().IsValid() {
+			recorder.Header().Set("Trace-Id", span.SpanContext().TraceID().String())
+		}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.statusCode))
+		if recorder.statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(recorder.statusCode))
+		}
+		span.End()
+
+		metrics.HTTPDuration.WithLabelValues(route, r.Method, strconv.Itoa(recorder.statusCode)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"bcb-fix-microservice/pkg/groups"
+	"bcb-fix-microservice/pkg/triggers"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) createOrderGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var req OrderGroupRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Symbol == "" {
+		s.writeError(w, "symbol is required", http.StatusBadRequest)
+		return
+	}
+
+	var group *groups.Group
+	var err error
+
+	switch req.Type {
+	case groups.TypeOCO:
+		if len(req.Legs) < 2 {
+			s.writeError(w, "an OCO group needs at least two legs", http.StatusBadRequest)
+			return
+		}
+
+		legs := make([]*groups.Leg, 0, len(req.Legs))
+		for i := range req.Legs {
+			leg, err := s.groupLeg(&req.Legs[i], req.Symbol)
+			if err != nil {
+				s.writeError(w, fmt.Sprintf("legs[%d]: %v", i, err), http.StatusBadRequest)
+				return
+			}
+			legs = append(legs, leg)
+		}
+
+		group, err = s.groups.CreateOCO(callerID(r), req.Symbol, legs)
+	case groups.TypeBracket:
+		if req.Entry == nil || req.TakeProfit == nil || req.StopLoss == nil {
+			s.writeError(w, "a bracket needs entry, take_profit and stop_loss", http.StatusBadRequest)
+			return
+		}
+		if req.Entry.TriggerType != "" {
+			s.writeError(w, "entry: trigger_type is not supported on bracket entries", http.StatusBadRequest)
+			return
+		}
+
+		var entry, takeProfit, stopLoss *groups.Leg
+
+		if entry, err = s.groupLeg(req.Entry, req.Symbol); err != nil {
+			s.writeError(w, fmt.Sprintf("entry: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if req.StopLoss.TriggerType == "" {
+			req.StopLoss.TriggerType = triggers.TypeStopLoss
+		}
+
+		if takeProfit, err = s.bracketExit(req.TakeProfit, req.Entry, req.Symbol); err != nil {
+			s.writeError(w, fmt.Sprintf("take_profit: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if stopLoss, err = s.bracketExit(req.StopLoss, req.Entry, req.Symbol); err != nil {
+			s.writeError(w, fmt.Sprintf("stop_loss: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		group, err = s.groups.CreateBracket(callerID(r), req.Symbol, entry, takeProfit, stopLoss)
+	default:
+		s.writeError(w, fmt.Sprintf("type must be '%s' or '%s'", groups.TypeOCO, groups.TypeBracket), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to create order group: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, group)
+}
+
+func (s *Server) groupLeg(req *OrderRequest, symbol string) (*groups.Leg, error) {
+	req.Symbol = symbol
+	if err := s.validateOrderRequest(req); err != nil {
+		return nil, err
+	}
+
+	leg := &groups.Leg{
+		Side:         req.Side,
+		OrderQty:     req.OrderQty,
+		OrdType:      req.OrdType,
+		Price:        req.Price,
+		TimeInForce:  req.TimeInForce,
+		TriggerType:  req.TriggerType,
+		TriggerPrice: req.TriggerPrice,
+		TrailAmount:  req.TrailAmount,
+		TrailPercent: req.TrailPercent,
+	}
+
+	if leg.TriggerType != "" {
+		err := triggers.Validate(&triggers.Trigger{
+			Type:         leg.TriggerType,
+			OrdType:      leg.OrdType,
+			TriggerPrice: leg.TriggerPrice,
+			TrailAmount:  leg.TrailAmount,
+			TrailPercent: leg.TrailPercent,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return leg, nil
+}
+
+/* exit side and quantity follow the entry; the quantity is reset to the filled amount later */
+func (s *Server) bracketExit(req *OrderRequest, entry *OrderRequest, symbol string) (*groups.Leg, error) {
+	if req.Side == "" {
+		req.Side = oppositeSide(entry.Side)
+	}
+	req.OrderQty = entry.OrderQty
+
+	return s.groupLeg(req, symbol)
+}
+
+func (s *Server) getOrderGroupHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupId"]
+
+	group, exists := s.groups.Get(groupID)
+	if !exists || !canAccess(r, group.ClientID) {
+		s.writeError(w, "Order group not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeSuccess(w, group)
+}
+
+func (s *Server) listOrderGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, nextCursor, err := s.groups.List(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: items, NextCursor: nextCursor})
+}
+
+func (s *Server) cancelOrderGroupHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupId"]
+
+	if owned, exists := s.groups.Get(groupID); !exists || !canAccess(r, owned.ClientID) {
+		s.writeError(w, "Order group not found", http.StatusNotFound)
+		return
+	}
+
+	group, err := s.groups.Cancel(groupID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, groups.ErrGroupNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, groups.ErrGroupClosed):
+			status = http.StatusConflict
+		}
+		s.writeError(w, fmt.Sprintf("Failed to cancel order group: %v", err), status)
+		return
+	}
+
+	s.writeSuccess(w, group)
+}
+
+func oppositeSide(side string) string {
+	if side == "1" {
+		return "2"
+	}
+	return "1"
+}
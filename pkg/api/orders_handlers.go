@@ -1,11 +1,16 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"bcb-fix-microservice/pkg/idgen"
 	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/ratelimit"
+	"bcb-fix-microservice/pkg/risk"
+	"bcb-fix-microservice/pkg/triggers"
 	"github.com/gorilla/mux"
 )
 
@@ -21,18 +26,31 @@ func (s *Server) createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	clOrdID, err := s.resolveClOrdID(req.ClOrdID)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.TriggerType != "" {
+		s.createTriggerOrder(w, r, &req, clOrdID)
+		return
+	}
+
 	orderInfo := &orders.OrderInfo{
-		ClOrdID:     generateOrderID(),
-		Symbol:      req.Symbol,
-		Side:        req.Side,
-		OrderQty:    req.OrderQty,
-		Price:       req.Price,
-		OrdType:     req.OrdType,
-		TimeInForce: req.TimeInForce,
+		ClOrdID:        clOrdID,
+		Symbol:         req.Symbol,
+		Side:           req.Side,
+		OrderQty:       req.OrderQty,
+		Price:          req.Price,
+		OrdType:        req.OrdType,
+		TimeInForce:    req.TimeInForce,
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
+		ClientID:       callerID(r),
 	}
 
-	if err := s.ordersClient.NewOrderSingle(orderInfo); err != nil {
-		s.writeError(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
+	if err := s.ordersClient.NewOrderSingleContext(r.Context(), orderInfo); err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to create order: %v", err), orderErrorStatus(err))
 		return
 	}
 
@@ -43,18 +61,30 @@ func (s *Server) cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID := vars["orderId"]
 
-	order, exists := s.ordersClient.GetOrderStatus(orderID)
+	/* a slice of an iceberg cancels the whole iceberg */
+	if icebergID, exists := s.icebergs.Owner(orderID); exists {
+		s.cancelIceberg(w, r, icebergID)
+		return
+	}
+
+	if _, exists := s.ordersClient.GetOrderStatus(orderID); !exists {
+		s.cancelTriggerOrder(w, r, orderID)
+		return
+	}
+
+	order, exists := s.visibleOrder(r, orderID)
 	if !exists {
 		s.writeError(w, "Order not found", http.StatusNotFound)
 		return
 	}
 
-	if err := s.ordersClient.CancelOrder(orderID, order.Symbol, order.Side); err != nil {
-		s.writeError(w, fmt.Sprintf("Failed to cancel order: %v", err), http.StatusInternalServerError)
+	cancelClOrdID, err := s.ordersClient.CancelOrder(orderID)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to cancel order: %v", err), orderErrorStatus(err))
 		return
 	}
 
-	s.writeSuccess(w, "Order cancel request sent")
+	s.writeSuccess(w, map[string]string{"order_id": order.Handle, "cancel_cl_ord_id": cancelClOrdID})
 }
 
 func (s *Server) replaceOrderHandler(w http.ResponseWriter, r *http.Request) {
@@ -67,13 +97,26 @@ func (s *Server) replaceOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	/* on an iceberg slice, price and order_qty amend the whole iceberg */
+	if icebergID, exists := s.icebergs.Owner(origOrderID); exists {
+		s.replaceIceberg(w, r, icebergID, IcebergReplaceRequest{Price: req.Price, TotalQty: req.OrderQty})
+		return
+	}
+
 	if err := s.validateOrderRequest(&req); err != nil {
 		s.writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if req.ClOrdID == "" {
+		req.ClOrdID = s.ordersClient.NextReplaceClOrdID()
+	} else if _, err := s.resolveClOrdID(req.ClOrdID); err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	newOrderInfo := &orders.OrderInfo{
-		ClOrdID:     generateOrderID(),
+		ClOrdID:     req.ClOrdID,
 		Symbol:      req.Symbol,
 		Side:        req.Side,
 		OrderQty:    req.OrderQty,
@@ -82,20 +125,59 @@ func (s *Server) replaceOrderHandler(w http.ResponseWriter, r *http.Request) {
 		TimeInForce: req.TimeInForce,
 	}
 
+	order, exists := s.visibleOrder(r, origOrderID)
+	if !exists {
+		s.writeError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
 	if err := s.ordersClient.ReplaceOrder(origOrderID, newOrderInfo); err != nil {
-		s.writeError(w, fmt.Sprintf("Failed to replace order: %v", err), http.StatusInternalServerError)
+		s.writeError(w, fmt.Sprintf("Failed to replace order: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, map[string]string{"order_id": order.Handle, "new_order_id": newOrderInfo.ClOrdID})
+}
+
+func (s *Server) refreshOrderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["orderId"]
+
+	if _, exists := s.visibleOrder(r, orderID); !exists {
+		s.writeError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := s.ordersClient.RequestOrderStatus(orderID, 10*time.Second)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to refresh order: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	order, _ := s.ordersClient.GetOrderStatus(orderID)
+	s.writeSuccess(w, map[string]interface{}{"order": order, "reconciliation": report})
+}
+
+func (s *Server) reconcileOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := s.ordersClient.ReconcileOpenOrders(30 * time.Second)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to reconcile orders: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	s.writeSuccess(w, map[string]string{"new_order_id": newOrderInfo.ClOrdID})
+	s.writeSuccess(w, report)
 }
 
 func (s *Server) getOrderHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID := vars["orderId"]
 
-	order, exists := s.ordersClient.GetOrderStatus(orderID)
+	order, exists := s.visibleOrder(r, orderID)
 	if !exists {
+		if trigger, exists := s.visibleTrigger(r, orderID); exists {
+			s.writeSuccess(w, trigger)
+			return
+		}
 		s.writeError(w, "Order not found", http.StatusNotFound)
 		return
 	}
@@ -103,15 +185,31 @@ func (s *Server) getOrderHandler(w http.ResponseWriter, r *http.Request) {
 	s.writeSuccess(w, order)
 }
 
-func (s *Server) getAllOrdersHandler(w http.ResponseWriter, r *http.Request) {
-	orders := s.ordersClient.GetAllOrders()
-	s.writeSuccess(w, orders)
+func (s *Server) listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, nextCursor, err := s.ordersClient.ListOrders(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: orders, NextCursor: nextCursor})
 }
 
 func (s *Server) getOrderExecutionsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID := vars["orderId"]
 
+	if _, exists := s.visibleOrder(r, orderID); !exists {
+		s.writeError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
 	executions, exists := s.ordersClient.GetOrderExecutions(orderID)
 	if !exists {
 		s.writeError(w, "Order not found", http.StatusNotFound)
@@ -121,9 +219,59 @@ func (s *Server) getOrderExecutionsHandler(w http.ResponseWriter, r *http.Reques
 	s.writeSuccess(w, executions)
 }
 
-func (s *Server) getAllExecutionsHandler(w http.ResponseWriter, r *http.Request) {
-	executions := s.ordersClient.GetAllExecutions()
-	s.writeSuccess(w, executions)
+func (s *Server) listExecutionsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	executions, nextCursor, err := s.ordersClient.ListExecutions(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: executions, NextCursor: nextCursor})
+}
+
+func orderErrorStatus(err error) int {
+	var rejection *risk.Rejection
+
+	switch {
+	case errors.Is(err, orders.ErrOrderNotFound), errors.Is(err, triggers.ErrTriggerNotFound), errors.Is(err, orders.ErrQuoteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, orders.ErrOrderNotOpen), errors.Is(err, orders.ErrPendingRequest), errors.Is(err, orders.ErrDuplicateClOrdID), errors.Is(err, triggers.ErrTriggerNotWaiting),
+		errors.Is(err, orders.ErrQuoteNotActive), errors.Is(err, orders.ErrQuoteExpired):
+		return http.StatusConflict
+	case errors.Is(err, orders.ErrTradingHalted):
+		return http.StatusLocked
+	case errors.Is(err, ratelimit.ErrThrottled):
+		return http.StatusTooManyRequests
+	case errors.As(err, &rejection):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) resolveClOrdID(clientClOrdID string) (string, error) {
+	if clientClOrdID == "" {
+		return s.ordersClient.NextClOrdID(), nil
+	}
+
+	if err := idgen.ValidateClientID(clientClOrdID); err != nil {
+		return "", err
+	}
+
+	if _, exists := s.ordersClient.GetOrderStatus(clientClOrdID); exists {
+		return "", fmt.Errorf("cl_ord_id %s is already in use", clientClOrdID)
+	}
+	if _, exists := s.triggers.Get(clientClOrdID); exists {
+		return "", fmt.Errorf("cl_ord_id %s is already in use", clientClOrdID)
+	}
+
+	return clientClOrdID, nil
 }
 
 func (s *Server) validateOrderRequest(req *OrderRequest) error {
@@ -148,7 +296,3 @@ func (s *Server) validateOrderRequest(req *OrderRequest) error {
 
 	return nil
 }
-
-func generateOrderID() string {
-	return fmt.Sprintf("ord-%d", time.Now().UnixNano())
-}
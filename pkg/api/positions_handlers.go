@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+)
+
+func (s *Server) getPositionsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, s.positions.Positions(r.URL.Query().Get("currency"), positionsClient(r)))
+}
+
+func (s *Server) getPnLHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, s.positions.PnL(r.URL.Query().Get("currency"), positionsClient(r)))
+}
+
+/* admins see the whole book unless they ask for one client */
+func positionsClient(r *http.Request) string {
+	if caller := callerFrom(r); !caller.IsAdmin() {
+		return caller.ID
+	}
+	return r.URL.Query().Get("client_id")
+}
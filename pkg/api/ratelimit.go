@@ -0,0 +1,56 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
+)
+
+const (
+	RateClassOrders     = "orders"
+	RateClassMarketData = "marketdata"
+	RateClassQuery      = "query"
+	RateClassAdmin      = "admin"
+)
+
+/* requests that can send FIX messages get the tighter order and market data classes */
+func rateClass(scope, method string) string {
+	switch {
+	case scope == auth.ScopeAdmin:
+		return RateClassAdmin
+	case scope == auth.ScopeReadQuotes:
+		return RateClassMarketData
+	case method == http.MethodGet:
+		return RateClassQuery
+	default:
+		return RateClassOrders
+	}
+}
+
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, clientID, class string) bool {
+	retryAfter, ok := s.limiter.Allow(clientID, class)
+	if ok {
+		return true
+	}
+
+	metrics.RateLimited.WithLabelValues(class).Inc()
+	logger.Warn("RateLimited", logging.KeyClientID, clientID, "class", class, "limit", s.limiter.Limits()[class].String(), "method", r.Method, "path", r.URL.Path)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	s.writeError(w, "Rate limit exceeded for "+class+" requests, retry after "+retryAfter.Round(time.Millisecond).String(), http.StatusTooManyRequests)
+	return false
+}
+
+func (s *Server) getRateLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, map[string]interface{}{
+		"limits":               s.limiter.Limits(),
+		"clients":              s.limiter.Stats(),
+		"orders_throttle":      s.ordersClient.ThrottleStats(),
+		"market_data_throttle": s.mdClient.ThrottleStats(),
+	})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRFQTimeout = 5 * time.Second
+	/* each waiting request holds an API goroutine and a handler slot */
+	maxRFQTimeout = 30 * time.Second
+)
+
+func (s *Server) requestQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	var req RFQRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Symbol == "" {
+		s.writeError(w, "symbol is required", http.StatusBadRequest)
+		return
+	}
+	if req.Side != "1" && req.Side != "2" {
+		s.writeError(w, "side must be '1' (Buy) or '2' (Sell)", http.StatusBadRequest)
+		return
+	}
+	if req.OrderQty <= 0 {
+		s.writeError(w, "order_qty must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if req.TimeoutMs < 0 || int64(req.TimeoutMs) > maxRFQTimeout.Milliseconds() {
+		s.writeError(w, fmt.Sprintf("timeout_ms must be between 0 and %d", maxRFQTimeout.Milliseconds()), http.StatusBadRequest)
+		return
+	}
+
+	timeout := defaultRFQTimeout
+	if req.TimeoutMs > 0 {
+		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+	}
+
+	rfq, err := s.ordersClient.RequestQuote(callerID(r), req.Symbol, req.Side, req.OrderQty, timeout)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to request quote: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, rfq)
+}
+
+func (s *Server) acceptQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rfqID := vars["rfqId"]
+
+	var req RFQAcceptRequest
+	if err := s.decodeJSON(r, &req); err != nil && err != io.EOF {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if rfq, exists := s.ordersClient.GetRFQ(rfqID); !exists || !canAccess(r, rfq.ClientID) {
+		s.writeError(w, "Quote request not found", http.StatusNotFound)
+		return
+	}
+
+	clOrdID, err := s.resolveClOrdID(req.ClOrdID)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := s.ordersClient.AcceptQuote(rfqID, clOrdID)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to accept quote: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, map[string]interface{}{"order_id": order.ClOrdID, "quote_id": order.QuoteID, "price": order.Price})
+}
+
+func (s *Server) getRFQHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rfqID := vars["rfqId"]
+
+	rfq, exists := s.ordersClient.GetRFQ(rfqID)
+	if !exists || !canAccess(r, rfq.ClientID) {
+		s.writeError(w, "Quote request not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeSuccess(w, rfq)
+}
+
+func (s *Server) listRFQsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, nextCursor, err := s.ordersClient.ListRFQs(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: items, NextCursor: nextCursor})
+}
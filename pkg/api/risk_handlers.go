@@ -0,0 +1,19 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (s *Server) getRiskLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, s.risk.Limits())
+}
+
+func (s *Server) reloadRiskLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.risk.Reload(); err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to reload risk limits: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, s.risk.Limits())
+}
@@ -2,58 +2,190 @@ package api
 
 import (
 	"fmt"
-	"log"
 	"net/http"
+	"sync"
+	"time"
 
+	"bcb-fix-microservice/pkg/algos"
+	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/groups"
+	"bcb-fix-microservice/pkg/iceberg"
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/journal"
+	"bcb-fix-microservice/pkg/logging"
 	"bcb-fix-microservice/pkg/marketdata"
+	"bcb-fix-microservice/pkg/metrics"
 	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/positions"
+	"bcb-fix-microservice/pkg/ratelimit"
+	"bcb-fix-microservice/pkg/risk"
+	"bcb-fix-microservice/pkg/store"
+	"bcb-fix-microservice/pkg/triggers"
+	"bcb-fix-microservice/pkg/webhooks"
 	"github.com/gorilla/mux"
 )
 
+var logger = logging.Component("api")
+
+type Config struct {
+	IdempotencyWindow time.Duration
+	ReportingCurrency string
+	/* symbols kept subscribed to convert balances into the reporting currency */
+	ConversionPairs []string
+	AuthDisabled    bool
+	RateLimits      map[string]ratelimit.Limit
+}
+
+func DefaultConfig() Config {
+	return Config{
+		IdempotencyWindow: 24 * time.Hour,
+		ReportingCurrency: "USD",
+		RateLimits: map[string]ratelimit.Limit{
+			RateClassOrders:     {Rate: 5, Burst: 10},
+			RateClassMarketData: {Rate: 2, Burst: 5},
+			RateClassQuery:      {Rate: 20, Burst: 40},
+			RateClassAdmin:      {Rate: 2, Burst: 5},
+		},
+	}
+}
+
 type Server struct {
 	mdClient     *marketdata.MarketDataClient
 	ordersClient *orders.OrdersClient
+	store        *store.Store
+	webhooks     *webhooks.Dispatcher
+	keys         *auth.KeyStore
+	limiter      *ratelimit.Limiter
+	risk         *risk.Engine
+	positions    *positions.Keeper
+	triggers     *triggers.Manager
+	groups       *groups.Manager
+	algos        *algos.Engine
+	icebergs     *iceberg.Manager
+	ids          *idgen.Generator
+	journal      *journal.Journal
+	config       Config
 	router       *mux.Router
+	mu           sync.RWMutex
 	exchanges    map[string]*ExchangeResponse
+	/* order handle, or algo ID for algo exchanges, to exchange ID */
+	exchangeIndex map[string]string
+
+	idempotencyMu       sync.Mutex
+	idempotencyInFlight map[string]bool
 }
 
-func NewServer(mdClient *marketdata.MarketDataClient, ordersClient *orders.OrdersClient) *Server {
+func NewServer(mdClient *marketdata.MarketDataClient, ordersClient *orders.OrdersClient, st *store.Store, dispatcher *webhooks.Dispatcher, keys *auth.KeyStore, riskEngine *risk.Engine, triggerManager *triggers.Manager, groupManager *groups.Manager, algoEngine *algos.Engine, icebergManager *iceberg.Manager, ids *idgen.Generator, messageJournal *journal.Journal, config Config) *Server {
 	server := &Server{
-		mdClient:     mdClient,
-		ordersClient: ordersClient,
-		router:       mux.NewRouter(),
-		exchanges:    make(map[string]*ExchangeResponse),
+		mdClient:            mdClient,
+		ordersClient:        ordersClient,
+		store:               st,
+		webhooks:            dispatcher,
+		keys:                keys,
+		limiter:             ratelimit.NewLimiter(config.RateLimits),
+		risk:                riskEngine,
+		triggers:            triggerManager,
+		groups:              groupManager,
+		algos:               algoEngine,
+		icebergs:            icebergManager,
+		positions:           positions.NewKeeper(ordersClient, mdClient, config.ReportingCurrency, config.ConversionPairs),
+		ids:                 ids,
+		journal:             messageJournal,
+		config:              config,
+		router:              mux.NewRouter(),
+		exchanges:           make(map[string]*ExchangeResponse),
+		exchangeIndex:       make(map[string]string),
+		idempotencyInFlight: make(map[string]bool),
 	}
 
+	server.loadExchanges()
+	server.pruneIdempotencyRecords()
 	server.setupRoutes()
+	ordersClient.AddListener(server.onOrderEvent)
 	return server
 }
 
 func (s *Server) setupRoutes() {
+	s.router.Use(s.instrument)
+
 	s.router.HandleFunc("/health", s.healthHandler).Methods("GET")
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	s.router.HandleFunc("/api/marketdata/subscribe", s.require(auth.ScopeReadQuotes, s.subscribeMarketDataHandler)).Methods("POST")
+	s.router.HandleFunc("/api/marketdata/unsubscribe", s.require(auth.ScopeReadQuotes, s.unsubscribeMarketDataHandler)).Methods("POST")
+	s.router.HandleFunc("/api/securities", s.require(auth.ScopeReadQuotes, s.requestSecuritiesHandler)).Methods("GET")
+
+	s.router.HandleFunc("/api/quotes", s.require(auth.ScopeReadQuotes, s.getQuotesHandler)).Methods("GET")
+
+	s.router.HandleFunc("/api/exchange", s.require(auth.ScopeExchange, s.idempotent("exchange", s.createExchangeHandler))).Methods("POST")
+	s.router.HandleFunc("/api/exchange/{exchangeId}", s.require(auth.ScopeExchange, s.getExchangeStatusHandler)).Methods("GET")
+	s.router.HandleFunc("/api/exchanges", s.require(auth.ScopeExchange, s.listExchangesHandler)).Methods("GET")
+
+	s.router.HandleFunc("/api/orders", s.require(auth.ScopeTrade, s.idempotent("orders", s.createOrderHandler))).Methods("POST")
+	s.router.HandleFunc("/api/orders/reconcile", s.require(auth.ScopeAdmin, s.reconcileOrdersHandler)).Methods("POST")
+	s.router.HandleFunc("/api/orders/mass-cancel", s.require(auth.ScopeAdmin, s.massCancelHandler)).Methods("POST")
+	s.router.HandleFunc("/api/orders/triggers", s.require(auth.ScopeTrade, s.listTriggersHandler)).Methods("GET")
+	s.router.HandleFunc("/api/orders/triggers/{triggerId}", s.require(auth.ScopeTrade, s.getTriggerHandler)).Methods("GET")
+	s.router.HandleFunc("/api/orders/{orderId}/cancel", s.require(auth.ScopeTrade, s.cancelOrderHandler)).Methods("POST")
+	s.router.HandleFunc("/api/orders/{orderId}/replace", s.require(auth.ScopeTrade, s.replaceOrderHandler)).Methods("POST")
+	s.router.HandleFunc("/api/orders/{orderId}/refresh", s.require(auth.ScopeTrade, s.refreshOrderHandler)).Methods("POST")
+	s.router.HandleFunc("/api/orders/{orderId}", s.require(auth.ScopeTrade, s.getOrderHandler)).Methods("GET")
+	s.router.HandleFunc("/api/orders/{orderId}/executions", s.require(auth.ScopeTrade, s.getOrderExecutionsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/orders", s.require(auth.ScopeTrade, s.listOrdersHandler)).Methods("GET")
+	s.router.HandleFunc("/api/executions", s.require(auth.ScopeTrade, s.listExecutionsHandler)).Methods("GET")
+
+	s.router.HandleFunc("/api/order-groups", s.require(auth.ScopeTrade, s.createOrderGroupHandler)).Methods("POST")
+	s.router.HandleFunc("/api/order-groups", s.require(auth.ScopeTrade, s.listOrderGroupsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/order-groups/{groupId}", s.require(auth.ScopeTrade, s.getOrderGroupHandler)).Methods("GET")
+	s.router.HandleFunc("/api/order-groups/{groupId}/cancel", s.require(auth.ScopeTrade, s.cancelOrderGroupHandler)).Methods("POST")
+
+	s.router.HandleFunc("/api/algos", s.require(auth.ScopeTrade, s.startAlgoHandler)).Methods("POST")
+	s.router.HandleFunc("/api/algos", s.require(auth.ScopeTrade, s.listAlgosHandler)).Methods("GET")
+	s.router.HandleFunc("/api/algos/{algoId}", s.require(auth.ScopeTrade, s.getAlgoHandler)).Methods("GET")
+	s.router.HandleFunc("/api/algos/{algoId}/pause", s.require(auth.ScopeTrade, s.pauseAlgoHandler)).Methods("POST")
+	s.router.HandleFunc("/api/algos/{algoId}/resume", s.require(auth.ScopeTrade, s.resumeAlgoHandler)).Methods("POST")
+	s.router.HandleFunc("/api/algos/{algoId}/cancel", s.require(auth.ScopeTrade, s.cancelAlgoHandler)).Methods("POST")
+
+	s.router.HandleFunc("/api/icebergs", s.require(auth.ScopeTrade, s.createIcebergHandler)).Methods("POST")
+	s.router.HandleFunc("/api/icebergs", s.require(auth.ScopeTrade, s.listIcebergsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/icebergs/{icebergId}", s.require(auth.ScopeTrade, s.getIcebergHandler)).Methods("GET")
+	s.router.HandleFunc("/api/icebergs/{icebergId}/cancel", s.require(auth.ScopeTrade, s.cancelIcebergHandler)).Methods("POST")
+	s.router.HandleFunc("/api/icebergs/{icebergId}/replace", s.require(auth.ScopeTrade, s.replaceIcebergHandler)).Methods("POST")
+
+	s.router.HandleFunc("/api/rfq", s.require(auth.ScopeTrade, s.requestQuoteHandler)).Methods("POST")
+	s.router.HandleFunc("/api/rfq", s.require(auth.ScopeTrade, s.listRFQsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/rfq/{rfqId}", s.require(auth.ScopeTrade, s.getRFQHandler)).Methods("GET")
+	s.router.HandleFunc("/api/rfq/{rfqId}/accept", s.require(auth.ScopeTrade, s.idempotent("rfq_accept", s.acceptQuoteHandler))).Methods("POST")
+
+	s.router.HandleFunc("/api/killswitch", s.require(auth.ScopeAdmin, s.engageKillSwitchHandler)).Methods("POST")
+	s.router.HandleFunc("/api/killswitch", s.require(auth.ScopeAdmin, s.getKillSwitchHandler)).Methods("GET")
+	s.router.HandleFunc("/api/killswitch/rearm", s.require(auth.ScopeAdmin, s.rearmKillSwitchHandler)).Methods("POST")
+
+	s.router.HandleFunc("/api/positions", s.require(auth.ScopeTrade, s.getPositionsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/pnl", s.require(auth.ScopeTrade, s.getPnLHandler)).Methods("GET")
+
+	s.router.HandleFunc("/api/risk/limits", s.require(auth.ScopeAdmin, s.getRiskLimitsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/risk/reload", s.require(auth.ScopeAdmin, s.reloadRiskLimitsHandler)).Methods("POST")
 
-	s.router.HandleFunc("/api/marketdata/subscribe", s.subscribeMarketDataHandler).Methods("POST")
-	s.router.HandleFunc("/api/marketdata/unsubscribe", s.unsubscribeMarketDataHandler).Methods("POST")
-	s.router.HandleFunc("/api/securities", s.requestSecuritiesHandler).Methods("GET")
+	s.router.HandleFunc("/api/webhooks", s.require(auth.ScopeAdmin, s.registerWebhookHandler)).Methods("POST")
+	s.router.HandleFunc("/api/webhooks", s.require(auth.ScopeAdmin, s.listWebhooksHandler)).Methods("GET")
+	s.router.HandleFunc("/api/webhooks/dead-letters", s.require(auth.ScopeAdmin, s.listDeadLettersHandler)).Methods("GET")
+	s.router.HandleFunc("/api/webhooks/{webhookId}", s.require(auth.ScopeAdmin, s.deleteWebhookHandler)).Methods("DELETE")
 
-	s.router.HandleFunc("/api/quotes", s.getQuotesHandler).Methods("GET")
+	s.router.HandleFunc("/api/clients", s.require(auth.ScopeAdmin, s.createClientHandler)).Methods("POST")
+	s.router.HandleFunc("/api/clients", s.require(auth.ScopeAdmin, s.listClientsHandler)).Methods("GET")
+	s.router.HandleFunc("/api/clients/me", s.require("", s.whoAmIHandler)).Methods("GET")
+	s.router.HandleFunc("/api/clients/{clientId}", s.require(auth.ScopeAdmin, s.deleteClientHandler)).Methods("DELETE")
 
-	s.router.HandleFunc("/api/exchange", s.createExchangeHandler).Methods("POST")
-	s.router.HandleFunc("/api/exchange/{exchangeId}", s.getExchangeStatusHandler).Methods("GET")
+	s.router.HandleFunc("/api/audit/messages", s.require(auth.ScopeAdmin, s.listAuditMessagesHandler)).Methods("GET")
 
-	s.router.HandleFunc("/api/orders", s.createOrderHandler).Methods("POST")
-	s.router.HandleFunc("/api/orders/{orderId}/cancel", s.cancelOrderHandler).Methods("POST")
-	s.router.HandleFunc("/api/orders/{orderId}/replace", s.replaceOrderHandler).Methods("POST")
-	s.router.HandleFunc("/api/orders/{orderId}", s.getOrderHandler).Methods("GET")
-	s.router.HandleFunc("/api/orders/{orderId}/executions", s.getOrderExecutionsHandler).Methods("GET")
-	s.router.HandleFunc("/api/orders", s.getAllOrdersHandler).Methods("GET")
-	s.router.HandleFunc("/api/executions", s.getAllExecutionsHandler).Methods("GET")
+	s.router.HandleFunc("/api/ratelimits", s.require(auth.ScopeAdmin, s.getRateLimitsHandler)).Methods("GET")
 
-	s.router.HandleFunc("/api/status", s.statusHandler).Methods("GET")
+	s.router.HandleFunc("/api/status", s.require("", s.statusHandler)).Methods("GET")
 }
 
 func (s *Server) Start(port int) error {
 	addr := fmt.Sprintf(":%d", port)
-	log.Printf("Starting HTTP server on %s", addr)
+	logger.Info("HTTPServerListening", "addr", addr)
 	return http.ListenAndServe(addr, s.router)
 }
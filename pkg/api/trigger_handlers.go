@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"bcb-fix-microservice/pkg/triggers"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) createTriggerOrder(w http.ResponseWriter, r *http.Request, req *OrderRequest, clOrdID string) {
+	trigger := &triggers.Trigger{
+		ID:             clOrdID,
+		Type:           req.TriggerType,
+		Symbol:         req.Symbol,
+		Side:           req.Side,
+		OrderQty:       req.OrderQty,
+		OrdType:        req.OrdType,
+		Price:          req.Price,
+		TimeInForce:    req.TimeInForce,
+		TriggerPrice:   req.TriggerPrice,
+		TrailAmount:    req.TrailAmount,
+		TrailPercent:   req.TrailPercent,
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
+		ClientID:       callerID(r),
+	}
+
+	if err := triggers.Validate(trigger); err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.triggers.Create(trigger); err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to create trigger order: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, map[string]interface{}{"order_id": trigger.ID, "trigger": trigger})
+}
+
+func (s *Server) cancelTriggerOrder(w http.ResponseWriter, r *http.Request, id string) {
+	if _, exists := s.visibleTrigger(r, id); !exists {
+		s.writeError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	trigger, err := s.triggers.Cancel(id)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to cancel order: %v", err), orderErrorStatus(err))
+		return
+	}
+
+	s.writeSuccess(w, map[string]interface{}{"order_id": trigger.ID, "trigger": trigger})
+}
+
+func (s *Server) getTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	triggerID := vars["triggerId"]
+
+	trigger, exists := s.visibleTrigger(r, triggerID)
+	if !exists {
+		s.writeError(w, "Trigger order not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeSuccess(w, trigger)
+}
+
+func (s *Server) listTriggersHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, nextCursor, err := s.triggers.List(opts)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, ListResponse{Items: items, NextCursor: nextCursor})
+}
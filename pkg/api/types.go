@@ -1,6 +1,11 @@
 package api
 
-import "time"
+import (
+	"time"
+
+	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/orders"
+)
 
 type Response struct {
 	Success bool        `json:"success"`
@@ -8,17 +13,78 @@ type Response struct {
 	Error   string      `json:"error,omitempty"`
 }
 
+type ListResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
 type MarketDataRequest struct {
 	Symbol string `json:"symbol"`
 }
 
 type OrderRequest struct {
+	ClOrdID     string  `json:"cl_ord_id,omitempty"`
 	Symbol      string  `json:"symbol"`
 	Side        string  `json:"side"`
 	OrderQty    float64 `json:"order_qty"`
 	Price       float64 `json:"price,omitempty"`
 	OrdType     string  `json:"ord_type"`
 	TimeInForce string  `json:"time_in_force"`
+
+	TriggerType  string  `json:"trigger_type,omitempty"`
+	TriggerPrice float64 `json:"trigger_price,omitempty"`
+	TrailAmount  float64 `json:"trail_amount,omitempty"`
+	TrailPercent float64 `json:"trail_percent,omitempty"`
+}
+
+type OrderGroupRequest struct {
+	Type       string         `json:"type"`
+	Symbol     string         `json:"symbol"`
+	Legs       []OrderRequest `json:"legs,omitempty"`
+	Entry      *OrderRequest  `json:"entry,omitempty"`
+	TakeProfit *OrderRequest  `json:"take_profit,omitempty"`
+	StopLoss   *OrderRequest  `json:"stop_loss,omitempty"`
+}
+
+type AlgoRequest struct {
+	Strategy          string     `json:"strategy"`
+	Symbol            string     `json:"symbol"`
+	Side              string     `json:"side"`
+	TotalQty          float64    `json:"total_qty"`
+	StartTime         *time.Time `json:"start_time,omitempty"`
+	EndTime           *time.Time `json:"end_time,omitempty"`
+	DurationSeconds   int        `json:"duration_seconds,omitempty"`
+	SliceSeconds      int        `json:"slice_seconds"`
+	LimitPrice        float64    `json:"limit_price,omitempty"`
+	ParticipationRate float64    `json:"participation_rate,omitempty"`
+	MinChildQty       float64    `json:"min_child_qty,omitempty"`
+	VolumeProfile     []float64  `json:"volume_profile,omitempty"`
+}
+
+type IcebergRequest struct {
+	Symbol      string  `json:"symbol"`
+	Side        string  `json:"side"`
+	TotalQty    float64 `json:"total_qty"`
+	DisplayQty  float64 `json:"display_qty"`
+	Price       float64 `json:"price"`
+	TimeInForce string  `json:"time_in_force"`
+}
+
+type IcebergReplaceRequest struct {
+	Price      float64 `json:"price,omitempty"`
+	TotalQty   float64 `json:"total_qty,omitempty"`
+	DisplayQty float64 `json:"display_qty,omitempty"`
+}
+
+type RFQRequest struct {
+	Symbol    string  `json:"symbol"`
+	Side      string  `json:"side"`
+	OrderQty  float64 `json:"order_qty"`
+	TimeoutMs int     `json:"timeout_ms,omitempty"`
+}
+
+type RFQAcceptRequest struct {
+	ClOrdID string `json:"cl_ord_id,omitempty"`
 }
 
 type ExchangeRequest struct {
@@ -27,19 +93,55 @@ type ExchangeRequest struct {
 	Amount       float64 `json:"amount"`
 	Type         string  `json:"type"`
 	LimitPrice   float64 `json:"limit_price,omitempty"`
+	/* works the amount as a TWAP/VWAP parent instead of a single IOC */
+	Algo *ExchangeAlgoRequest `json:"algo,omitempty"`
+}
+
+type ExchangeAlgoRequest struct {
+	Strategy          string  `json:"strategy"`
+	DurationSeconds   int     `json:"duration_seconds"`
+	SliceSeconds      int     `json:"slice_seconds"`
+	ParticipationRate float64 `json:"participation_rate,omitempty"`
+	MinChildQty       float64 `json:"min_child_qty,omitempty"`
 }
 
 type ExchangeResponse struct {
-	ExchangeID   string    `json:"exchange_id"`
-	FromCurrency string    `json:"from_currency"`
-	ToCurrency   string    `json:"to_currency"`
-	Amount       float64   `json:"amount"`
-	Type         string    `json:"type"`
-	Status       string    `json:"status"`
-	OrderID      string    `json:"order_id"`
-	Symbol       string    `json:"symbol"`
-	Side         string    `json:"side"`
-	CreatedAt    time.Time `json:"created_at"`
+	ExchangeID     string    `json:"exchange_id"`
+	FromCurrency   string    `json:"from_currency"`
+	ToCurrency     string    `json:"to_currency"`
+	Amount         float64   `json:"amount"`
+	Type           string    `json:"type"`
+	Status         string    `json:"status"`
+	OrderID        string    `json:"order_id,omitempty"`
+	AlgoID         string    `json:"algo_id,omitempty"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	IdempotencyKey string    `json:"idempotency_key,omitempty"`
+	ClientID       string    `json:"client_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type KillSwitchRequest struct {
+	Reason string `json:"reason"`
+}
+
+type KillSwitchResponse struct {
+	State      orders.KillSwitchState   `json:"state"`
+	MassCancel *orders.MassCancelResult `json:"mass_cancel,omitempty"`
+	/* running algos paused so that they do not resume trading on Rearm */
+	PausedAlgos int    `json:"paused_algos,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type WebhookRequest struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret,omitempty"`
+	ExchangeID string `json:"exchange_id,omitempty"`
+}
+
+type ExchangeEvent struct {
+	Exchange       ExchangeResponse `json:"exchange"`
+	PreviousStatus string           `json:"previous_status"`
 }
 
 type StatusResponse struct {
@@ -53,3 +155,14 @@ type StatusResponse struct {
 	OrdersDetails       map[string]interface{} `json:"orders_details"`
 	Timestamp           time.Time              `json:"timestamp"`
 }
+
+type APIClientRequest struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIClientResponse struct {
+	Client *auth.Client `json:"client"`
+	APIKey string       `json:"api_key"`
+}
@@ -2,8 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
+
+	"bcb-fix-microservice/pkg/store"
 )
 
 func (s *Server) writeSuccess(w http.ResponseWriter, data interface{}) {
@@ -21,6 +25,58 @@ func (s *Server) decodeJSON(r *http.Request, v interface{}) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
 
+func parseListOptions(r *http.Request) (store.ListOptions, error) {
+	query := r.URL.Query()
+
+	opts := store.ListOptions{
+		Symbol: query.Get("symbol"),
+		Side:   query.Get("side"),
+		Status: query.Get("status"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return opts, fmt.Errorf("from must be an RFC3339 timestamp")
+		}
+		opts.From = t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return opts, fmt.Errorf("to must be an RFC3339 timestamp")
+		}
+		opts.To = t
+	}
+
+	switch query.Get("sort") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fmt.Errorf("sort must be 'asc' or 'desc'")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.Limit = n
+	}
+
+	/* non-admin clients only ever see their own records */
+	if caller := callerFrom(r); !caller.IsAdmin() {
+		opts.ClientID = caller.ID
+	} else {
+		opts.ClientID = query.Get("client_id")
+	}
+
+	return opts, nil
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(Response{Success: true, Data: "OK"})
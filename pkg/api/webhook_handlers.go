@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"bcb-fix-microservice/pkg/orders"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) registerWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExchangeID != "" {
+		s.mu.RLock()
+		_, exists := s.exchanges[req.ExchangeID]
+		s.mu.RUnlock()
+
+		if !exists {
+			s.writeError(w, "Exchange operation not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	webhook, err := s.webhooks.Register(req.URL, req.Secret, req.ExchangeID)
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to register webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.writeSuccess(w, webhook)
+}
+
+func (s *Server) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSuccess(w, s.webhooks.List())
+}
+
+func (s *Server) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["webhookId"]
+
+	if !s.webhooks.Unregister(webhookID) {
+		s.writeError(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeSuccess(w, "Webhook deleted")
+}
+
+func (s *Server) listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	letters, err := s.webhooks.DeadLetters()
+	if err != nil {
+		s.writeError(w, fmt.Sprintf("Failed to load dead letters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeSuccess(w, letters)
+}
+
+func (s *Server) onOrderEvent(event orders.OrderEvent) {
+	s.mu.Lock()
+	var exchangeID string
+	var exchangeEvent *ExchangeEvent
+	if exchange := s.findExchangeByOrder(event.Order.Handle); exchange != nil {
+		exchangeID = exchange.ExchangeID
+		if previousStatus, changed := s.refreshExchangeStatus(exchange); changed {
+			exchangeEvent = &ExchangeEvent{Exchange: *exchange, PreviousStatus: previousStatus}
+		}
+	}
+	s.mu.Unlock()
+
+	s.webhooks.Publish(event.Type, exchangeID, event.Order.Handle, event)
+
+	if exchangeEvent != nil {
+		s.webhooks.Publish("exchange.status_changed", exchangeID, event.Order.Handle, exchangeEvent)
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/store"
+)
+
+var logger = logging.Component("auth")
+
+const (
+	ScopeReadQuotes = "read-quotes"
+	ScopeTrade      = "trade"
+	ScopeExchange   = "exchange"
+	ScopeAdmin      = "admin"
+
+	clientsBucket = "api_clients"
+)
+
+var (
+	ErrClientNotFound = errors.New("api client not found")
+	ErrClientReadOnly = errors.New("api client is defined in the key file")
+)
+
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var validScopes = map[string]bool{ScopeReadQuotes: true, ScopeTrade: true, ScopeExchange: true, ScopeAdmin: true}
+
+// Client is an API consumer. Only the SHA-256 of its key is kept; keys are
+// random 256-bit values, so a plain digest is sufficient.
+type Client struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	KeyHash   string    `json:"key_hash,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source"`
+}
+
+// HasScope reports whether the client may use scope. Admin implies every
+// other scope.
+func (c *Client) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) IsAdmin() bool {
+	return c.HasScope(ScopeAdmin)
+}
+
+type keyFile struct {
+	Clients []*Client `json:"clients"`
+}
+
+// KeyStore authenticates API keys against clients from a JSON key file and
+// from the persistent store. File clients cannot be changed through the API.
+type KeyStore struct {
+	store   *store.Store
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+func NewKeyStore(path string, st *store.Store) (*KeyStore, error) {
+	ks := &KeyStore{
+		store:   st,
+		clients: make(map[string]*Client),
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			logger.Warn("APIKeyFileMissing", "path", path)
+		case err != nil:
+			return nil, err
+		default:
+			var file keyFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			for _, client := range file.Clients {
+				if err := validateClient(client); err != nil {
+					return nil, fmt.Errorf("%s: client %q: %w", path, client.ID, err)
+				}
+				client.Source = "file"
+				ks.clients[client.ID] = client
+			}
+		}
+	}
+
+	stored, err := store.LoadAll[Client](st, clientsBucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range stored {
+		if _, exists := ks.clients[client.ID]; exists {
+			logger.Warn("APIClientDuplicate", logging.KeyClientID, client.ID, "using", "key file")
+			continue
+		}
+		client.Source = "store"
+		ks.clients[client.ID] = client
+	}
+
+	logger.Info("APIClientsLoaded", "clients", len(ks.clients))
+	return ks, nil
+}
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ks *KeyStore) Authenticate(key string) (*Client, bool) {
+	if key == "" {
+		return nil, false
+	}
+	hash := []byte(HashKey(key))
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var match *Client
+	for _, client := range ks.clients {
+		if subtle.ConstantTimeCompare(hash, []byte(client.KeyHash)) == 1 {
+			match = client
+		}
+	}
+	if match == nil || match.Disabled {
+		return nil, false
+	}
+
+	copied := *match
+	return &copied, true
+}
+
+// Create registers a client in the store and returns it with its key. The key
+// is not kept and cannot be shown again.
+func (ks *KeyStore) Create(id, name string, scopes []string) (*Client, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	key := hex.EncodeToString(raw)
+
+	client := &Client{
+		ID:        id,
+		Name:      name,
+		KeyHash:   HashKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		Source:    "store",
+	}
+	if err := validateClient(client); err != nil {
+		return nil, "", err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, exists := ks.clients[id]; exists {
+		return nil, "", fmt.Errorf("api client %s already exists", id)
+	}
+	if err := ks.store.Put(clientsBucket, id, client); err != nil {
+		return nil, "", err
+	}
+	ks.clients[id] = client
+
+	logger.Info("APIClientCreated", logging.KeyClientID, id, "scopes", scopes)
+	copied := *client
+	return &copied, key, nil
+}
+
+func (ks *KeyStore) Delete(id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	client, exists := ks.clients[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, id)
+	}
+	if client.Source == "file" {
+		return fmt.Errorf("%w: %s", ErrClientReadOnly, id)
+	}
+
+	if err := ks.store.Delete(clientsBucket, id); err != nil {
+		return err
+	}
+	delete(ks.clients, id)
+
+	logger.Info("APIClientDeleted", logging.KeyClientID, id)
+	return nil
+}
+
+// List returns all clients with their key hashes removed.
+func (ks *KeyStore) List() []*Client {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(ks.clients))
+	for _, client := range ks.clients {
+		copied := *client
+		copied.KeyHash = ""
+		clients = append(clients, &copied)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+func (ks *KeyStore) Empty() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return len(ks.clients) == 0
+}
+
+func validateClient(client *Client) error {
+	if !clientIDPattern.MatchString(client.ID) {
+		return errors.New("id must be 1-64 letters, digits, '.', '_' or '-'")
+	}
+	if len(client.KeyHash) != sha256.Size*2 {
+		return errors.New("key_hash must be a hex SHA-256 digest")
+	}
+	if len(client.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range client.Scopes {
+		if !validScopes[scope] {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
@@ -1,89 +1,144 @@
 package bcb
 
 import (
-	"log"
+	"log/slog"
 	"time"
 
 	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/journal"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
+	"bcb-fix-microservice/pkg/ratelimit"
 	"github.com/quickfixgo/quickfix"
 	"github.com/quickfixgo/tag"
 )
 
 type BCBApplication struct {
+	name      string
+	logger    *slog.Logger
 	sessionID quickfix.SessionID
 	connected bool
 	loggedIn  bool
 	initiator *quickfix.Initiator
+	throttle  *ratelimit.Throttle
+	fixLog    logging.FIXLogConfig
+	journal   *journal.Journal
 }
 
-func NewBCBApplication() *BCBApplication {
+// NewBCBApplication creates the shared session handling for one FIX session.
+// name labels the session in metrics, e.g. "orders" or "marketdata".
+func NewBCBApplication(name string) *BCBApplication {
+	metrics.SessionState.WithLabelValues(name).Set(metrics.SessionDisconnected)
+
 	return &BCBApplication{
+		name:      name,
+		logger:    logging.Component("bcb").With("session", name),
 		connected: false,
 		loggedIn:  false,
+		throttle:  ratelimit.NewThrottle(ratelimit.DefaultThrottleConfig()),
+		fixLog:    logging.DefaultFIXLogConfig(),
 	}
 }
 
 func (app *BCBApplication) OnCreate(sessionID quickfix.SessionID) {
 	app.sessionID = sessionID
 	app.connected = true
-	log.Printf("[EVENT (SessionCreated)]: %s", sessionID)
+	metrics.SessionState.WithLabelValues(app.name).Set(metrics.SessionConnected)
+	app.logger.Info("SessionCreated", logging.KeySessionID, sessionID.String())
 }
 
 func (app *BCBApplication) OnLogon(sessionID quickfix.SessionID) {
 	app.loggedIn = true
-	log.Printf("[EVENT (LogonSuccess)]: %s", sessionID)
+	metrics.SessionState.WithLabelValues(app.name).Set(metrics.SessionLoggedOn)
+	metrics.Logons.WithLabelValues(app.name).Inc()
+	app.logger.Info("LogonSuccess", logging.KeySessionID, sessionID.String())
 }
 
 func (app *BCBApplication) OnLogout(sessionID quickfix.SessionID) {
+	/* quickfix also calls OnLogout when a logon attempt is dropped before completing */
+	if app.loggedIn {
+		metrics.Logouts.WithLabelValues(app.name).Inc()
+	} else {
+		metrics.LogonFailures.WithLabelValues(app.name).Inc()
+	}
+	metrics.SessionState.WithLabelValues(app.name).Set(metrics.SessionDisconnected)
+
 	app.loggedIn = false
 	app.connected = false
-	log.Printf("[EVENT (Logout)]: %s", sessionID)
+	app.logger.Info("Logout", logging.KeySessionID, sessionID.String())
 }
 
 func (app *BCBApplication) OnLogonError(sessionID quickfix.SessionID, err error) {
+	metrics.LogonFailures.WithLabelValues(app.name).Inc()
+	metrics.SessionState.WithLabelValues(app.name).Set(metrics.SessionDisconnected)
+
 	app.loggedIn = false
 	app.connected = false
-	log.Printf("[EVENT (LogonError)]: %s - %v", sessionID, err)
+	app.logger.Error("LogonError", logging.KeySessionID, sessionID.String(), logging.Err(err))
 }
 
 func (app *BCBApplication) ToAdmin(message *quickfix.Message, sessionID quickfix.SessionID) {
 	msgType, _ := message.Header.GetString(tag.MsgType)
+	metrics.Messages.WithLabelValues(app.name, "out", msgType).Inc()
 
 	switch msgType {
 	case "A":
-		log.Printf("[SEND (LogonRequest)]: %s", sessionID)
+		app.logger.Info("LogonRequest", logging.KeyDirection, logging.DirOut, logging.KeySessionID, sessionID.String())
 
 		message.Body.SetInt(tag.HeartBtInt, 30)
 		message.Body.SetBool(tag.ResetSeqNumFlag, true)
 		message.Header.SetString(tag.SendingTime, time.Now().UTC().Format("20060102-15:04:05.000"))
 
 		if err := auth.SignLogonMessage(message, sessionID); err != nil {
-			log.Printf("[ERROR (LogonSigning)]: %v", err)
+			app.logger.Error("LogonSigning", logging.KeySessionID, sessionID.String(), logging.Err(err))
 			return
 		}
 
-		log.Printf("[SEND (LogonRequestSent)]: %s", sessionID)
+		app.logger.Debug("LogonRequestSigned", logging.KeySessionID, sessionID.String())
 	default:
 	}
 }
 
 func (app *BCBApplication) FromAdmin(message *quickfix.Message, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	headerMsgType, _ := message.Header.GetString(tag.MsgType)
+	app.RecordInbound(headerMsgType)
+
+	if headerMsgType == "3" {
+		reason, _ := message.Body.GetString(tag.SessionRejectReason)
+		metrics.Rejects.WithLabelValues("session", reason).Inc()
+	}
+
 	msgType, _ := message.Body.GetString(tag.MsgType)
 
 	switch msgType {
 	case "A":
-		log.Printf("[RECEIVE (LogonResponse)]: %s", sessionID)
+		app.logger.Info("LogonResponse", logging.KeyDirection, logging.DirIn, logging.KeySessionID, sessionID.String())
 	case "5":
-		log.Printf("[RECEIVE (Logout)]: %s", sessionID)
+		app.logger.Info("Logout", logging.KeyDirection, logging.DirIn, logging.KeySessionID, sessionID.String())
 	}
 
 	return nil
 }
 
 func (app *BCBApplication) ToApp(message *quickfix.Message, sessionID quickfix.SessionID) error {
+	msgType, _ := message.Header.GetString(tag.MsgType)
+	metrics.Messages.WithLabelValues(app.name, "out", msgType).Inc()
+	app.journal.Record(logging.DirOut, message, sessionID)
 	return nil
 }
 
+// RecordInbound counts a received message. Clients that override FromApp call
+// it before dispatching.
+func (app *BCBApplication) RecordInbound(msgType string) {
+	metrics.Messages.WithLabelValues(app.name, "in", msgType).Inc()
+}
+
+// JournalInbound journals a received application message. Clients that
+// override FromApp call it before dispatching.
+func (app *BCBApplication) JournalInbound(message *quickfix.Message, sessionID quickfix.SessionID) {
+	app.journal.Record(logging.DirIn, message, sessionID)
+}
+
 func (app *BCBApplication) FromApp(message *quickfix.Message, sessionID quickfix.SessionID) quickfix.MessageRejectError {
 	msgType, _ := message.Body.GetString(tag.MsgType)
 
@@ -101,7 +156,7 @@ func (app *BCBApplication) FromApp(message *quickfix.Message, sessionID quickfix
 
 func (app *BCBApplication) handleMarketDataSnapshot(message *quickfix.Message, sessionID quickfix.SessionID) {
 	symbol, _ := message.Body.GetString(tag.Symbol)
-	log.Printf("[RECEIVE (MarketDataSnapshot)]: %s from %s", symbol, sessionID)
+	app.logger.Info("MarketDataSnapshot", logging.KeyDirection, logging.DirIn, logging.KeySessionID, sessionID.String(), logging.KeySymbol, symbol)
 
 	// TODO: market data
 }
@@ -109,13 +164,13 @@ func (app *BCBApplication) handleMarketDataSnapshot(message *quickfix.Message, s
 func (app *BCBApplication) handleExecutionReport(message *quickfix.Message, sessionID quickfix.SessionID) {
 	execType, _ := message.Body.GetString(tag.ExecType)
 	ordStatus, _ := message.Body.GetString(tag.OrdStatus)
-	log.Printf("[RECEIVE (ExecutionReport)]: ExecType=%s, OrdStatus=%s from %s", execType, ordStatus, sessionID)
+	app.logger.Info("ExecutionReport", logging.KeyDirection, logging.DirIn, logging.KeySessionID, sessionID.String(), "exec_type", execType, "ord_status", ordStatus)
 
 	// TODO: execution reports
 }
 
 func (app *BCBApplication) handleSecurityList(message *quickfix.Message, sessionID quickfix.SessionID) {
-	log.Printf("[RECEIVE (SecurityList)]: %s", sessionID)
+	app.logger.Info("SecurityList", logging.KeyDirection, logging.DirIn, logging.KeySessionID, sessionID.String())
 
 	// TODO: security list
 }
@@ -150,6 +205,47 @@ func (app *BCBApplication) SetInitiator(initiator *quickfix.Initiator) {
 	app.initiator = initiator
 }
 
+func (app *BCBApplication) SetThrottle(config ratelimit.ThrottleConfig) {
+	app.throttle = ratelimit.NewThrottle(config)
+}
+
+func (app *BCBApplication) ThrottleStats() ratelimit.ThrottleStats {
+	return app.throttle.Stats()
+}
+
+/* must be called before Start; the log factory is built when the initiator is created */
+func (app *BCBApplication) SetFIXLog(config logging.FIXLogConfig) {
+	app.fixLog = config
+}
+
+/* the journal is shared between sessions; a nil journal records nothing */
+func (app *BCBApplication) SetJournal(j *journal.Journal) {
+	app.journal = j
+}
+
+func (app *BCBApplication) LogFactory() *logging.DebugLogFactory {
+	return logging.NewDebugLogFactory(app.name, app.fixLog)
+}
+
+// Send passes an application message through the outbound throttle and sends
+// it on the current session. Cancels queue even when the throttle rejects.
+func (app *BCBApplication) Send(message *quickfix.Message) error {
+	msgType, _ := message.Header.GetString(tag.MsgType)
+	urgent := msgType == "F" || msgType == "q"
+
+	waited, err := app.throttle.Wait(urgent)
+	if waited > 0 {
+		metrics.ThrottledMessages.WithLabelValues(app.name, "queued").Inc()
+	}
+	if err != nil {
+		metrics.ThrottledMessages.WithLabelValues(app.name, "rejected").Inc()
+		app.logger.Warn("FIXThrottled", logging.KeySessionID, app.sessionID.String(), logging.KeyMsgType, msgType, logging.Err(err))
+		return err
+	}
+
+	return quickfix.SendToTarget(message, app.GetSessionID())
+}
+
 func (app *BCBApplication) GetConnectionStatus() map[string]interface{} {
 	sessionID := app.GetSessionID()
 
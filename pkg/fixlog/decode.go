@@ -0,0 +1,123 @@
+package fixlog
+
+import (
+	"fmt"
+
+	"github.com/quickfixgo/quickfix/datadictionary"
+)
+
+// Message is a decoded FIX message. Fields are in wire order with repeating
+// groups nested under their NumInGroup field.
+type Message struct {
+	MsgType string     `json:"msg_type"`
+	Name    string     `json:"name,omitempty"`
+	Fields  []Field    `json:"fields"`
+	Raw     []RawField `json:"-"`
+}
+
+type Field struct {
+	Tag    int       `json:"tag"`
+	Name   string    `json:"name,omitempty"`
+	Value  string    `json:"value"`
+	Enum   string    `json:"enum,omitempty"`
+	Groups [][]Field `json:"groups,omitempty"`
+}
+
+// Decode splits and decodes a raw message.
+func (d *Dictionary) Decode(text string) (*Message, error) {
+	raw, err := d.Split(text)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Message{Raw: raw}
+	for _, field := range raw {
+		if field.Tag == 35 {
+			message.MsgType = field.Value
+			break
+		}
+	}
+	if message.MsgType == "" {
+		return nil, fmt.Errorf("%w: no MsgType", ErrMalformed)
+	}
+	message.Name = d.MessageName(message.MsgType)
+
+	scope := d.fields(message.MsgType)
+	for i := 0; i < len(raw); {
+		field := d.field(raw[i])
+		i++
+
+		if def, exists := scope[field.Tag]; exists && def.IsGroup() {
+			field.Groups, i = d.decodeGroup(raw, i, def)
+		}
+		message.Fields = append(message.Fields, field)
+	}
+	return message, nil
+}
+
+/* decodeGroup reads the instances that follow a NumInGroup field starting at raw[i] */
+func (d *Dictionary) decodeGroup(raw []RawField, i int, def *datadictionary.FieldDef) ([][]Field, int) {
+	scope := make(map[int]*datadictionary.FieldDef, len(def.Fields))
+	for _, child := range def.Fields {
+		scope[child.Tag()] = child
+	}
+
+	/* instances start with whichever member tag comes first, counterparties do not always follow the spec order */
+	if i >= len(raw) {
+		return nil, i
+	}
+	if _, exists := scope[raw[i].Tag]; !exists {
+		return nil, i
+	}
+	delimiter := raw[i].Tag
+
+	var instances [][]Field
+	for i < len(raw) && raw[i].Tag == delimiter {
+		var instance []Field
+		for i < len(raw) {
+			child, exists := scope[raw[i].Tag]
+			if !exists || (raw[i].Tag == delimiter && len(instance) > 0) {
+				break
+			}
+
+			field := d.field(raw[i])
+			i++
+			if child.IsGroup() {
+				field.Groups, i = d.decodeGroup(raw, i, child)
+			}
+			instance = append(instance, field)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, i
+}
+
+func (d *Dictionary) field(raw RawField) Field {
+	return Field{
+		Tag:   raw.Tag,
+		Name:  d.FieldName(raw.Tag),
+		Value: raw.Value,
+		Enum:  d.EnumName(raw.Tag, raw.Value),
+	}
+}
+
+// Get returns the first top level value of tag.
+func (m *Message) Get(tag int) (string, bool) {
+	for _, field := range m.Fields {
+		if field.Tag == tag {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns every value of tag, including those inside repeating groups.
+func (m *Message) Values(tag int) []string {
+	var values []string
+	for _, field := range m.Raw {
+		if field.Tag == tag {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,214 @@
+package fixlog
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+
+	"github.com/quickfixgo/quickfix/datadictionary"
+)
+
+/* FIX44.xml is the dictionary shipped with quickfix v0.9.10 */
+//go:embed FIX44.xml
+var fix44 []byte
+
+// CustomField is a tag BCB sends that is not part of FIX 4.4. MsgTypes lists
+// the messages it appears in; Group, when set, is the NumInGroup tag of the
+// repeating group that carries it.
+type CustomField struct {
+	Tag      int
+	Name     string
+	Type     string
+	MsgTypes []string
+	Group    int
+	Enums    map[string]string
+}
+
+// CustomFields are the BCB extensions seen on our sessions. 1070, 969 and
+// 1140 are borrowed from FIX 5.0; 20030 is BCB's own and is sent as Y on
+// every NewOrderSingle.
+var CustomFields = []CustomField{
+	{
+		Tag:      20030,
+		Name:     "BCBOrderFlag",
+		Type:     "BOOLEAN",
+		MsgTypes: []string{"D"},
+		Enums:    map[string]string{"Y": "YES", "N": "NO"},
+	},
+	{
+		Tag:      1070,
+		Name:     "MDQuoteType",
+		Type:     "INT",
+		MsgTypes: []string{"V", "W"},
+		Enums: map[string]string{
+			"0": "INDICATIVE",
+			"1": "TRADEABLE",
+			"2": "RESTRICTED_TRADEABLE",
+			"3": "COUNTER",
+			"4": "INDICATIVE_AND_TRADEABLE",
+		},
+	},
+	{
+		Tag:      969,
+		Name:     "MinPriceIncrement",
+		Type:     "FLOAT",
+		MsgTypes: []string{"y"},
+		Group:    146,
+	},
+	{
+		Tag:      1140,
+		Name:     "MaxTradeVol",
+		Type:     "QTY",
+		MsgTypes: []string{"y"},
+		Group:    146,
+	},
+}
+
+// Dictionary names tags and enum values and knows the repeating group layout
+// of each message type.
+type Dictionary struct {
+	dd *datadictionary.DataDictionary
+}
+
+// LoadDictionary parses the FIX 4.4 dictionary at path, or the embedded copy
+// when path is empty, and adds CustomFields to it.
+func LoadDictionary(path string) (*Dictionary, error) {
+	var dd *datadictionary.DataDictionary
+	var err error
+
+	if path == "" {
+		dd, err = datadictionary.ParseSrc(bytes.NewReader(fix44))
+	} else {
+		dd, err = datadictionary.Parse(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load FIX dictionary: %w", err)
+	}
+
+	for _, custom := range CustomFields {
+		if err := addCustomField(dd, custom); err != nil {
+			return nil, err
+		}
+	}
+	return &Dictionary{dd: dd}, nil
+}
+
+func addCustomField(dd *datadictionary.DataDictionary, custom CustomField) error {
+	fieldType := datadictionary.NewFieldType(custom.Name, custom.Tag, custom.Type)
+	if len(custom.Enums) > 0 {
+		fieldType.Enums = make(map[string]datadictionary.Enum, len(custom.Enums))
+		for value, description := range custom.Enums {
+			fieldType.Enums[value] = datadictionary.Enum{Value: value, Description: description}
+		}
+	}
+
+	dd.FieldTypeByTag[custom.Tag] = fieldType
+	dd.FieldTypeByName[custom.Name] = fieldType
+
+	for _, msgType := range custom.MsgTypes {
+		msg, exists := dd.Messages[msgType]
+		if !exists {
+			return fmt.Errorf("custom field %d: unknown MsgType %s", custom.Tag, msgType)
+		}
+
+		fieldDef := datadictionary.NewFieldDef(fieldType, false)
+		msg.Tags.Add(custom.Tag)
+
+		if custom.Group == 0 {
+			msg.Fields[custom.Tag] = fieldDef
+			continue
+		}
+
+		group, exists := msg.Fields[custom.Group]
+		if !exists || !group.IsGroup() {
+			return fmt.Errorf("custom field %d: MsgType %s has no group %d", custom.Tag, msgType, custom.Group)
+		}
+
+		/* group definitions can be shared between messages through components */
+		if !hasChild(group, custom.Tag) {
+			group.Fields = append(group.Fields, fieldDef)
+		}
+	}
+	return nil
+}
+
+func hasChild(group *datadictionary.FieldDef, tag int) bool {
+	for _, child := range group.Fields {
+		if child.Tag() == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldName returns the dictionary name for tag, or "" when it is unknown.
+func (d *Dictionary) FieldName(tag int) string {
+	if fieldType, exists := d.dd.FieldTypeByTag[tag]; exists {
+		return fieldType.Name()
+	}
+	return ""
+}
+
+// EnumName returns the description of value for tag, or "" when the field
+// has no such enum value.
+func (d *Dictionary) EnumName(tag int, value string) string {
+	fieldType, exists := d.dd.FieldTypeByTag[tag]
+	if !exists || fieldType.Enums == nil {
+		return ""
+	}
+	return fieldType.Enums[value].Description
+}
+
+// MessageName returns the dictionary name for msgType, e.g. ExecutionReport.
+func (d *Dictionary) MessageName(msgType string) string {
+	if msg, exists := d.dd.Messages[msgType]; exists {
+		return msg.Name
+	}
+	return ""
+}
+
+// MsgTypeByName resolves a message name such as NewOrderSingle to its MsgType.
+func (d *Dictionary) MsgTypeByName(name string) (string, bool) {
+	for msgType, msg := range d.dd.Messages {
+		if msg.Name == name {
+			return msgType, true
+		}
+	}
+	return "", false
+}
+
+func (d *Dictionary) fieldType(tag int) *datadictionary.FieldType {
+	return d.dd.FieldTypeByTag[tag]
+}
+
+/* fields returns the top level field definitions of header, body and trailer for msgType */
+func (d *Dictionary) fields(msgType string) map[int]*datadictionary.FieldDef {
+	fields := make(map[int]*datadictionary.FieldDef)
+	for tag, def := range d.dd.Header.Fields {
+		fields[tag] = def
+	}
+	if msg, exists := d.dd.Messages[msgType]; exists {
+		for tag, def := range msg.Fields {
+			fields[tag] = def
+		}
+	}
+	for tag, def := range d.dd.Trailer.Fields {
+		fields[tag] = def
+	}
+	return fields
+}
+
+/* knownTag reports whether tag may appear anywhere in msgType, including nested groups */
+func (d *Dictionary) knownTag(msgType string, tag int) bool {
+	if _, exists := d.dd.Header.Tags[tag]; exists {
+		return true
+	}
+	if _, exists := d.dd.Trailer.Tags[tag]; exists {
+		return true
+	}
+	if msg, exists := d.dd.Messages[msgType]; exists {
+		_, exists = msg.Tags[tag]
+		return exists
+	}
+	return false
+}
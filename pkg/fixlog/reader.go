@@ -0,0 +1,115 @@
+// Package fixlog reads the session files written by logging.DebugLog and
+// decodes the raw FIX messages in them.
+package fixlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/* the kinds of line DebugLog writes */
+const (
+	KindIncoming = "INCOMING"
+	KindOutgoing = "OUTGOING"
+	KindEvent    = "EVENT"
+	KindError    = "ERROR"
+)
+
+/* DebugLog uses log.LstdFlags|log.Lmicroseconds */
+const timeLayout = "2006/01/02 15:04:05.000000"
+
+/* lines mirrored to stdout by older builds and pasted dumps carry no timestamp */
+var linePattern = regexp.MustCompile(`^\[([^\]]+)\] (?:(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}\.\d{6}) )?(INCOMING|OUTGOING|EVENT|ERROR): (.*)$`)
+
+// Record is one line of a DebugLog file. Text is the raw message for
+// INCOMING and OUTGOING records and the event text otherwise. Time is zero
+// when the line has no timestamp.
+type Record struct {
+	Line    int
+	Session string
+	Time    time.Time
+	Kind    string
+	Text    string
+}
+
+func (r Record) IsMessage() bool {
+	return r.Kind == KindIncoming || r.Kind == KindOutgoing
+}
+
+// ParseLine parses a single DebugLog line, reporting false for anything else.
+func ParseLine(line string) (Record, bool) {
+	line = strings.TrimRight(line, "\r\n")
+
+	match := linePattern.FindStringSubmatch(line)
+	if match == nil {
+		return Record{}, false
+	}
+
+	record := Record{Session: match[1], Kind: match[3], Text: match[4]}
+	if match[2] != "" {
+		record.Time, _ = time.ParseInLocation(timeLayout, match[2], time.Local)
+	}
+	return record, true
+}
+
+// Reader yields the DebugLog records in a stream, skipping unrelated lines.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	/* SecurityList and snapshot messages easily exceed the default 64KB token */
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next record, or io.EOF once the stream is exhausted.
+func (r *Reader) Next() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if record, ok := ParseLine(r.scanner.Text()); ok {
+			record.Line = r.line
+			return record, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// Open opens a log file, transparently decompressing rotated .gz files.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, file: file}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
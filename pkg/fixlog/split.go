@@ -0,0 +1,282 @@
+package fixlog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"bcb-fix-microservice/pkg/logging"
+)
+
+var ErrMalformed = errors.New("malformed FIX message")
+
+// RawField is one tag=value pair in wire order.
+type RawField struct {
+	Tag   int
+	Value string
+}
+
+/* a pipe is only taken as the delimiter when it is clearly separating fields */
+var pipeDelimited = regexp.MustCompile(`^8=[^|]+\|9=\d+\|35=`)
+
+// Split breaks a raw message into fields. SOH, "|" and "^A" delimiters are
+// recognised; when a dump has lost its delimiters altogether the boundaries
+// are recovered from the dictionary, see recoverFields.
+func (d *Dictionary) Split(text string) ([]RawField, error) {
+	text = strings.TrimRight(text, " \r\n")
+
+	switch {
+	case strings.Contains(text, "\x01"):
+		return splitDelimited(text, "\x01")
+	case strings.Contains(text, "^A"):
+		return splitDelimited(text, "^A")
+	case pipeDelimited.MatchString(text):
+		return splitDelimited(text, "|")
+	default:
+		return d.recoverFields(text)
+	}
+}
+
+func splitDelimited(text, delimiter string) ([]RawField, error) {
+	var fields []RawField
+	dataLen := map[int]int{}
+
+	for pos := 0; pos < len(text); {
+		end := strings.Index(text[pos:], delimiter)
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += pos
+		}
+
+		eq := strings.IndexByte(text[pos:end], '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("%w: field %q at offset %d", ErrMalformed, text[pos:end], pos)
+		}
+
+		t, err := strconv.Atoi(text[pos : pos+eq])
+		if err != nil {
+			return nil, fmt.Errorf("%w: tag %q at offset %d", ErrMalformed, text[pos:pos+eq], pos)
+		}
+
+		valueStart := pos + eq + 1
+
+		/* redacted data fields no longer match their length, so only trust it when a delimiter follows */
+		if n, ok := dataLen[t]; ok {
+			delete(dataLen, t)
+			if valueEnd := valueStart + n; valueEnd <= len(text) && (valueEnd == len(text) || strings.HasPrefix(text[valueEnd:], delimiter)) {
+				end = valueEnd
+			}
+		}
+
+		value := text[valueStart:end]
+		if dataTag, ok := logging.DataLengthTags[t]; ok {
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				dataLen[dataTag] = n
+			}
+		}
+
+		fields = append(fields, RawField{Tag: t, Value: value})
+		pos = end + len(delimiter)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: empty message", ErrMalformed)
+	}
+	return fields, nil
+}
+
+// Join renders fields back into SOH-delimited wire format.
+func Join(fields []RawField) string {
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(strconv.Itoa(field.Tag))
+		b.WriteByte('=')
+		b.WriteString(field.Value)
+		b.WriteByte('\x01')
+	}
+	return b.String()
+}
+
+/* dataFieldLength maps each data field to the length field that must precede it */
+var dataFieldLength = func() map[int]int {
+	lengths := make(map[int]int, len(logging.DataLengthTags))
+	for lengthTag, dataTag := range logging.DataLengthTags {
+		lengths[dataTag] = lengthTag
+	}
+	return lengths
+}()
+
+/* header fields that must open every message, in order */
+var leadingTags = []int{8, 9, 35}
+
+// recoverFields splits a message whose delimiters were stripped, as happens
+// when a log line is pasted into a document. It searches for the split where
+// every tag belongs to the message type and every value parses as its field
+// type, preferring the shortest value at each step. Enum values are checked
+// first and relaxed if no split satisfies them.
+func (d *Dictionary) recoverFields(text string) ([]RawField, error) {
+	for _, strict := range []bool{true, false} {
+		r := &recovery{dict: d, text: text, strict: strict, failed: map[int]bool{}}
+		if r.parse(0) {
+			return r.fields, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no delimiters and no consistent field split", ErrMalformed)
+}
+
+type recovery struct {
+	dict    *Dictionary
+	text    string
+	strict  bool
+	msgType string
+	fields  []RawField
+	/* positions known not to start a valid remainder; only valid once MsgType is fixed */
+	failed map[int]bool
+}
+
+func (r *recovery) parse(pos int) bool {
+	if pos == len(r.text) {
+		return len(r.fields) > len(leadingTags)
+	}
+
+	memo := len(r.fields) >= len(leadingTags)
+	if memo && r.failed[pos] {
+		return false
+	}
+
+	t, valueStart, ok := tagAt(r.text, pos)
+	if ok && r.allowed(t) {
+		for end := valueStart + 1; end <= len(r.text); end++ {
+			if end < len(r.text) {
+				if _, _, next := tagAt(r.text, end); !next {
+					continue
+				}
+			}
+
+			value := r.text[valueStart:end]
+			if !r.valid(t, value, end == len(r.text)) {
+				continue
+			}
+
+			previousType := r.msgType
+			if t == 35 {
+				r.msgType = value
+			}
+			r.fields = append(r.fields, RawField{Tag: t, Value: value})
+
+			if r.parse(end) {
+				return true
+			}
+
+			r.fields = r.fields[:len(r.fields)-1]
+			r.msgType = previousType
+		}
+	}
+
+	if memo {
+		r.failed[pos] = true
+	}
+	return false
+}
+
+func (r *recovery) allowed(t int) bool {
+	if index := len(r.fields); index < len(leadingTags) {
+		return t == leadingTags[index]
+	}
+	return r.dict.knownTag(r.msgType, t)
+}
+
+var (
+	intPattern       = regexp.MustCompile(`^-?\d+$`)
+	floatPattern     = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)$`)
+	timestampPattern = regexp.MustCompile(`^\d{8}-\d{2}:\d{2}:\d{2}(\.\d{1,9})?$`)
+	timePattern      = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d{1,9})?$`)
+	datePattern      = regexp.MustCompile(`^\d{8}$`)
+	monthYearPattern = regexp.MustCompile(`^\d{6}(\d{2}|w\d)?$`)
+	beginPattern     = regexp.MustCompile(`^FIXT?\.\d\.\d$`)
+	checksumPattern  = regexp.MustCompile(`^\d{3}$`)
+)
+
+func (r *recovery) valid(t int, value string, last bool) bool {
+	switch t {
+	case 8:
+		return beginPattern.MatchString(value)
+	case 10:
+		return last && checksumPattern.MatchString(value)
+	}
+
+	/* a data field only ever directly follows its length field and has exactly that length */
+	if lengthTag, ok := dataFieldLength[t]; ok {
+		previous := r.fields[len(r.fields)-1]
+		if previous.Tag != lengthTag || strconv.Itoa(len(value)) != previous.Value {
+			return false
+		}
+	}
+
+	fieldType := r.dict.fieldType(t)
+	if fieldType == nil {
+		return true
+	}
+
+	switch fieldType.Type {
+	case "INT", "LENGTH", "SEQNUM", "NUMINGROUP", "DAYOFMONTH":
+		if !intPattern.MatchString(value) {
+			return false
+		}
+	case "FLOAT", "QTY", "PRICE", "PRICEOFFSET", "AMT", "PERCENTAGE":
+		if !floatPattern.MatchString(value) {
+			return false
+		}
+	case "CHAR":
+		if len(value) != 1 {
+			return false
+		}
+	case "BOOLEAN":
+		if value != "Y" && value != "N" {
+			return false
+		}
+	case "UTCTIMESTAMP", "TZTIMESTAMP":
+		if !timestampPattern.MatchString(value) {
+			return false
+		}
+	case "UTCTIMEONLY", "LOCALMKTTIME", "TZTIMEONLY":
+		if !timePattern.MatchString(value) {
+			return false
+		}
+	case "UTCDATEONLY", "UTCDATE", "LOCALMKTDATE":
+		if !datePattern.MatchString(value) {
+			return false
+		}
+	case "MONTHYEAR":
+		if !monthYearPattern.MatchString(value) {
+			return false
+		}
+	}
+
+	if r.strict && len(fieldType.Enums) > 0 && !strings.HasPrefix(fieldType.Type, "MULTIPLE") {
+		if _, exists := fieldType.Enums[value]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+/* tagAt parses "<tag>=" at pos; tags have no sign or leading zero */
+func tagAt(text string, pos int) (int, int, bool) {
+	i := pos
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	if i == pos || i >= len(text) || text[i] != '=' || text[pos] == '0' || i-pos > 6 {
+		return 0, 0, false
+	}
+
+	t, err := strconv.Atoi(text[pos:i])
+	if err != nil {
+		return 0, 0, false
+	}
+	return t, i + 1, true
+}
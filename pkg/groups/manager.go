@@ -0,0 +1,524 @@
+package groups
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/store"
+	"bcb-fix-microservice/pkg/triggers"
+)
+
+var logger = logging.Component("groups")
+
+const (
+	TypeOCO     = "oco"
+	TypeBracket = "bracket"
+
+	RoleEntry      = "entry"
+	RoleLeg        = "leg"
+	RoleTakeProfit = "take_profit"
+	RoleStopLoss   = "stop_loss"
+
+	StatusPending   = "pending"
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+
+	groupsBucket = "order_groups"
+)
+
+var (
+	ErrGroupNotFound = errors.New("order group not found")
+	ErrGroupClosed   = errors.New("order group is no longer active")
+)
+
+// Leg is one order of a group. Legs with a TriggerType are held locally by the
+// trigger manager until they fire; the others are sent to BCB directly.
+// Status and CumQty are filled in from the live order when a group is read.
+type Leg struct {
+	Role         string  `json:"role"`
+	OrderID      string  `json:"order_id"`
+	Side         string  `json:"side"`
+	OrderQty     float64 `json:"order_qty"`
+	OrdType      string  `json:"ord_type"`
+	Price        float64 `json:"price,omitempty"`
+	TimeInForce  string  `json:"time_in_force"`
+	TriggerType  string  `json:"trigger_type,omitempty"`
+	TriggerPrice float64 `json:"trigger_price,omitempty"`
+	TrailAmount  float64 `json:"trail_amount,omitempty"`
+	TrailPercent float64 `json:"trail_percent,omitempty"`
+	Status       string  `json:"status,omitempty"`
+	CumQty       float64 `json:"cum_qty,omitempty"`
+}
+
+// Group is a one-cancels-other set of legs, or a bracket: an entry order whose
+// OCO exit legs are placed once the entry has filled.
+type Group struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Symbol    string    `json:"symbol"`
+	Status    string    `json:"status"`
+	Entry     *Leg      `json:"entry,omitempty"`
+	Legs      []*Leg    `json:"legs"`
+	FilledLeg string    `json:"filled_leg,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Manager struct {
+	store    *store.Store
+	orders   *orders.OrdersClient
+	triggers *triggers.Manager
+	ids      *idgen.Generator
+	mu       sync.RWMutex
+	groups   map[string]*Group
+	legs     map[string]string
+}
+
+func NewManager(st *store.Store, ordersClient *orders.OrdersClient, triggerManager *triggers.Manager, ids *idgen.Generator) *Manager {
+	manager := &Manager{
+		store:    st,
+		orders:   ordersClient,
+		triggers: triggerManager,
+		ids:      ids,
+		groups:   make(map[string]*Group),
+		legs:     make(map[string]string),
+	}
+
+	loaded, err := store.LoadAll[Group](st, groupsBucket)
+	if err != nil {
+		logger.Error("OrderGroupsStoreLoad", logging.Err(err))
+	}
+	for _, group := range loaded {
+		manager.indexLocked(group)
+	}
+
+	ordersClient.AddListener(manager.onOrderEvent)
+	return manager
+}
+
+func (manager *Manager) CreateOCO(clientID, symbol string, legs []*Leg) (*Group, error) {
+	if len(legs) < 2 {
+		return nil, fmt.Errorf("an OCO group needs at least two legs")
+	}
+
+	group := manager.newGroup(TypeOCO, clientID, symbol)
+	for _, leg := range legs {
+		leg.Role = RoleLeg
+		leg.OrderID = manager.orders.NextClOrdID()
+		group.Legs = append(group.Legs, leg)
+	}
+
+	manager.mu.Lock()
+	manager.indexLocked(group)
+	manager.save(group)
+	manager.mu.Unlock()
+
+	if err := manager.placeLegs(group, group.Legs); err != nil {
+		return manager.snapshot(group.ID), err
+	}
+
+	manager.setStatus(group.ID, StatusActive, "")
+	logger.Info("OrderGroupCreated", "group_id", group.ID, "type", "oco", logging.KeyClientID, clientID, logging.KeySymbol, symbol, "legs", len(legs))
+	return manager.snapshot(group.ID), nil
+}
+
+// CreateBracket sends the entry order now. The exits are placed as an OCO
+// pair for the filled quantity once the entry is done.
+func (manager *Manager) CreateBracket(clientID, symbol string, entry *Leg, takeProfit *Leg, stopLoss *Leg) (*Group, error) {
+	group := manager.newGroup(TypeBracket, clientID, symbol)
+
+	entry.Role = RoleEntry
+	entry.OrderID = manager.orders.NextClOrdID()
+	group.Entry = entry
+
+	takeProfit.Role = RoleTakeProfit
+	stopLoss.Role = RoleStopLoss
+	for _, exit := range []*Leg{takeProfit, stopLoss} {
+		exit.OrderID = manager.orders.NextClOrdID()
+		if exit.Side == "" {
+			exit.Side = oppositeSide(entry.Side)
+		}
+		group.Legs = append(group.Legs, exit)
+	}
+
+	manager.mu.Lock()
+	manager.indexLocked(group)
+	manager.save(group)
+	manager.mu.Unlock()
+
+	if err := manager.placeLegs(group, []*Leg{entry}); err != nil {
+		return manager.snapshot(group.ID), err
+	}
+
+	logger.Info("OrderGroupCreated", "group_id", group.ID, "type", "bracket", logging.KeyClientID, clientID, logging.KeySymbol, symbol, "entry", entry.OrderID)
+	return manager.snapshot(group.ID), nil
+}
+
+// Cancel cancels every leg that is still working and closes the group.
+func (manager *Manager) Cancel(id string) (*Group, error) {
+	manager.mu.Lock()
+	group, exists := manager.groups[id]
+	if !exists {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	if !group.open() {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s is %s", ErrGroupClosed, id, group.Status)
+	}
+
+	group.Status = StatusCancelled
+	group.UpdatedAt = time.Now().UTC()
+	manager.save(group)
+
+	legs := group.Legs
+	if group.Entry != nil {
+		legs = append([]*Leg{group.Entry}, legs...)
+	}
+	manager.mu.Unlock()
+
+	for _, leg := range legs {
+		manager.cancelLeg(leg.OrderID)
+	}
+
+	logger.Info("OrderGroupCancelled", "group_id", id)
+	return manager.snapshot(id), nil
+}
+
+func (manager *Manager) Get(id string) (*Group, bool) {
+	group := manager.snapshot(id)
+	return group, group != nil
+}
+
+func (manager *Manager) List(opts store.ListOptions) ([]*Group, string, error) {
+	manager.mu.RLock()
+	var ids []string
+	for id, group := range manager.groups {
+		if opts.MatchClient(group.ClientID) && opts.Match(group.Symbol, "", group.Status, group.CreatedAt) {
+			ids = append(ids, id)
+		}
+	}
+	manager.mu.RUnlock()
+
+	matched := make([]*Group, 0, len(ids))
+	for _, id := range ids {
+		matched = append(matched, manager.snapshot(id))
+	}
+
+	return store.Paginate(matched, func(group *Group) store.SortKey {
+		return store.SortKey{Time: group.CreatedAt, ID: group.ID}
+	}, opts)
+}
+
+func (manager *Manager) onOrderEvent(event orders.OrderEvent) {
+	if event.Type != orders.EventStatusChanged {
+		return
+	}
+
+	order := event.Order
+
+	manager.mu.Lock()
+	groupID, exists := manager.legs[order.Handle]
+	group := manager.groups[groupID]
+	if !exists || group == nil {
+		manager.mu.Unlock()
+		return
+	}
+	if !group.open() {
+		/* a leg that went out while the group was closing is cancelled as soon as it shows up */
+		late := order.Handle != group.FilledLeg && !order.IsTerminal()
+		manager.mu.Unlock()
+
+		if late {
+			logger.Info("OrderGroupLateLegCancel", "group_id", groupID, logging.KeyHandle, order.Handle, "status", group.Status)
+			go manager.cancelLeg(order.Handle)
+		}
+		return
+	}
+
+	var toCancel, toPlace []*Leg
+
+	if group.Entry != nil && group.Entry.OrderID == order.Handle {
+		if order.IsTerminal() {
+			if order.CumQty > 0 {
+				for _, exit := range group.Legs {
+					exit.OrderQty = order.CumQty
+				}
+				toPlace = group.Legs
+			} else {
+				group.Status = StatusCancelled
+				group.Error = fmt.Sprintf("entry order ended with status %s and no fills", order.Status)
+			}
+		}
+	} else if order.CumQty > 0 && group.FilledLeg == "" {
+		/* first execution on any leg cancels its siblings */
+		group.FilledLeg = order.Handle
+		group.Status = StatusCompleted
+		for _, leg := range group.Legs {
+			if leg.OrderID != order.Handle {
+				toCancel = append(toCancel, leg)
+			}
+		}
+	} else if order.IsTerminal() && group.Status == StatusActive {
+		/* e.g. a mass cancel took the resting legs: the triggers left would otherwise stay armed */
+		if waiting, ended := manager.endedUnfilledLocked(group); ended {
+			group.Status = StatusCancelled
+			group.Error = fmt.Sprintf("leg %s ended with status %s and no leg filled", order.Handle, order.Status)
+			toCancel = waiting
+			logger.Info("OrderGroupLegsEnded", "group_id", groupID, logging.KeyHandle, order.Handle, "status", order.Status, "waiting_triggers", len(waiting))
+		}
+	}
+
+	group.UpdatedAt = time.Now().UTC()
+	manager.save(group)
+	manager.mu.Unlock()
+
+	if len(toCancel) == 0 && len(toPlace) == 0 {
+		return
+	}
+
+	/* cancels and new orders are sent off the FIX goroutine */
+	go func() {
+		for _, leg := range toCancel {
+			logger.Info("OrderGroupSiblingCancel", "group_id", groupID, logging.KeyHandle, order.Handle, "sibling", leg.OrderID)
+			manager.cancelLeg(leg.OrderID)
+		}
+
+		if len(toPlace) > 0 {
+			manager.mu.RLock()
+			stillPending := group.Status == StatusPending
+			manager.mu.RUnlock()
+			if !stillPending {
+				return
+			}
+
+			if err := manager.placeLegs(group, toPlace); err == nil {
+				manager.setStatus(groupID, StatusActive, "")
+			}
+		}
+	}()
+}
+
+// placeLegs sends legs in order. If one fails, the legs already placed are
+// cancelled and the group is marked failed. Placing stops once the group is
+// no longer open, e.g. because a sibling filled or the group was cancelled
+// meanwhile.
+func (manager *Manager) placeLegs(group *Group, legs []*Leg) error {
+	for i, leg := range legs {
+		if !manager.isOpen(group.ID) {
+			logger.Info("OrderGroupPlaceStopped", "group_id", group.ID, "placed", i, "legs", len(legs))
+			return nil
+		}
+
+		if err := manager.placeLeg(group, leg); err != nil {
+			for _, placed := range legs[:i] {
+				manager.cancelLeg(placed.OrderID)
+			}
+
+			logger.Error("OrderGroupPlace", "group_id", group.ID, "leg", leg.OrderID, logging.Err(err))
+			manager.setStatus(group.ID, StatusFailed, err.Error())
+			return err
+		}
+
+		/* the group may have closed while the leg was on its way, onOrderEvent has already done its cancels then */
+		if manager.isLate(group.ID, leg.OrderID) {
+			logger.Info("OrderGroupLateLegCancel", "group_id", group.ID, logging.KeyHandle, leg.OrderID)
+			manager.cancelLeg(leg.OrderID)
+		}
+	}
+	return nil
+}
+
+// endedUnfilledLocked reports whether no leg of group can fill any more:
+// every leg sent to BCB ended without fills and the others are triggers that
+// have not fired. It returns those triggers.
+func (manager *Manager) endedUnfilledLocked(group *Group) ([]*Leg, bool) {
+	var waiting []*Leg
+	for _, leg := range group.Legs {
+		if order, exists := manager.orders.GetOrderStatus(leg.OrderID); exists {
+			if !order.IsTerminal() || order.CumQty > 0 {
+				return nil, false
+			}
+			continue
+		}
+
+		trigger, exists := manager.triggers.Get(leg.OrderID)
+		switch {
+		case !exists || trigger.Status == triggers.StatusTriggered || trigger.Status == triggers.StatusSubmitted:
+			/* not placed yet, or its order is on the way */
+			return nil, false
+		case trigger.Status == triggers.StatusWaiting:
+			waiting = append(waiting, leg)
+		}
+	}
+	return waiting, true
+}
+
+func (manager *Manager) isOpen(id string) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	group, exists := manager.groups[id]
+	return exists && group.open()
+}
+
+/* a leg is late when its group closed without it being the leg that filled */
+func (manager *Manager) isLate(id, legID string) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	group, exists := manager.groups[id]
+	return exists && !group.open() && group.FilledLeg != legID
+}
+
+func (group *Group) open() bool {
+	return group.Status == StatusPending || group.Status == StatusActive
+}
+
+func (manager *Manager) placeLeg(group *Group, leg *Leg) error {
+	if leg.TriggerType != "" {
+		return manager.triggers.Create(&triggers.Trigger{
+			ID:           leg.OrderID,
+			Type:         leg.TriggerType,
+			Symbol:       group.Symbol,
+			Side:         leg.Side,
+			OrderQty:     leg.OrderQty,
+			OrdType:      leg.OrdType,
+			Price:        leg.Price,
+			TimeInForce:  leg.TimeInForce,
+			TriggerPrice: leg.TriggerPrice,
+			TrailAmount:  leg.TrailAmount,
+			TrailPercent: leg.TrailPercent,
+			ClientID:     group.ClientID,
+		})
+	}
+
+	return manager.orders.NewOrderSingle(&orders.OrderInfo{
+		ClOrdID:     leg.OrderID,
+		Symbol:      group.Symbol,
+		Side:        leg.Side,
+		OrderQty:    leg.OrderQty,
+		Price:       leg.Price,
+		OrdType:     leg.OrdType,
+		TimeInForce: leg.TimeInForce,
+		ClientID:    group.ClientID,
+	})
+}
+
+/* a leg is either a live order or a trigger that has not fired yet */
+func (manager *Manager) cancelLeg(id string) {
+	if order, exists := manager.orders.GetOrderStatus(id); exists {
+		if order.IsTerminal() {
+			return
+		}
+		if _, err := manager.orders.CancelOrder(id); err != nil {
+			logger.Error("OrderGroupCancelLeg", "leg", id, logging.Err(err))
+		}
+		return
+	}
+
+	if trigger, exists := manager.triggers.Get(id); exists && trigger.Status == triggers.StatusWaiting {
+		if _, err := manager.triggers.Cancel(id); err != nil {
+			logger.Error("OrderGroupCancelLeg", "leg", id, logging.Err(err))
+		}
+	}
+}
+
+func (manager *Manager) newGroup(groupType, clientID, symbol string) *Group {
+	now := time.Now().UTC()
+	return &Group{
+		ID:        manager.ids.Next(idgen.OrderGroup),
+		Type:      groupType,
+		Symbol:    symbol,
+		Status:    StatusPending,
+		ClientID:  clientID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func (manager *Manager) setStatus(id, status, reason string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	group, exists := manager.groups[id]
+	if !exists || group.Status == StatusCompleted || group.Status == StatusCancelled {
+		return
+	}
+	group.Status = status
+	group.Error = reason
+	group.UpdatedAt = time.Now().UTC()
+	manager.save(group)
+}
+
+// snapshot copies the group and fills in the current state of each leg.
+func (manager *Manager) snapshot(id string) *Group {
+	manager.mu.RLock()
+	group, exists := manager.groups[id]
+	if !exists {
+		manager.mu.RUnlock()
+		return nil
+	}
+
+	copied := *group
+	copied.Legs = make([]*Leg, 0, len(group.Legs))
+	for _, leg := range group.Legs {
+		legCopy := *leg
+		copied.Legs = append(copied.Legs, &legCopy)
+	}
+	if group.Entry != nil {
+		entryCopy := *group.Entry
+		copied.Entry = &entryCopy
+	}
+	manager.mu.RUnlock()
+
+	for _, leg := range append([]*Leg{copied.Entry}, copied.Legs...) {
+		if leg != nil {
+			manager.fillLegState(leg)
+		}
+	}
+	return &copied
+}
+
+func (manager *Manager) fillLegState(leg *Leg) {
+	if order, exists := manager.orders.GetOrderStatus(leg.OrderID); exists {
+		leg.Status = order.Status
+		leg.CumQty = order.CumQty
+		return
+	}
+	if trigger, exists := manager.triggers.Get(leg.OrderID); exists {
+		leg.Status = trigger.Status
+	}
+}
+
+func (manager *Manager) indexLocked(group *Group) {
+	manager.groups[group.ID] = group
+	if group.Entry != nil {
+		manager.legs[group.Entry.OrderID] = group.ID
+	}
+	for _, leg := range group.Legs {
+		manager.legs[leg.OrderID] = group.ID
+	}
+}
+
+func (manager *Manager) save(group *Group) {
+	if err := manager.store.Put(groupsBucket, group.ID, group); err != nil {
+		logger.Error("OrderGroupPersist", "group_id", group.ID, logging.Err(err))
+	}
+}
+
+func oppositeSide(side string) string {
+	if side == "1" {
+		return "2"
+	}
+	return "1"
+}
@@ -0,0 +1,449 @@
+package iceberg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/store"
+)
+
+var logger = logging.Component("iceberg")
+
+const (
+	StatusWorking   = "working"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+
+	icebergsBucket = "icebergs"
+)
+
+var (
+	ErrIcebergNotFound = errors.New("iceberg order not found")
+	ErrIcebergClosed   = errors.New("iceberg order is no longer working")
+	ErrInvalidAmend    = errors.New("invalid iceberg amendment")
+)
+
+type Slice struct {
+	ClOrdID  string  `json:"cl_ord_id"`
+	OrderQty float64 `json:"order_qty"`
+	Price    float64 `json:"price"`
+	Status   string  `json:"status"`
+	CumQty   float64 `json:"cum_qty"`
+	AvgPx    float64 `json:"avg_px"`
+}
+
+type Amendment struct {
+	Price      float64 `json:"price"`
+	TotalQty   float64 `json:"total_qty"`
+	DisplayQty float64 `json:"display_qty"`
+}
+
+// Iceberg is a limit order of TotalQty of which only DisplayQty is live at
+// BCB at any time, as one slice. A filled slice is replenished at the same
+// price until the total is done.
+type Iceberg struct {
+	ID          string     `json:"id"`
+	Symbol      string     `json:"symbol"`
+	Side        string     `json:"side"`
+	TotalQty    float64    `json:"total_qty"`
+	DisplayQty  float64    `json:"display_qty"`
+	Price       float64    `json:"price"`
+	TimeInForce string     `json:"time_in_force"`
+	Status      string     `json:"status"`
+	FilledQty   float64    `json:"filled_qty"`
+	AvgPx       float64    `json:"avg_px"`
+	LiveSlice   string     `json:"live_slice,omitempty"`
+	Pending     *Amendment `json:"pending_replace,omitempty"`
+	Slices      []*Slice   `json:"slices"`
+	Error       string     `json:"error,omitempty"`
+	ClientID    string     `json:"client_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type Manager struct {
+	store    *store.Store
+	orders   *orders.OrdersClient
+	ids      *idgen.Generator
+	mu       sync.RWMutex
+	icebergs map[string]*Iceberg
+	slices   map[string]string
+}
+
+func NewManager(st *store.Store, ordersClient *orders.OrdersClient, ids *idgen.Generator) *Manager {
+	manager := &Manager{
+		store:    st,
+		orders:   ordersClient,
+		ids:      ids,
+		icebergs: make(map[string]*Iceberg),
+		slices:   make(map[string]string),
+	}
+
+	loaded, err := store.LoadAll[Iceberg](st, icebergsBucket)
+	if err != nil {
+		logger.Error("IcebergsStoreLoad", logging.Err(err))
+	}
+	for _, ice := range loaded {
+		manager.icebergs[ice.ID] = ice
+		for _, slice := range ice.Slices {
+			manager.slices[slice.ClOrdID] = ice.ID
+		}
+	}
+
+	ordersClient.AddListener(manager.onOrderEvent)
+	return manager
+}
+
+func Validate(ice *Iceberg) error {
+	if ice.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if ice.Side != "1" && ice.Side != "2" {
+		return fmt.Errorf("side must be '1' (Buy) or '2' (Sell)")
+	}
+	if ice.Price <= 0 {
+		return fmt.Errorf("price is required for iceberg orders")
+	}
+	if ice.TotalQty <= 0 || ice.DisplayQty <= 0 {
+		return fmt.Errorf("total_qty and display_qty must be positive")
+	}
+	if ice.DisplayQty > ice.TotalQty {
+		return fmt.Errorf("display_qty must not exceed total_qty")
+	}
+	return nil
+}
+
+func (manager *Manager) Create(ice *Iceberg) (*Iceberg, error) {
+	if err := Validate(ice); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	ice.ID = manager.ids.Next(idgen.Iceberg)
+	ice.Status = StatusWorking
+	ice.CreatedAt = now
+	ice.UpdatedAt = now
+
+	manager.mu.Lock()
+	manager.icebergs[ice.ID] = ice
+	manager.save(ice)
+	manager.mu.Unlock()
+
+	if err := manager.replenish(ice.ID); err != nil {
+		return manager.snapshot(ice.ID), err
+	}
+
+	logger.Info("IcebergCreated", "iceberg_id", ice.ID, logging.KeyClientID, ice.ClientID, logging.KeySymbol, ice.Symbol, "side", ice.Side,
+		"total_qty", ice.TotalQty, "price", ice.Price, "display_qty", ice.DisplayQty)
+	return manager.snapshot(ice.ID), nil
+}
+
+// Owner returns the iceberg that id refers to, either directly or through
+// one of its slices.
+func (manager *Manager) Owner(id string) (string, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	if _, exists := manager.icebergs[id]; exists {
+		return id, true
+	}
+	iceID, exists := manager.slices[id]
+	return iceID, exists
+}
+
+func (manager *Manager) Cancel(id string) (*Iceberg, error) {
+	manager.mu.Lock()
+	ice, err := manager.workingLocked(id)
+	if err != nil {
+		manager.mu.Unlock()
+		return nil, err
+	}
+
+	ice.Status = StatusCancelled
+	ice.Pending = nil
+	ice.UpdatedAt = time.Now().UTC()
+	manager.save(ice)
+	live := ice.LiveSlice
+	manager.mu.Unlock()
+
+	if live != "" {
+		if order, exists := manager.orders.GetOrderStatus(live); exists && !order.IsTerminal() {
+			if _, err := manager.orders.CancelOrder(live); err != nil {
+				logger.Error("IcebergCancelSlice", "iceberg_id", id, logging.KeyHandle, live, logging.Err(err))
+			}
+		}
+	}
+
+	logger.Info("IcebergCancelled", "iceberg_id", id)
+	return manager.snapshot(id), nil
+}
+
+// Replace amends price, total and display quantity of the whole iceberg. The
+// live slice is replaced at BCB; the new terms apply to later slices once BCB
+// confirms that replace.
+func (manager *Manager) Replace(id string, amendment Amendment) (*Iceberg, error) {
+	manager.mu.Lock()
+	ice, err := manager.workingLocked(id)
+	if err != nil {
+		manager.mu.Unlock()
+		return nil, err
+	}
+
+	if amendment.Price <= 0 {
+		amendment.Price = ice.Price
+	}
+	if amendment.TotalQty <= 0 {
+		amendment.TotalQty = ice.TotalQty
+	}
+	if amendment.DisplayQty <= 0 {
+		amendment.DisplayQty = ice.DisplayQty
+	}
+	if amendment.DisplayQty > amendment.TotalQty {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("%w: display_qty must not exceed total_qty", ErrInvalidAmend)
+	}
+	if amendment.TotalQty <= ice.FilledQty {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("%w: total_qty must exceed the filled quantity %.8f", ErrInvalidAmend, ice.FilledQty)
+	}
+
+	live := manager.sliceLocked(ice, ice.LiveSlice)
+	if live == nil {
+		/* nothing at BCB: the next slice simply uses the new terms */
+		ice.Price, ice.TotalQty, ice.DisplayQty = amendment.Price, amendment.TotalQty, amendment.DisplayQty
+		ice.UpdatedAt = time.Now().UTC()
+		manager.save(ice)
+		manager.mu.Unlock()
+		return manager.snapshot(id), nil
+	}
+
+	/* FIX OrderQty on a replace includes what the slice has already filled */
+	remaining := amendment.TotalQty - (ice.FilledQty - live.CumQty)
+	sliceQty := live.CumQty + math.Min(amendment.DisplayQty, remaining-live.CumQty)
+
+	ice.Pending = &amendment
+	ice.UpdatedAt = time.Now().UTC()
+	manager.save(ice)
+	manager.mu.Unlock()
+
+	err = manager.orders.ReplaceOrder(live.ClOrdID, &orders.OrderInfo{
+		ClOrdID:     manager.orders.NextReplaceClOrdID(),
+		OrderQty:    sliceQty,
+		Price:       amendment.Price,
+		OrdType:     "2",
+		TimeInForce: ice.TimeInForce,
+	})
+	if err != nil {
+		manager.mu.Lock()
+		ice.Pending = nil
+		manager.save(ice)
+		manager.mu.Unlock()
+		return nil, err
+	}
+
+	logger.Info("IcebergReplaceRequested", "iceberg_id", id, "price", amendment.Price, "total_qty", amendment.TotalQty, "display_qty", amendment.DisplayQty)
+	return manager.snapshot(id), nil
+}
+
+func (manager *Manager) Get(id string) (*Iceberg, bool) {
+	ice := manager.snapshot(id)
+	return ice, ice != nil
+}
+
+func (manager *Manager) List(opts store.ListOptions) ([]*Iceberg, string, error) {
+	manager.mu.RLock()
+	var matched []*Iceberg
+	for _, ice := range manager.icebergs {
+		if opts.MatchClient(ice.ClientID) && opts.Match(ice.Symbol, ice.Side, ice.Status, ice.CreatedAt) {
+			matched = append(matched, ice.copyLocked())
+		}
+	}
+	manager.mu.RUnlock()
+
+	return store.Paginate(matched, func(ice *Iceberg) store.SortKey {
+		return store.SortKey{Time: ice.CreatedAt, ID: ice.ID}
+	}, opts)
+}
+
+func (manager *Manager) onOrderEvent(event orders.OrderEvent) {
+	if event.Type != orders.EventStatusChanged && event.Type != orders.EventCancelRejected {
+		return
+	}
+
+	order := event.Order
+
+	manager.mu.Lock()
+	id, exists := manager.slices[order.Handle]
+	if !exists {
+		manager.mu.Unlock()
+		return
+	}
+	ice := manager.icebergs[id]
+	slice := manager.sliceLocked(ice, order.Handle)
+
+	slice.Status = order.Status
+	slice.CumQty = order.CumQty
+	slice.AvgPx = order.AvgPx
+	slice.OrderQty = order.OrderQty
+	slice.Price = order.Price
+	ice.recomputeLocked()
+
+	if ice.Pending != nil && order.Handle == ice.LiveSlice {
+		switch {
+		case event.Type == orders.EventCancelRejected:
+			logger.Warn("IcebergReplaceRejected", "iceberg_id", id, "text", event.Text)
+			ice.Pending = nil
+		case event.Execution != nil && event.Execution.ExecType == "5":
+			ice.Price, ice.TotalQty, ice.DisplayQty = ice.Pending.Price, ice.Pending.TotalQty, ice.Pending.DisplayQty
+			ice.Pending = nil
+		}
+	}
+
+	replenish := false
+	if order.IsTerminal() && order.Handle == ice.LiveSlice {
+		ice.LiveSlice = ""
+
+		switch {
+		case ice.Status != StatusWorking:
+		case ice.FilledQty >= ice.TotalQty:
+			ice.Status = StatusCompleted
+		case order.Status == "2":
+			replenish = true
+		default:
+			/* the slice ended at BCB without filling: the iceberg cannot continue */
+			ice.Status = StatusFailed
+			ice.Error = fmt.Sprintf("slice %s ended with status %s", order.Handle, order.Status)
+			if order.RejectReason != "" {
+				ice.Error += ": " + order.RejectReason
+			}
+		}
+	}
+
+	ice.UpdatedAt = time.Now().UTC()
+	manager.save(ice)
+	manager.mu.Unlock()
+
+	if replenish {
+		/* sent off the FIX goroutine */
+		go manager.replenish(id)
+	}
+}
+
+// replenish sends the next display slice at the iceberg's current price.
+func (manager *Manager) replenish(id string) error {
+	manager.mu.Lock()
+	ice := manager.icebergs[id]
+	if ice.Status != StatusWorking || ice.LiveSlice != "" {
+		manager.mu.Unlock()
+		return nil
+	}
+
+	qty := math.Min(ice.DisplayQty, ice.TotalQty-ice.FilledQty)
+	slice := &Slice{ClOrdID: manager.orders.NextClOrdID(), OrderQty: qty, Price: ice.Price, Status: "A"}
+	ice.Slices = append(ice.Slices, slice)
+	ice.LiveSlice = slice.ClOrdID
+	manager.slices[slice.ClOrdID] = id
+
+	order := &orders.OrderInfo{
+		ClOrdID:     slice.ClOrdID,
+		Symbol:      ice.Symbol,
+		Side:        ice.Side,
+		OrderQty:    qty,
+		Price:       ice.Price,
+		OrdType:     "2",
+		TimeInForce: ice.TimeInForce,
+		ClientID:    ice.ClientID,
+	}
+	manager.mu.Unlock()
+
+	err := manager.orders.NewOrderSingle(order)
+
+	manager.mu.Lock()
+	if err != nil {
+		slice.Status = "8"
+		ice.LiveSlice = ""
+		ice.Status = StatusFailed
+		ice.Error = err.Error()
+		logger.Error("IcebergReplenish", "iceberg_id", id, logging.Err(err))
+	}
+	ice.UpdatedAt = time.Now().UTC()
+	manager.save(ice)
+	manager.mu.Unlock()
+
+	return err
+}
+
+func (manager *Manager) workingLocked(id string) (*Iceberg, error) {
+	if iceID, exists := manager.slices[id]; exists {
+		id = iceID
+	}
+	ice, exists := manager.icebergs[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrIcebergNotFound, id)
+	}
+	if ice.Status != StatusWorking {
+		return nil, fmt.Errorf("%w: %s is %s", ErrIcebergClosed, id, ice.Status)
+	}
+	return ice, nil
+}
+
+func (manager *Manager) sliceLocked(ice *Iceberg, clOrdID string) *Slice {
+	for _, slice := range ice.Slices {
+		if slice.ClOrdID == clOrdID {
+			return slice
+		}
+	}
+	return nil
+}
+
+func (ice *Iceberg) recomputeLocked() {
+	filled, notional := 0.0, 0.0
+	for _, slice := range ice.Slices {
+		filled += slice.CumQty
+		notional += slice.CumQty * slice.AvgPx
+	}
+
+	ice.FilledQty = filled
+	ice.AvgPx = 0
+	if filled > 0 {
+		ice.AvgPx = notional / filled
+	}
+}
+
+func (ice *Iceberg) copyLocked() *Iceberg {
+	copied := *ice
+	copied.Slices = make([]*Slice, 0, len(ice.Slices))
+	for _, slice := range ice.Slices {
+		sliceCopy := *slice
+		copied.Slices = append(copied.Slices, &sliceCopy)
+	}
+	if ice.Pending != nil {
+		pending := *ice.Pending
+		copied.Pending = &pending
+	}
+	return &copied
+}
+
+func (manager *Manager) snapshot(id string) *Iceberg {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	ice, exists := manager.icebergs[id]
+	if !exists {
+		return nil
+	}
+	return ice.copyLocked()
+}
+
+func (manager *Manager) save(ice *Iceberg) {
+	if err := manager.store.Put(icebergsBucket, ice.ID, ice); err != nil {
+		logger.Error("IcebergPersist", "iceberg_id", ice.ID, logging.Err(err))
+	}
+}
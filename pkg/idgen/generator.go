@@ -0,0 +1,119 @@
+package idgen
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/store"
+)
+
+var logger = logging.Component("idgen")
+
+const (
+	Order             = "ord"
+	Cancel            = "cxl"
+	Replace           = "rpl"
+	MDRequest         = "md"
+	SecurityRequest   = "sec"
+	Exchange          = "exch"
+	StatusRequest     = "osr"
+	MassStatusRequest = "msr"
+	MassCancel        = "mcx"
+	OrderGroup        = "grp"
+	AlgoOrder         = "algo"
+	Iceberg           = "ice"
+	QuoteRequest      = "qr"
+
+	MaxClientIDLength = 64
+
+	metaBucket = "meta"
+	epochKey   = "idgen_epoch"
+)
+
+var (
+	instancePattern = regexp.MustCompile(`^[A-Za-z0-9]{1,8}$`)
+	clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+)
+
+// Generator issues IDs of the form <kind>-<instance>-<epoch>-<counter>. The
+// epoch is fixed per process and persisted so that it strictly increases across
+// restarts even if the wall clock steps backwards; the counter is monotonic
+// within the process.
+type Generator struct {
+	instance string
+	epoch    string
+	counter  atomic.Uint64
+}
+
+func New(instance string, st *store.Store) (*Generator, error) {
+	if !instancePattern.MatchString(instance) {
+		return nil, fmt.Errorf("instance id must be 1-8 alphanumeric characters: %q", instance)
+	}
+
+	epoch := time.Now().UnixMilli()
+
+	if st != nil {
+		var last int64
+		if _, err := st.Get(metaBucket, epochKey, &last); err != nil {
+			return nil, fmt.Errorf("failed to load id epoch: %w", err)
+		}
+		if epoch <= last {
+			logger.Warn("ClockBehind", "epoch", epoch, "last_epoch", last)
+			epoch = last + 1
+		}
+		if err := st.Put(metaBucket, epochKey, epoch); err != nil {
+			return nil, fmt.Errorf("failed to persist id epoch: %w", err)
+		}
+	}
+
+	return &Generator{
+		instance: instance,
+		epoch:    strconv.FormatInt(epoch, 36),
+	}, nil
+}
+
+func DefaultInstanceID() string {
+	hostname, _ := os.Hostname()
+
+	var b strings.Builder
+	for _, r := range hostname {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+
+	id := b.String()
+	if len(id) > 8 {
+		id = id[len(id)-8:]
+	}
+	if id == "" {
+		id = "bcb"
+	}
+	return id
+}
+
+func (g *Generator) Next(kind string) string {
+	n := g.counter.Add(1)
+	return fmt.Sprintf("%s-%s-%s-%s", kind, g.instance, g.epoch, strconv.FormatUint(n, 36))
+}
+
+func ValidateClientID(id string) error {
+	if len(id) > MaxClientIDLength {
+		return fmt.Errorf("cl_ord_id must be at most %d characters", MaxClientIDLength)
+	}
+	if !clientIDPattern.MatchString(id) {
+		return fmt.Errorf("cl_ord_id may only contain letters, digits, '.', '_', ':' and '-'")
+	}
+	for _, kind := range []string{Order, Cancel, Replace, MDRequest, SecurityRequest, Exchange, StatusRequest, MassStatusRequest, MassCancel, OrderGroup, AlgoOrder, Iceberg, QuoteRequest} {
+		if strings.HasPrefix(id, kind+"-") {
+			return fmt.Errorf("cl_ord_id must not use the reserved prefix %q", kind+"-")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package journal persists every application message sent or received on the
+// FIX sessions as a structured record, indexed by the identifiers compliance
+// looks orders up by.
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	bolt "go.etcd.io/bbolt"
+)
+
+var logger = logging.Component("journal")
+
+const (
+	messagesBucket = "messages"
+
+	/* index keys are <value> 0x00 <sequence>, the value is empty for no entries */
+	clOrdIDIndex = "idx_cl_ord_id"
+	orderIDIndex = "idx_order_id"
+	execIDIndex  = "idx_exec_id"
+	symbolIndex  = "idx_symbol"
+
+	/* records written per transaction at most, bbolt syncs once per commit */
+	maxBatch = 256
+)
+
+var buckets = []string{messagesBucket, clOrdIDIndex, orderIDIndex, execIDIndex, symbolIndex}
+
+// Entry is one journaled message. ClOrdID and OrigClOrdID are both indexed
+// under ClOrdID so that cancels and replaces show up in the history of the
+// order they refer to. Raw is the wire message with the configured tags
+// redacted.
+type Entry struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	Direction   string    `json:"direction"`
+	Session     string    `json:"session"`
+	MsgType     string    `json:"msg_type"`
+	MsgSeqNum   int       `json:"msg_seq_num"`
+	ClOrdID     string    `json:"cl_ord_id,omitempty"`
+	OrigClOrdID string    `json:"orig_cl_ord_id,omitempty"`
+	OrderID     string    `json:"order_id,omitempty"`
+	ExecID      string    `json:"exec_id,omitempty"`
+	Symbol      string    `json:"symbol,omitempty"`
+	Raw         string    `json:"raw"`
+}
+
+type Config struct {
+	/* tags masked in Raw on top of logging.DefaultRedactTags */
+	RedactTags []int
+	/* MsgTypes that are not journaled; W snapshots would outgrow everything else within hours */
+	Exclude []string
+	/* messages queued for writing before Record blocks */
+	QueueSize int
+}
+
+func DefaultConfig() Config {
+	return Config{Exclude: []string{"W"}, QueueSize: 4096}
+}
+
+// Journal writes entries from a single goroutine so that the FIX session
+// goroutines only pay for building the record. When the queue is full Record
+// blocks rather than dropping messages; bcb_journal_blocked_total and
+// bcb_journal_blocked_seconds_total show how often and for how long.
+type Journal struct {
+	db       *bolt.DB
+	redactor *logging.Redactor
+	exclude  map[string]bool
+	queue    chan *Entry
+	wg       sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func Open(path string, config Config) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize journal buckets: %w", err)
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultConfig().QueueSize
+	}
+
+	j := &Journal{
+		db:       db,
+		redactor: logging.NewRedactor(config.RedactTags),
+		exclude:  make(map[string]bool, len(config.Exclude)),
+		queue:    make(chan *Entry, config.QueueSize),
+	}
+	for _, msgType := range config.Exclude {
+		j.exclude[msgType] = true
+	}
+
+	j.wg.Add(1)
+	go j.writer()
+
+	logger.Info("JournalOpened", "path", path, "exclude", config.Exclude)
+	return j, nil
+}
+
+// Close writes the queued entries and closes the database. Messages recorded
+// afterwards are dropped.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	close(j.queue)
+	j.mu.Unlock()
+
+	j.wg.Wait()
+	return j.db.Close()
+}
+
+// Record queues message for writing. direction is logging.DirIn or
+// logging.DirOut. A nil Journal records nothing.
+func (j *Journal) Record(direction string, message *quickfix.Message, sessionID quickfix.SessionID) {
+	if j == nil {
+		return
+	}
+
+	msgType, _ := message.Header.GetString(tag.MsgType)
+	if j.exclude[msgType] {
+		return
+	}
+
+	entry := &Entry{
+		Time:      time.Now().UTC(),
+		Direction: direction,
+		Session:   sessionID.String(),
+		MsgType:   msgType,
+		Raw:       string(j.redactor.Redact(message.Bytes())),
+	}
+	entry.MsgSeqNum, _ = message.Header.GetInt(tag.MsgSeqNum)
+	entry.ClOrdID, _ = message.Body.GetString(tag.ClOrdID)
+	entry.OrigClOrdID, _ = message.Body.GetString(tag.OrigClOrdID)
+	entry.OrderID, _ = message.Body.GetString(tag.OrderID)
+	entry.ExecID, _ = message.Body.GetString(tag.ExecID)
+	entry.Symbol, _ = message.Body.GetString(tag.Symbol)
+	if entry.Symbol == "" && (msgType == "R" || msgType == "V") {
+		entry.Symbol = relatedSymbol(message.Bytes())
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if j.closed {
+		logger.Warn("JournalClosed", logging.KeyMsgType, msgType, logging.KeyDirection, direction)
+		return
+	}
+
+	select {
+	case j.queue <- entry:
+	default:
+		start := time.Now()
+		j.queue <- entry
+		metrics.JournalBlocked.Inc()
+		metrics.JournalBlockedSeconds.Add(time.Since(start).Seconds())
+	}
+}
+
+// relatedSymbol returns the Symbol of the first NoRelatedSym entry. Quote and
+// market data requests carry their symbols only inside that group.
+func relatedSymbol(raw []byte) string {
+	inGroup := false
+	for _, field := range bytes.Split(raw, []byte{'\x01'}) {
+		tagValue := bytes.SplitN(field, []byte{'='}, 2)
+		if len(tagValue) != 2 {
+			continue
+		}
+
+		switch t, _ := strconv.Atoi(string(tagValue[0])); {
+		case t == int(tag.NoRelatedSym):
+			inGroup = true
+		case inGroup && t == int(tag.Symbol):
+			return string(tagValue[1])
+		}
+	}
+	return ""
+}
+
+func (j *Journal) writer() {
+	defer j.wg.Done()
+
+	for entry := range j.queue {
+		batch := []*Entry{entry}
+
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case next, ok := <-j.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+
+		if err := j.write(batch); err != nil {
+			logger.Error("JournalWrite", "entries", len(batch), logging.Err(err))
+		}
+	}
+}
+
+func (j *Journal) write(batch []*Entry) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket([]byte(messagesBucket))
+
+		for _, entry := range batch {
+			seq, err := messages.NextSequence()
+			if err != nil {
+				return err
+			}
+			entry.ID = seq
+
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("failed to encode journal entry: %w", err)
+			}
+			if err := messages.Put(seqKey(nil, seq), data); err != nil {
+				return err
+			}
+
+			for _, index := range []struct {
+				bucket string
+				value  string
+			}{
+				{clOrdIDIndex, entry.ClOrdID},
+				{clOrdIDIndex, entry.OrigClOrdID},
+				{orderIDIndex, entry.OrderID},
+				{execIDIndex, entry.ExecID},
+				{symbolIndex, entry.Symbol},
+			} {
+				if index.value == "" {
+					continue
+				}
+				if err := tx.Bucket([]byte(index.bucket)).Put(seqKey(indexPrefix(index.value), seq), nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func indexPrefix(value string) []byte {
+	return append([]byte(value), 0)
+}
+
+/* sequences are big endian so that keys sort in write order */
+func seqKey(prefix []byte, seq uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], seq)
+	return key
+}
+
+func keySeq(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+func (e *Entry) cursorID() string {
+	return strconv.FormatUint(e.ID, 10)
+}
@@ -0,0 +1,218 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"bcb-fix-microservice/pkg/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Query selects journal entries. An entry matches the identifier lists when
+// it carries any of the listed ClOrdIDs, OrderIDs or ExecIDs, so a whole
+// cancel/replace chain can be fetched at once; every other filter must match
+// as well. Entries come back in write order, oldest first unless Descending.
+type Query struct {
+	ClOrdIDs   []string
+	OrderIDs   []string
+	ExecIDs    []string
+	Symbol     string
+	MsgType    string
+	Direction  string
+	Session    string
+	From       time.Time
+	To         time.Time
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+func (q Query) hasIDs() bool {
+	return len(q.ClOrdIDs) > 0 || len(q.OrderIDs) > 0 || len(q.ExecIDs) > 0
+}
+
+func (q Query) match(entry *Entry) bool {
+	if q.hasIDs() && !contains(q.ClOrdIDs, entry.ClOrdID, entry.OrigClOrdID) &&
+		!contains(q.OrderIDs, entry.OrderID) && !contains(q.ExecIDs, entry.ExecID) {
+		return false
+	}
+	if q.Symbol != "" && q.Symbol != entry.Symbol {
+		return false
+	}
+	if q.MsgType != "" && q.MsgType != entry.MsgType {
+		return false
+	}
+	if q.Direction != "" && q.Direction != entry.Direction {
+		return false
+	}
+	if q.Session != "" && q.Session != entry.Session {
+		return false
+	}
+	if !q.From.IsZero() && entry.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !entry.Time.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, values ...string) bool {
+	for _, want := range list {
+		for _, value := range values {
+			if value != "" && value == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// List returns a page of matching entries and the cursor of the next page,
+// which is empty on the last page. Identifier and symbol filters are served
+// from the indexes; anything else scans the journal.
+func (j *Journal) List(q Query) ([]*Entry, string, error) {
+	var after uint64
+	if q.Cursor != "" {
+		key, err := store.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if after, err = strconv.ParseUint(key.ID, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor")
+		}
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = store.DefaultPageLimit
+	}
+	if limit > store.MaxPageLimit {
+		limit = store.MaxPageLimit
+	}
+
+	var entries []*Entry
+	more := false
+
+	err := j.db.View(func(tx *bolt.Tx) error {
+		messages := tx.Bucket([]byte(messagesBucket))
+
+		var decodeErr error
+		visit := func(seq uint64) bool {
+			data := messages.Get(seqKey(nil, seq))
+			if data == nil {
+				return true
+			}
+
+			entry := new(Entry)
+			if err := json.Unmarshal(data, entry); err != nil {
+				decodeErr = fmt.Errorf("failed to decode journal entry %d: %w", seq, err)
+				return false
+			}
+			if !q.match(entry) {
+				return true
+			}
+
+			if len(entries) == limit {
+				more = true
+				return false
+			}
+			entries = append(entries, entry)
+			return true
+		}
+
+		switch {
+		case q.hasIDs():
+			for _, seq := range j.lookup(tx, q, after) {
+				if !visit(seq) {
+					break
+				}
+			}
+		case q.Symbol != "":
+			scan(tx.Bucket([]byte(symbolIndex)).Cursor(), indexPrefix(q.Symbol), q.Descending, after, visit)
+		default:
+			scan(messages.Cursor(), nil, q.Descending, after, visit)
+		}
+		return decodeErr
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !more {
+		return entries, "", nil
+	}
+	last := entries[len(entries)-1]
+	return entries, store.EncodeCursor(store.SortKey{Time: last.Time, ID: last.cursorID()}), nil
+}
+
+/* lookup merges the index hits for every identifier in q into one ordered list past the cursor */
+func (j *Journal) lookup(tx *bolt.Tx, q Query, after uint64) []uint64 {
+	seen := make(map[uint64]bool)
+	for _, index := range []struct {
+		bucket string
+		values []string
+	}{
+		{clOrdIDIndex, q.ClOrdIDs},
+		{orderIDIndex, q.OrderIDs},
+		{execIDIndex, q.ExecIDs},
+	} {
+		for _, value := range index.values {
+			if value == "" {
+				continue
+			}
+			scan(tx.Bucket([]byte(index.bucket)).Cursor(), indexPrefix(value), q.Descending, after, func(seq uint64) bool {
+				seen[seq] = true
+				return true
+			})
+		}
+	}
+
+	seqs := make([]uint64, 0, len(seen))
+	for seq := range seen {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, k int) bool {
+		if q.Descending {
+			return seqs[i] > seqs[k]
+		}
+		return seqs[i] < seqs[k]
+	})
+	return seqs
+}
+
+// scan walks the keys under prefix in sequence order, starting past after
+// when it is set, until fn returns false.
+func scan(c *bolt.Cursor, prefix []byte, descending bool, after uint64, fn func(seq uint64) bool) {
+	if !descending {
+		for k, _ := c.Seek(seqKey(prefix, after+1)); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if !fn(keySeq(k)) {
+				return
+			}
+		}
+		return
+	}
+
+	start := uint64(math.MaxUint64)
+	if after != 0 {
+		start = after
+	}
+
+	/* the last key below start: step back from the first key at or above it */
+	k, _ := c.Seek(seqKey(prefix, start))
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+		if !fn(keySeq(k)) {
+			return
+		}
+	}
+}
@@ -4,26 +4,67 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/quickfixgo/quickfix"
 )
 
+var logger = Component("logging")
+
+/* what DebugLog mirrors to the process log besides its own file */
+const (
+	StdoutNone   = "none"
+	StdoutEvents = "events"
+	StdoutAll    = "all"
+)
+
+// FIXLogConfig controls where raw FIX session logs go and how long they are
+// kept. Zero MaxSize, RotateEvery, MaxBackups or MaxAge disable that limit.
+// RedactTags are masked in addition to DefaultRedactTags.
+type FIXLogConfig struct {
+	Dir         string
+	MaxSize     int64
+	RotateEvery time.Duration
+	MaxBackups  int
+	MaxAge      time.Duration
+	Compress    bool
+	Stdout      string
+	RedactTags  []int
+}
+
+func DefaultFIXLogConfig() FIXLogConfig {
+	return FIXLogConfig{
+		Dir:         "log",
+		MaxSize:     50 << 20,
+		RotateEvery: 24 * time.Hour,
+		MaxBackups:  30,
+		MaxAge:      30 * 24 * time.Hour,
+		Compress:    true,
+		Stdout:      StdoutEvents,
+	}
+}
+
 type DebugLogFactory struct {
-	logPath string
+	name     string
+	config   FIXLogConfig
+	redactor *Redactor
 }
 
-func NewDebugLogFactory(logPath string) *DebugLogFactory {
-	if err := os.MkdirAll(logPath, 0755); err != nil {
-		log.Printf("Warning: Failed to create log directory %s: %v", logPath, err)
+// NewDebugLogFactory builds the logs of one application. name prefixes its
+// global log, so applications sharing config.Dir write separate files.
+func NewDebugLogFactory(name string, config FIXLogConfig) *DebugLogFactory {
+	if err := os.MkdirAll(config.Dir, 0750); err != nil {
+		logger.Warn("LogDirectoryCreate", "path", config.Dir, Err(err))
 	}
 
-	return &DebugLogFactory{logPath: logPath}
+	return &DebugLogFactory{name: name, config: config, redactor: NewRedactor(config.RedactTags)}
 }
 
 func (f *DebugLogFactory) Create() (quickfix.Log, error) {
-	return f.createLog("global")
+	if f.name == "" {
+		return f.createLog("global")
+	}
+	return f.createLog(f.name + "_global")
 }
 
 func (f *DebugLogFactory) CreateSessionLog(sessionID quickfix.SessionID) (quickfix.Log, error) {
@@ -35,42 +76,60 @@ func (f *DebugLogFactory) CreateSessionLog(sessionID quickfix.SessionID) (quickf
 }
 
 func (f *DebugLogFactory) createLog(name string) (quickfix.Log, error) {
-	fileName := filepath.Join(f.logPath, fmt.Sprintf("%s_%s.log", name, time.Now().Format("20060102_150405")))
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	file, err := OpenRotatingFile(f.config.Dir, name, f.config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log file %s: %w", fileName, err)
+		return nil, err
 	}
 
-	return NewDebugLog(file, name), nil
+	return NewDebugLog(file, name, f.config.Stdout, f.redactor), nil
 }
 
+// DebugLog writes one session's raw traffic to a rotating file. Every sink
+// sees the same redacted text, so credentials never reach disk or stdout.
 type DebugLog struct {
-	file   *os.File
-	name   string
-	logger *log.Logger
+	file     *RotatingFile
+	name     string
+	stdout   string
+	redactor *Redactor
+	logger   *log.Logger
 }
 
-func NewDebugLog(file *os.File, name string) *DebugLog {
+func NewDebugLog(file *RotatingFile, name string, stdout string, redactor *Redactor) *DebugLog {
+	if redactor == nil {
+		redactor = NewRedactor(nil)
+	}
+
 	return &DebugLog{
-		file:   file,
-		name:   name,
-		logger: log.New(file, fmt.Sprintf("[%s] ", name), log.LstdFlags|log.Lmicroseconds),
+		file:     file,
+		name:     name,
+		stdout:   stdout,
+		redactor: redactor,
+		logger:   log.New(file, fmt.Sprintf("[%s] ", name), log.LstdFlags|log.Lmicroseconds),
 	}
 }
 
 func (l *DebugLog) OnIncoming(data []byte) {
+	data = l.redactor.Redact(data)
 	l.logger.Printf("INCOMING: %s", string(data))
-	fmt.Printf("[%s] INCOMING: %s\n", l.name, string(data))
+	if l.stdout == StdoutAll {
+		logger.Info("FIXMessage", "session", l.name, KeyDirection, DirIn, "raw", string(data))
+	}
 }
 
 func (l *DebugLog) OnOutgoing(data []byte) {
+	data = l.redactor.Redact(data)
 	l.logger.Printf("OUTGOING: %s", string(data))
-	fmt.Printf("[%s] OUTGOING: %s\n", l.name, string(data))
+	if l.stdout == StdoutAll {
+		logger.Info("FIXMessage", "session", l.name, KeyDirection, DirOut, "raw", string(data))
+	}
 }
 
 func (l *DebugLog) OnEvent(msg string) {
+	msg = string(l.redactor.Redact([]byte(msg)))
 	l.logger.Printf("EVENT: %s", msg)
-	fmt.Printf("[%s] EVENT: %s\n", l.name, msg)
+	if l.stdout == StdoutEvents || l.stdout == StdoutAll {
+		logger.Info("FIXEvent", "session", l.name, "text", msg)
+	}
 }
 
 func (l *DebugLog) OnEventf(format string, v ...interface{}) {
@@ -79,8 +138,11 @@ func (l *DebugLog) OnEventf(format string, v ...interface{}) {
 }
 
 func (l *DebugLog) OnErrorEvent(msg string) {
+	msg = string(l.redactor.Redact([]byte(msg)))
 	l.logger.Printf("ERROR: %s", msg)
-	fmt.Printf("[%s] ERROR: %s\n", l.name, msg)
+	if l.stdout == StdoutEvents || l.stdout == StdoutAll {
+		logger.Error("FIXEvent", "session", l.name, "text", msg)
+	}
 }
 
 func (l *DebugLog) OnErrorEventf(format string, v ...interface{}) {
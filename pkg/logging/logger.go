@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+/* attribute keys shared across packages so that log queries work on one name */
+const (
+	KeySessionID = "session_id"
+	KeyClOrdID   = "cl_ord_id"
+	KeyOrderID   = "order_id"
+	KeyExecID    = "exec_id"
+	KeyHandle    = "handle"
+	KeySymbol    = "symbol"
+	KeyMDReqID   = "md_req_id"
+	KeyMsgType   = "msg_type"
+	KeyClientID  = "client_id"
+	KeyDirection = "dir"
+	KeyError     = "error"
+)
+
+/* values for KeyDirection on messages sent to and received from BCB */
+const (
+	DirIn  = "in"
+	DirOut = "out"
+)
+
+// Setup installs the default slog logger. format is "text" or "json" and
+// level one of debug, info, warn or error. Output from the standard log
+// package is routed through the same handler at info level.
+func Setup(w io.Writer, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Component returns a logger that tags records with component and writes
+// through whatever default logger is installed at the time of the call, so
+// it can be created in a package variable before Setup runs.
+func Component(component string) *slog.Logger {
+	return slog.New(&defaultHandler{attrs: []slog.Attr{slog.String("component", component)}})
+}
+
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+type defaultHandler struct {
+	attrs []slog.Attr
+}
+
+func (h *defaultHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (h *defaultHandler) Handle(ctx context.Context, record slog.Record) error {
+	return slog.Default().Handler().WithAttrs(h.attrs).Handle(ctx, record)
+}
+
+func (h *defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &defaultHandler{attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...)}
+}
+
+/* groups are rare; a grouped logger binds to the default handler at the time of the call */
+func (h *defaultHandler) WithGroup(name string) slog.Handler {
+	return slog.Default().Handler().WithAttrs(h.attrs).WithGroup(name)
+}
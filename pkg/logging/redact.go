@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"strconv"
+)
+
+const (
+	soh        = '\x01'
+	redactMask = "****"
+)
+
+// DefaultRedactTags are always masked: Password(554), NewPassword(925) and
+// RawData(96), which carries the logon signature.
+var DefaultRedactTags = []int{554, 925, 96}
+
+// DataLengthTags maps each FIX length field to the data field it sizes. Data
+// fields may contain SOH, so readers must skip them by the declared length.
+var DataLengthTags = map[int]int{
+	90:  91,  /* SecureDataLen -> SecureData */
+	95:  96,  /* RawDataLength -> RawData */
+	212: 213, /* XmlDataLen -> XmlData */
+	348: 349, /* EncodedIssuerLen */
+	350: 351, /* EncodedSecurityDescLen */
+	352: 353, /* EncodedListExecInstLen */
+	354: 355, /* EncodedTextLen */
+	356: 357, /* EncodedSubjectLen */
+	358: 359, /* EncodedHeadlineLen */
+	360: 361, /* EncodedAllocTextLen */
+	362: 363, /* EncodedUnderlyingIssuerLen */
+	364: 365, /* EncodedUnderlyingSecurityDescLen */
+	445: 446, /* EncodedListStatusTextLen */
+	618: 619, /* EncodedLegIssuerLen */
+	621: 622, /* EncodedLegSecurityDescLen */
+}
+
+// Redactor masks the values of sensitive tags in raw FIX messages. It walks
+// the message field by field so binary data fields are skipped by their
+// declared length rather than split at an embedded SOH.
+type Redactor struct {
+	tags map[int]bool
+}
+
+// NewRedactor masks DefaultRedactTags plus any extra tags given.
+func NewRedactor(extra []int) *Redactor {
+	tags := make(map[int]bool, len(DefaultRedactTags)+len(extra))
+	for _, t := range DefaultRedactTags {
+		tags[t] = true
+	}
+	for _, t := range extra {
+		tags[t] = true
+	}
+	return &Redactor{tags: tags}
+}
+
+// Redact returns data with sensitive values replaced by a fixed mask. Text
+// that does not parse as tag=value, such as the prefix of a session event,
+// is copied as is. data is never modified.
+func (r *Redactor) Redact(data []byte) []byte {
+	if r == nil || !r.mayContainTag(data) {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+	dataLen := map[int]int{}
+
+	for pos := 0; pos < len(data); {
+		end := bytes.IndexByte(data[pos:], soh)
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += pos
+		}
+
+		eq := bytes.IndexByte(data[pos:end], '=')
+		t := -1
+		if eq > 0 {
+			if parsed, err := strconv.Atoi(string(data[pos : pos+eq])); err == nil {
+				t = parsed
+			}
+		}
+
+		if t < 0 {
+			out = append(out, data[pos:end]...)
+		} else {
+			valueStart := pos + eq + 1
+
+			/* a data field runs for its declared length even across SOH bytes */
+			if n, ok := dataLen[t]; ok && valueStart+n <= len(data) && (valueStart+n == len(data) || data[valueStart+n] == soh) {
+				end = valueStart + n
+				delete(dataLen, t)
+			}
+
+			value := data[valueStart:end]
+			if dataTag, ok := DataLengthTags[t]; ok {
+				if n, err := strconv.Atoi(string(value)); err == nil && n >= 0 {
+					dataLen[dataTag] = n
+				}
+			}
+
+			out = append(out, data[pos:valueStart]...)
+			if r.tags[t] {
+				out = append(out, redactMask...)
+			} else {
+				out = append(out, value...)
+			}
+		}
+
+		if end < len(data) {
+			out = append(out, soh)
+		}
+		pos = end + 1
+	}
+
+	return out
+}
+
+/* cheap pre-check so ordinary messages are not copied */
+func (r *Redactor) mayContainTag(data []byte) bool {
+	for t := range r.tags {
+		needle := strconv.Itoa(t) + "="
+		if bytes.Contains(data, []byte(needle)) {
+			return true
+		}
+	}
+	return false
+}
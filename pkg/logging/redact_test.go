@@ -0,0 +1,217 @@
+package logging_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bcb-fix-microservice/pkg/auth"
+	"bcb-fix-microservice/pkg/journal"
+	"bcb-fix-microservice/pkg/logging"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+)
+
+/* fix turns a readable message with | delimiters into wire format */
+func fix(s string) string {
+	return strings.ReplaceAll(s, "|", "\x01")
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra []int
+		in    string
+		want  string
+	}{
+		{
+			name: "password",
+			in:   "35=A|553=user|554=secret|98=0|",
+			want: "35=A|553=user|554=****|98=0|",
+		},
+		{
+			name: "new password",
+			in:   "35=A|554=old|925=new|",
+			want: "35=A|554=****|925=****|",
+		},
+		{
+			name: "raw data without length",
+			in:   "35=A|96=c2lnbmF0dXJl|10=123|",
+			want: "35=A|96=****|10=123|",
+		},
+		{
+			name: "raw data with length",
+			in:   "35=A|95=12|96=c2lnbmF0dXJl|10=123|",
+			want: "35=A|95=12|96=****|10=123|",
+		},
+		{
+			name: "raw data containing SOH",
+			in:   "35=A|95=7|96=ab|cd|e|58=text|",
+			want: "35=A|95=7|96=****|58=text|",
+		},
+		{
+			name: "raw data at the end without trailing SOH",
+			in:   "35=A|95=5|96=ab|cd",
+			want: "35=A|95=5|96=****",
+		},
+		{
+			name:  "extra tags",
+			extra: []int{58, 1},
+			in:    "35=D|1=ACC-1|11=ord|58=note|554=pw|",
+			want:  "35=D|1=****|11=ord|58=****|554=****|",
+		},
+		{
+			name: "tags sharing a suffix",
+			in:   "35=A|1554=keep|10554=keep|5540=keep|554=secret|",
+			want: "35=A|1554=keep|10554=keep|5540=keep|554=****|",
+		},
+		{
+			name:  "extra tag sharing a suffix",
+			extra: []int{58},
+			in:    "35=8|158=1.5|58=note|",
+			want:  "35=8|158=1.5|58=****|",
+		},
+		{
+			name: "event text before the message",
+			in:   "Sending 8=FIX.4.4|35=A|554=secret|",
+			want: "Sending 8=FIX.4.4|35=A|554=****|",
+		},
+		{
+			name: "nothing to redact",
+			in:   "35=D|11=ord|55=BTC/BRL|",
+			want: "35=D|11=ord|55=BTC/BRL|",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := []byte(fix(tt.in))
+			original := string(in)
+
+			got := string(logging.NewRedactor(tt.extra).Redact(in))
+			if got != fix(tt.want) {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, strings.ReplaceAll(got, "\x01", "|"), tt.want)
+			}
+			if string(in) != original {
+				t.Errorf("Redact modified its input: %q", in)
+			}
+		})
+	}
+}
+
+func TestRedactNilRedactor(t *testing.T) {
+	var r *logging.Redactor
+
+	in := []byte(fix("35=A|554=secret|"))
+	if got := r.Redact(in); !bytes.Equal(got, in) {
+		t.Errorf("nil Redactor changed the message: %q", got)
+	}
+}
+
+func signedLogon(t *testing.T, sessionID quickfix.SessionID) (*quickfix.Message, string) {
+	t.Helper()
+
+	message := quickfix.NewMessage()
+	message.Header.SetString(tag.BeginString, sessionID.BeginString)
+	message.Header.SetString(tag.MsgType, "A")
+	message.Header.SetString(tag.SenderCompID, sessionID.SenderCompID)
+	message.Header.SetString(tag.TargetCompID, sessionID.TargetCompID)
+	message.Header.SetInt(tag.MsgSeqNum, 1)
+	message.Header.SetString(tag.SendingTime, "20260101-12:00:00.000")
+	message.Body.SetInt(tag.EncryptMethod, 0)
+	message.Body.SetInt(tag.HeartBtInt, 30)
+
+	if err := auth.SignLogonMessage(message, sessionID); err != nil {
+		t.Fatalf("SignLogonMessage: %v", err)
+	}
+
+	signature, err := message.Body.GetString(tag.RawData)
+	if err != nil || signature == "" {
+		t.Fatalf("signed logon has no RawData: %v", err)
+	}
+	return message, signature
+}
+
+func assertNoCredentials(t *testing.T, sink, text, signature string) {
+	t.Helper()
+
+	if text == "" {
+		t.Fatalf("%s is empty", sink)
+	}
+	if strings.Contains(text, auth.APIKey) {
+		t.Errorf("%s contains the API key: %q", sink, text)
+	}
+	if strings.Contains(text, signature) {
+		t.Errorf("%s contains the logon signature: %q", sink, text)
+	}
+}
+
+func TestSignedLogonIsRedactedEverywhere(t *testing.T) {
+	sessionID := quickfix.SessionID{BeginString: "FIX.4.4", SenderCompID: "CLIENT", TargetCompID: "BCB"}
+	message, signature := signedLogon(t, sessionID)
+	raw := message.Bytes()
+
+	if !bytes.Contains(raw, []byte(auth.APIKey)) || !bytes.Contains(raw, []byte(signature)) {
+		t.Fatalf("test message does not carry the credentials: %q", raw)
+	}
+
+	var stdout bytes.Buffer
+	previous := slog.Default()
+	if err := logging.Setup(&stdout, "info", "json"); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	dir := t.TempDir()
+	config := logging.DefaultFIXLogConfig()
+	config.Dir = dir
+	config.Stdout = logging.StdoutAll
+
+	file, err := logging.OpenRotatingFile(dir, "session", config)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+
+	debugLog := logging.NewDebugLog(file, "session", config.Stdout, nil)
+	debugLog.OnOutgoing(raw)
+	debugLog.OnEvent("Sending " + string(raw))
+	if err := debugLog.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	written, err := os.ReadFile(filepath.Join(dir, "session.log"))
+	if err != nil {
+		t.Fatalf("reading session log: %v", err)
+	}
+	assertNoCredentials(t, "session log", string(written), signature)
+	assertNoCredentials(t, "stdout", stdout.String(), signature)
+
+	j, err := journal.Open(filepath.Join(dir, "journal.db"), journal.DefaultConfig())
+	if err != nil {
+		t.Fatalf("journal.Open: %v", err)
+	}
+	j.Record(logging.DirOut, message, sessionID)
+	if err := j.Close(); err != nil {
+		t.Fatalf("journal.Close: %v", err)
+	}
+
+	/* reopened so that the asynchronous write is known to be on disk */
+	j, err = journal.Open(filepath.Join(dir, "journal.db"), journal.DefaultConfig())
+	if err != nil {
+		t.Fatalf("journal.Open: %v", err)
+	}
+	defer j.Close()
+
+	entries, _, err := j.List(journal.Query{MsgType: "A", From: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("journal.List: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("journal has %d logon entries, want 1", len(entries))
+	}
+	assertNoCredentials(t, "journal entry", entries[0].Raw, signature)
+}
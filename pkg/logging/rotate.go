@@ -0,0 +1,294 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logFileMode     = 0640
+	backupTimestamp = "20060102_150405.000"
+	/* files written before rotation existed carry a timestamp without milliseconds */
+	legacyTimestamp = "20060102_150405"
+)
+
+// RotatingFile is an io.Writer over <dir>/<name>.log that rolls the file over
+// once it reaches MaxSize bytes or has been open for RotateEvery. Rolled files
+// are renamed to <name>_<timestamp>.log, optionally gzipped, and pruned by
+// MaxBackups and MaxAge in the background.
+type RotatingFile struct {
+	dir    string
+	name   string
+	config FIXLogConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	/* serialises compress and prune so two rotations never race on the same backups */
+	mill sync.Mutex
+	wg   sync.WaitGroup
+}
+
+// OpenRotatingFile opens the active file for name, rolling over whatever a
+// previous run left behind so every process start begins with a fresh file.
+func OpenRotatingFile(dir, name string, config FIXLogConfig) (*RotatingFile, error) {
+	rf := &RotatingFile{dir: dir, name: name, config: config}
+
+	if info, err := os.Stat(rf.activePath()); err == nil && info.Size() > 0 {
+		if err := rf.roll(info.ModTime()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.shouldRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate rolls the active file over immediately.
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return os.ErrClosed
+	}
+	return rf.rotate()
+}
+
+// Close closes the active file and waits for pending compression to finish.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	var err error
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.mu.Unlock()
+
+	rf.wg.Wait()
+	return err
+}
+
+func (rf *RotatingFile) shouldRotate(n int64) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.config.MaxSize > 0 && rf.size+n > rf.config.MaxSize {
+		return true
+	}
+	return rf.config.RotateEvery > 0 && time.Since(rf.openedAt) >= rf.config.RotateEvery
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		logger.Warn("FIXLogClose", "file", rf.activePath(), Err(err))
+	}
+	rf.file = nil
+
+	rollErr := rf.roll(time.Now())
+
+	/* keep appending to the old file if the rename failed rather than dropping messages */
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if rollErr != nil {
+		logger.Error("FIXLogRotate", "file", rf.activePath(), Err(rollErr))
+	}
+	return nil
+}
+
+/* roll renames the active file to a timestamped backup and hands it to the background mill */
+func (rf *RotatingFile) roll(stamp time.Time) error {
+	backup := rf.backupPath(stamp)
+	for i := 1; fileExists(backup) || fileExists(backup+".gz"); i++ {
+		backup = rf.backupPath(stamp.Add(time.Duration(i) * time.Millisecond))
+	}
+
+	if err := os.Rename(rf.activePath(), backup); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %w", rf.activePath(), err)
+	}
+
+	logger.Debug("FIXLogRotated", "file", backup)
+
+	rf.wg.Add(1)
+	go func() {
+		defer rf.wg.Done()
+		rf.mill.Lock()
+		defer rf.mill.Unlock()
+
+		if rf.config.Compress {
+			if err := compressFile(backup); err != nil {
+				logger.Error("FIXLogCompress", "file", backup, Err(err))
+			}
+		}
+		rf.prune()
+	}()
+	return nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.activePath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFileMode)
+	if err != nil {
+		return fmt.Errorf("failed to create log file %s: %w", rf.activePath(), err)
+	}
+
+	/* OpenFile only applies the mode to new files, tighten files left by older builds */
+	if err := file.Chmod(logFileMode); err != nil {
+		logger.Warn("FIXLogChmod", "file", rf.activePath(), Err(err))
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", rf.activePath(), err)
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+func (rf *RotatingFile) activePath() string {
+	return filepath.Join(rf.dir, rf.name+".log")
+}
+
+func (rf *RotatingFile) backupPath(stamp time.Time) string {
+	return filepath.Join(rf.dir, fmt.Sprintf("%s_%s.log", rf.name, stamp.Format(backupTimestamp)))
+}
+
+type backupFile struct {
+	path  string
+	stamp time.Time
+}
+
+/* backups lists rolled files for this name, newest first */
+func (rf *RotatingFile) backups() []backupFile {
+	entries, err := os.ReadDir(rf.dir)
+	if err != nil {
+		logger.Warn("FIXLogList", "path", rf.dir, Err(err))
+		return nil
+	}
+
+	prefix := rf.name + "_"
+	var backups []backupFile
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(fileName, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(fileName, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if !strings.HasSuffix(stamp, ".log") {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ".log")
+
+		parsed, err := time.ParseInLocation(backupTimestamp, stamp, time.Local)
+		if err != nil {
+			if parsed, err = time.ParseInLocation(legacyTimestamp, stamp, time.Local); err != nil {
+				continue
+			}
+		}
+		backups = append(backups, backupFile{path: filepath.Join(rf.dir, fileName), stamp: parsed})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].stamp.After(backups[j].stamp) })
+	return backups
+}
+
+func (rf *RotatingFile) prune() {
+	cutoff := time.Time{}
+	if rf.config.MaxAge > 0 {
+		cutoff = time.Now().Add(-rf.config.MaxAge)
+	}
+
+	for i, backup := range rf.backups() {
+		expired := !cutoff.IsZero() && backup.stamp.Before(cutoff)
+		excess := rf.config.MaxBackups > 0 && i >= rf.config.MaxBackups
+		if !expired && !excess {
+			continue
+		}
+
+		if err := os.Remove(backup.path); err != nil {
+			logger.Warn("FIXLogPrune", "file", backup.path, Err(err))
+			continue
+		}
+		logger.Debug("FIXLogPruned", "file", backup.path)
+	}
+}
+
+/* compressFile gzips path to path.gz and removes the original once the copy is complete */
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, logFileMode)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
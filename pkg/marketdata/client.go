@@ -2,12 +2,14 @@ package marketdata
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"time"
 
 	"bcb-fix-microservice/pkg/bcb"
+	"bcb-fix-microservice/pkg/idgen"
 	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
 	"github.com/quickfixgo/enum"
 	"github.com/quickfixgo/field"
 	"github.com/quickfixgo/fix44/marketdatarequest"
@@ -16,16 +18,26 @@ import (
 	"github.com/quickfixgo/tag"
 )
 
+var logger = logging.Component("marketdata")
+
 type MarketDataClient struct {
 	*bcb.BCBApplication
-	initiator     *quickfix.Initiator
+	initiator *quickfix.Initiator
+	ids       *idgen.Generator
+	quotesMu  sync.RWMutex
+	quotes    map[string]Quote
+	listeners []QuoteListener
+
+	/* mu guards the subscription state, which API goroutines and the FIX goroutine both change */
+	mu            sync.Mutex
 	subscriptions map[string]string
-	quotes        map[string]Quote
 	subscribers   map[string]int
 	quoteChannels map[string]chan struct{}
 	subChannels   map[string]chan error
 }
 
+type QuoteListener func(quote Quote)
+
 type Quote struct {
 	Symbol    string    `json:"symbol"`
 	Bid       float64   `json:"bid"`
@@ -36,9 +48,10 @@ type Quote struct {
 	Stale     bool      `json:"stale"`
 }
 
-func NewMarketDataClient() *MarketDataClient {
+func NewMarketDataClient(ids *idgen.Generator) *MarketDataClient {
 	return &MarketDataClient{
-		BCBApplication: bcb.NewBCBApplication(),
+		BCBApplication: bcb.NewBCBApplication("marketdata"),
+		ids:            ids,
 		subscriptions:  make(map[string]string),
 		quotes:         make(map[string]Quote),
 		subscribers:    make(map[string]int),
@@ -60,7 +73,7 @@ func (client *MarketDataClient) Start(configFile string) error {
 	}
 
 	storeFactory := quickfix.NewMemoryStoreFactory()
-	logFactory := logging.NewDebugLogFactory("log")
+	logFactory := client.LogFactory()
 
 	client.initiator, err = quickfix.NewInitiator(client, storeFactory, cfg, logFactory)
 	if err != nil {
@@ -73,14 +86,14 @@ func (client *MarketDataClient) Start(configFile string) error {
 		return fmt.Errorf("failed to start initiator: %w", err)
 	}
 
-	log.Println("[EVENT (MarketDataClientStarted)]")
+	logger.Info("MarketDataClientStarted")
 	return nil
 }
 
 func (client *MarketDataClient) Stop() {
 	if client.initiator != nil {
 		client.initiator.Stop()
-		log.Println("[EVENT (MarketDataClientStopped)]")
+		logger.Info("MarketDataClientStopped")
 	}
 }
 
@@ -90,7 +103,7 @@ func (client *MarketDataClient) OnLogon(sessionID quickfix.SessionID) {
 	go func() {
 		time.Sleep(2 * time.Second)
 		if err := client.RequestSecurityList(); err != nil {
-			log.Printf("[ERROR (SecurityListRequestFailed)]: %v", err)
+			logger.Error("SecurityListRequestFailed", logging.KeySessionID, sessionID.String(), logging.Err(err))
 		}
 	}()
 }
@@ -99,18 +112,37 @@ func (client *MarketDataClient) RequestSecurityList() error {
 	message := quickfix.NewMessage()
 	message.Header.SetString(tag.MsgType, "x")
 
-	message.Body.SetString(tag.SecurityReqID, generateRequestID())
+	message.Body.SetString(tag.SecurityReqID, client.ids.Next(idgen.SecurityRequest))
 	message.Body.SetInt(tag.SecurityListRequestType, 4)
 
-	return quickfix.SendToTarget(message, client.GetSessionID())
+	return client.Send(message)
 }
 
 func (client *MarketDataClient) SubscribeToMarketData(symbol string) error {
-	if _, exists := client.subscriptions[symbol]; exists {
-		return fmt.Errorf("already subscribed to %s", symbol)
+	_, _, err := client.subscribe(symbol)
+	return err
+}
+
+/* subscribe returns the MDReqID and the channel that receives the outcome of the request */
+func (client *MarketDataClient) subscribe(symbol string) (string, chan error, error) {
+	sessionID := client.GetSessionID()
+	if sessionID.SenderCompID == "" || sessionID.TargetCompID == "" {
+		return "", nil, fmt.Errorf("no active session")
 	}
 
-	mdReqID := generateRequestID()
+	mdReqID := client.ids.Next(idgen.MDRequest)
+
+	/* registered before sending so that a fast response always finds it */
+	client.mu.Lock()
+	if _, exists := client.subscriptions[symbol]; exists {
+		client.mu.Unlock()
+		return "", nil, fmt.Errorf("already subscribed to %s", symbol)
+	}
+	done := make(chan error, 1)
+	client.subChannels[symbol] = done
+	client.subscriptions[symbol] = mdReqID
+	client.recordSubscriptionsLocked()
+	client.mu.Unlock()
 
 	mdReq := marketdatarequest.New(
 		field.NewMDReqID(mdReqID),
@@ -138,46 +170,54 @@ func (client *MarketDataClient) SubscribeToMarketData(symbol string) error {
 
 	msg.Body.SetInt(1070, 1)
 
-	log.Printf("[SEND (MarketDataRequest)]: symbol=%s", symbol)
+	logger.Info("MarketDataRequest", logging.KeyDirection, logging.DirOut, logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID)
 
-	sessionID := client.GetSessionID()
-	if sessionID.SenderCompID == "" || sessionID.TargetCompID == "" {
-		return fmt.Errorf("no active session")
+	if err := client.Send(msg); err != nil {
+		client.dropSubscription(symbol, mdReqID)
+		return "", nil, fmt.Errorf("failed to subscribe to %s: %w", symbol, err)
 	}
 
-	if err := quickfix.SendToTarget(msg, sessionID); err != nil {
-		return fmt.Errorf("failed to subscribe to %s: %w", symbol, err)
-	}
+	logger.Info("MarketDataRequestSent", logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID)
+	return mdReqID, done, nil
+}
 
-	client.subChannels[symbol] = make(chan error, 1)
-	client.subscriptions[symbol] = mdReqID
-	log.Printf("[EVENT (MarketDataRequestSent)]: %s", symbol)
-	return nil
+/* dropSubscription forgets symbol unless it has been subscribed again under another MDReqID */
+func (client *MarketDataClient) dropSubscription(symbol, mdReqID string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.subscriptions[symbol] != mdReqID {
+		return
+	}
+	delete(client.subscriptions, symbol)
+	delete(client.subChannels, symbol)
+	client.recordSubscriptionsLocked()
 }
 
 func (client *MarketDataClient) SubscribeToMarketDataWithWait(symbol string, timeout time.Duration) error {
-	if err := client.SubscribeToMarketData(symbol); err != nil {
+	mdReqID, done, err := client.subscribe(symbol)
+	if err != nil {
 		return err
 	}
 
 	select {
-	case err := <-client.subChannels[symbol]:
+	case err := <-done:
 		if err != nil {
-			delete(client.subscriptions, symbol)
-			delete(client.subChannels, symbol)
+			client.dropSubscription(symbol, mdReqID)
 			return err
 		}
-		log.Printf("[EVENT (MarketDataSubscribed)]: %s", symbol)
+		logger.Info("MarketDataSubscribed", logging.KeySymbol, symbol)
 		return nil
 	case <-time.After(timeout):
-		delete(client.subscriptions, symbol)
-		delete(client.subChannels, symbol)
+		client.dropSubscription(symbol, mdReqID)
 		return fmt.Errorf("timeout waiting for subscription confirmation for %s", symbol)
 	}
 }
 
 func (client *MarketDataClient) UnsubscribeFromMarketData(symbol string) error {
+	client.mu.Lock()
 	mdReqID, ok := client.subscriptions[symbol]
+	client.mu.Unlock()
 
 	if !ok {
 		return fmt.Errorf("not subscribed to %s", symbol)
@@ -206,20 +246,20 @@ func (client *MarketDataClient) UnsubscribeFromMarketData(symbol string) error {
 	msg := mdReq.ToMessage()
 	msg.Body.SetInt(1070, 1)
 
-	log.Printf("[SEND (MarketDataRequest UNSUBSCRIBE)]: symbol=%s mdReqID=%s", symbol, mdReqID)
+	logger.Info("MarketDataUnsubscribeRequest", logging.KeyDirection, logging.DirOut, logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID)
 
 	sessionID := client.GetSessionID()
 	if sessionID.SenderCompID == "" || sessionID.TargetCompID == "" {
 		return fmt.Errorf("no active session")
 	}
 
-	if err := quickfix.SendToTarget(msg, sessionID); err != nil {
+	if err := client.Send(msg); err != nil {
 		return fmt.Errorf("failed to unsubscribe from %s: %w", symbol, err)
 	}
 
-	delete(client.subscriptions, symbol)
+	client.dropSubscription(symbol, mdReqID)
 
-	log.Printf("[EVENT (MarketDataUnsubscribed)]: %s (mdReqID=%s)", symbol, mdReqID)
+	logger.Info("MarketDataUnsubscribed", logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID)
 	return nil
 }
 
@@ -231,6 +271,8 @@ func (client *MarketDataClient) FromApp(message *quickfix.Message, sessionID qui
 			msgType, _ = message.Body.GetString(35)
 		}
 	}
+	client.RecordInbound(msgType)
+	client.JournalInbound(message, sessionID)
 
 	switch msgType {
 	case "W":
@@ -253,14 +295,18 @@ func (client *MarketDataClient) handleMarketDataSnapshot(message *quickfix.Messa
 	mdReqID, _ := snapshot.GetMDReqID()
 	noMDEntries, _ := snapshot.GetNoMDEntries()
 
-	log.Printf("[RECEIVE (MarketDataSnapshot)]: %s (ReqID: %s, Entries: %d)", symbol, mdReqID, noMDEntries)
+	logger.Debug("MarketDataSnapshot", logging.KeyDirection, logging.DirIn, logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID, "entries", noMDEntries.Len())
+
+	/* listeners run without the lock, they may subscribe themselves */
+	client.mu.Lock()
 
 	if noMDEntries.Len() == 0 {
-		log.Printf("[WARNING] No market data available for symbol: %s (ReqID: %s)", symbol, mdReqID)
+		logger.Warn("MarketDataEmpty", logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID)
 
 		if reqID, exists := client.subscriptions[symbol]; exists && reqID == mdReqID {
 			delete(client.subscriptions, symbol)
-			log.Printf("[EVENT (MarketDataSubscriptionRemoved)]: %s - Symbol not found", symbol)
+			client.recordSubscriptionsLocked()
+			logger.Info("MarketDataSubscriptionRemoved", logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID, "reason", "symbol not found")
 
 			if ch, exists := client.subChannels[symbol]; exists {
 				select {
@@ -271,13 +317,8 @@ func (client *MarketDataClient) handleMarketDataSnapshot(message *quickfix.Messa
 			}
 		}
 
-		if ch, exists := client.quoteChannels[symbol]; exists {
-			select {
-			case ch <- struct{}{}:
-			default:
-			}
-		}
-
+		client.notifyQuoteLocked(symbol)
+		client.mu.Unlock()
 		return
 	}
 
@@ -288,6 +329,7 @@ func (client *MarketDataClient) handleMarketDataSnapshot(message *quickfix.Messa
 		}
 		delete(client.subChannels, symbol)
 	}
+	client.mu.Unlock()
 
 	client.parseAndStoreQuotes(snapshot, symbol)
 }
@@ -329,21 +371,35 @@ func (client *MarketDataClient) parseAndStoreQuotes(snapshot marketdatasnapshotf
 			Stale:     false,
 		}
 
+		client.quotesMu.Lock()
 		hadQuote := client.quotes[symbol].Symbol != ""
-
 		client.quotes[symbol] = quote
+		client.quotesMu.Unlock()
+
+		metrics.QuoteUpdates.WithLabelValues(symbol).Inc()
 
 		if !hadQuote {
-			if ch, exists := client.quoteChannels[symbol]; exists {
-				select {
-				case ch <- struct{}{}:
-				default:
-				}
-			}
+			client.mu.Lock()
+			client.notifyQuoteLocked(symbol)
+			client.mu.Unlock()
 		}
 
-		log.Printf("[STORE (Quote)]: %s - Bid: %.6f, Ask: %.6f, Last: %.6f, Size: %.6f",
-			symbol, bid, ask, last, size)
+		logger.Debug("QuoteStored", logging.KeySymbol, symbol,
+			"bid", bid, "ask", ask, "last", last, "size", size)
+
+		for _, listener := range client.listeners {
+			listener(quote)
+		}
+	}
+}
+
+/* notifyQuoteLocked wakes a GetQuotesWithWait call waiting for symbol */
+func (client *MarketDataClient) notifyQuoteLocked(symbol string) {
+	if ch, exists := client.quoteChannels[symbol]; exists {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
 	}
 }
 
@@ -352,11 +408,11 @@ func (client *MarketDataClient) handleSecurityListResponse(message *quickfix.Mes
 	secResponseID, _ := message.Body.GetString(tag.SecurityResponseID)
 	result, _ := message.Body.GetInt(tag.SecurityRequestResult)
 
-	log.Printf("[RECEIVE (SecurityListResponse)]: ReqID=%s, ResponseID=%s, Result=%d", secReqID, secResponseID, result)
+	logger.Info("SecurityListResponse", logging.KeyDirection, logging.DirIn, "security_req_id", secReqID, "security_response_id", secResponseID, "result", result)
 
 	if result == 0 {
 		noRelatedSym, _ := message.Body.GetInt(tag.NoRelatedSym)
-		log.Printf("[RECEIVE (InstrumentsCount)]: %d", noRelatedSym)
+		logger.Info("InstrumentsCount", "count", noRelatedSym)
 
 		// TODO
 	}
@@ -366,12 +422,16 @@ func (client *MarketDataClient) handleMarketDataReject(message *quickfix.Message
 	mdReqID, _ := message.Body.GetString(tag.MDReqID)
 	text, _ := message.Body.GetString(tag.Text)
 
-	log.Printf("[RECEIVE (MarketDataRequestRejected)]: ReqID=%s, Reason=%s", mdReqID, text)
+	logger.Warn("MarketDataRequestRejected", logging.KeyDirection, logging.DirIn, logging.KeyMDReqID, mdReqID, "reason", text)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
 
 	for symbol, reqID := range client.subscriptions {
 		if reqID == mdReqID {
 			delete(client.subscriptions, symbol)
-			log.Printf("[EVENT (MarketDataSubscriptionRemoved)]: %s - Request rejected", symbol)
+			client.recordSubscriptionsLocked()
+			logger.Info("MarketDataSubscriptionRemoved", logging.KeySymbol, symbol, logging.KeyMDReqID, mdReqID, "reason", "request rejected")
 
 			if ch, exists := client.subChannels[symbol]; exists {
 				select {
@@ -381,12 +441,7 @@ func (client *MarketDataClient) handleMarketDataReject(message *quickfix.Message
 				delete(client.subChannels, symbol)
 			}
 
-			if ch, exists := client.quoteChannels[symbol]; exists {
-				select {
-				case ch <- struct{}{}:
-				default:
-				}
-			}
+			client.notifyQuoteLocked(symbol)
 			break
 		}
 	}
@@ -434,71 +489,119 @@ func (client *MarketDataClient) GetQuotes(symbols []string) map[string]*Quote {
 func (client *MarketDataClient) GetQuotesWithWait(symbols []string, timeout time.Duration) map[string]*Quote {
 	result := make(map[string]*Quote)
 	waitingSymbols := make([]string, 0)
+	waiting := make(map[string]chan struct{})
 
-	log.Printf("[DEBUG] GetQuotesWithWait called for symbols: %v", symbols)
+	client.retain(symbols)
 
 	for _, symbol := range symbols {
-		client.subscribers[symbol]++
-
-		if _, exists := client.subscriptions[symbol]; !exists {
-			log.Printf("[DEBUG] No subscription for %s, creating one", symbol)
-			go client.SubscribeToMarketData(symbol)
-		} else {
-			log.Printf("[DEBUG] Subscription exists for %s", symbol)
+		/* the channel exists before the quote is looked up so that a quote arriving in between still wakes us */
+		client.mu.Lock()
+		ch, exists := client.quoteChannels[symbol]
+		if !exists {
+			ch = make(chan struct{}, 1)
+			client.quoteChannels[symbol] = ch
 		}
+		client.mu.Unlock()
 
-		if quote, exists := client.quotes[symbol]; exists {
-			if time.Since(quote.Timestamp) > 90*time.Second {
-				quote.Stale = true
-				log.Printf("[DEBUG] Quote for %s is stale", symbol)
-			}
-
-			log.Printf("[DEBUG] Found existing quote for %s: Bid=%.6f, Ask=%.6f, Last=%.6f", symbol, quote.Bid, quote.Ask, quote.Last)
-			result[symbol] = &quote
+		if quote, exists := client.GetQuote(symbol); exists {
+			result[symbol] = quote
 		} else {
-			if _, exists := client.quoteChannels[symbol]; !exists {
-				client.quoteChannels[symbol] = make(chan struct{}, 1)
-			}
-
+			waiting[symbol] = ch
 			waitingSymbols = append(waitingSymbols, symbol)
-			log.Printf("[DEBUG] No quote found for %s, will wait for first data", symbol)
 		}
 	}
 
 	if len(waitingSymbols) > 0 {
-		log.Printf("[DEBUG] Waiting for quotes for symbols: %v", waitingSymbols)
-
 		timeoutCh := time.After(timeout)
 
 		for _, symbol := range waitingSymbols {
 			select {
-			case <-client.quoteChannels[symbol]:
+			case <-waiting[symbol]:
+				client.mu.Lock()
+				_, subscribed := client.subscriptions[symbol]
+				client.mu.Unlock()
+
 				// Проверяем, есть ли подписка - если нет, значит символ не найден
-				if _, exists := client.subscriptions[symbol]; !exists {
-					log.Printf("[DEBUG] Symbol %s not found (subscription removed)", symbol)
+				if !subscribed {
 					result[symbol] = nil
-				} else if quote, exists := client.quotes[symbol]; exists {
-					log.Printf("[DEBUG] Received quote for %s: Bid=%.6f, Ask=%.6f, Last=%.6f", symbol, quote.Bid, quote.Ask, quote.Last)
-					result[symbol] = &quote
+				} else if quote, exists := client.GetQuote(symbol); exists {
+					result[symbol] = quote
 				} else {
-					log.Printf("[DEBUG] Channel notified but no quote found for %s", symbol)
 					result[symbol] = nil
 				}
 			case <-timeoutCh:
-				log.Printf("[DEBUG] Timeout waiting for quotes for %s", symbol)
 				result[symbol] = nil
 			}
 		}
 	}
 
-	log.Printf("[DEBUG] Returning quotes with wait: %+v", result)
+	logger.Debug("QuotesServed", "symbols", symbols, "waited", waitingSymbols)
 	return result
 }
 
+func (client *MarketDataClient) GetQuote(symbol string) (*Quote, bool) {
+	client.quotesMu.RLock()
+	quote, exists := client.quotes[symbol]
+	client.quotesMu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	if time.Since(quote.Timestamp) > 90*time.Second {
+		quote.Stale = true
+	}
+	return &quote, true
+}
+
+// ReferenceQuote returns the current quote for symbol, subscribing and waiting
+// up to timeout if none has been received yet.
+func (client *MarketDataClient) ReferenceQuote(symbol string, timeout time.Duration) (*Quote, bool) {
+	if quote, exists := client.GetQuote(symbol); exists {
+		return quote, true
+	}
+
+	quotes := client.GetQuotesWithWait([]string{symbol}, timeout)
+	client.ReleaseQuotes([]string{symbol})
+
+	quote := quotes[symbol]
+	return quote, quote != nil
+}
+
+// AddQuoteListener registers a callback for every stored quote update. It is
+// invoked on the FIX session goroutine and must not block.
+func (client *MarketDataClient) AddQuoteListener(listener QuoteListener) {
+	client.listeners = append(client.listeners, listener)
+}
+
+// RetainQuotes keeps symbols subscribed until a matching ReleaseQuotes call,
+// without waiting for the first quote.
+func (client *MarketDataClient) RetainQuotes(symbols []string) {
+	client.retain(symbols)
+}
+
+func (client *MarketDataClient) retain(symbols []string) {
+	for _, symbol := range symbols {
+		client.mu.Lock()
+		client.subscribers[symbol]++
+		metrics.Subscribers.WithLabelValues(symbol).Set(float64(client.subscribers[symbol]))
+		_, subscribed := client.subscriptions[symbol]
+		client.mu.Unlock()
+
+		if !subscribed {
+			go client.SubscribeToMarketData(symbol)
+		}
+	}
+}
+
 func (client *MarketDataClient) ReleaseQuotes(symbols []string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
 	for _, symbol := range symbols {
 		if count, exists := client.subscribers[symbol]; exists && count > 0 {
 			client.subscribers[symbol]--
+			metrics.Subscribers.WithLabelValues(symbol).Set(float64(client.subscribers[symbol]))
 
 			if client.subscribers[symbol] == 0 {
 				go client.scheduleUnsubscribe(symbol)
@@ -510,12 +613,33 @@ func (client *MarketDataClient) ReleaseQuotes(symbols []string) {
 func (client *MarketDataClient) scheduleUnsubscribe(symbol string) {
 	time.Sleep(60 * time.Second)
 
-	if count, exists := client.subscribers[symbol]; exists && count == 0 {
-		client.UnsubscribeFromMarketData(symbol)
+	client.mu.Lock()
+	count, exists := client.subscribers[symbol]
+	idle := exists && count == 0
+	if idle {
 		delete(client.subscribers, symbol)
+		metrics.Subscribers.DeleteLabelValues(symbol)
+	}
+	client.mu.Unlock()
+
+	if idle {
+		client.UnsubscribeFromMarketData(symbol)
 	}
 }
 
-func generateRequestID() string {
-	return fmt.Sprintf("req-%d", time.Now().UnixNano())
+/* recordSubscriptionsLocked must be called with mu held */
+func (client *MarketDataClient) recordSubscriptionsLocked() {
+	metrics.Subscriptions.Set(float64(len(client.subscriptions)))
+}
+
+// QuoteTimes returns the time of the last quote update per symbol.
+func (client *MarketDataClient) QuoteTimes() map[string]time.Time {
+	client.quotesMu.RLock()
+	defer client.quotesMu.RUnlock()
+
+	times := make(map[string]time.Time, len(client.quotes))
+	for symbol, quote := range client.quotes {
+		times[symbol] = quote.Timestamp
+	}
+	return times
 }
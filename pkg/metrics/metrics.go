@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bcb"
+
+/* session state values for bcb_fix_session_state */
+const (
+	SessionDisconnected = 0
+	SessionConnected    = 1
+	SessionLoggedOn     = 2
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	SessionState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "fix_session_state",
+		Help:      "FIX session state: 0 disconnected, 1 connected, 2 logged on.",
+	}, []string{"session"})
+
+	Logons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fix_logons_total",
+		Help:      "Successful FIX logons.",
+	}, []string{"session"})
+
+	LogonFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fix_logon_failures_total",
+		Help:      "Failed FIX logon attempts.",
+	}, []string{"session"})
+
+	Logouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fix_logouts_total",
+		Help:      "FIX logouts and disconnects after logon.",
+	}, []string{"session"})
+
+	Messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fix_messages_total",
+		Help:      "FIX messages by session, direction (in/out) and MsgType.",
+	}, []string{"session", "direction", "msg_type"})
+
+	ThrottledMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fix_throttled_messages_total",
+		Help:      "Outbound FIX messages delayed (queued) or refused (rejected) by the throttle.",
+	}, []string{"session", "outcome"})
+
+	AckLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "order_ack_latency_seconds",
+		Help:      "Time from sending a NewOrderSingle to its first execution report.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	FillLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "order_fill_latency_seconds",
+		Help:      "Time from sending a NewOrderSingle to its first fill and to the complete fill.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"fill"})
+
+	Rejects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejects_total",
+		Help:      "Rejections by source (order, cancel, business, session, risk, halted) and reason code.",
+	}, []string{"source", "reason"})
+
+	QuoteUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quote_updates_total",
+		Help:      "Market data quote updates stored per symbol.",
+	}, []string{"symbol"})
+
+	Subscriptions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "md_subscriptions",
+		Help:      "Active market data subscriptions.",
+	})
+
+	Subscribers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "md_subscribers",
+		Help:      "Subscriber reference count per symbol.",
+	}, []string{"symbol"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_rate_limited_total",
+		Help:      "API requests refused with 429 by endpoint class.",
+	}, []string{"class"})
+
+	JournalBlocked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "journal_blocked_total",
+		Help:      "Messages that waited for room in the full journal queue.",
+	})
+
+	JournalBlockedSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "journal_blocked_seconds_total",
+		Help:      "Time FIX session goroutines spent waiting on the full journal queue.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SessionState, Logons, LogonFailures, Logouts, Messages, ThrottledMessages,
+		AckLatency, FillLatency, Rejects,
+		QuoteUpdates, Subscriptions, Subscribers,
+		HTTPDuration, RateLimited,
+		JournalBlocked, JournalBlockedSeconds,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RegisterQuoteAges exports the age of the last quote per symbol, computed at
+// scrape time from ages.
+func RegisterQuoteAges(ages func() map[string]time.Time) {
+	registry.MustRegister(&quoteAgeCollector{ages: ages})
+}
+
+var quoteAgeDesc = prometheus.NewDesc(
+	namespace+"_quote_age_seconds",
+	"Seconds since the last quote update per symbol.",
+	[]string{"symbol"}, nil,
+)
+
+type quoteAgeCollector struct {
+	ages func() map[string]time.Time
+}
+
+func (c *quoteAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- quoteAgeDesc
+}
+
+func (c *quoteAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for symbol, updated := range c.ages() {
+		ch <- prometheus.MustNewConstMetric(quoteAgeDesc, prometheus.GaugeValue, now.Sub(updated).Seconds(), symbol)
+	}
+}
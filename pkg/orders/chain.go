@@ -0,0 +1,252 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrOrderNotOpen     = errors.New("order is no longer open")
+	ErrPendingRequest   = errors.New("order already has a pending cancel/replace")
+	ErrDuplicateClOrdID = errors.New("duplicate ClOrdID")
+)
+
+const (
+	PendingCancel  = "cancel"
+	PendingReplace = "replace"
+)
+
+type PendingRequest struct {
+	Action         string    `json:"action"`
+	ClOrdID        string    `json:"cl_ord_id"`
+	PreviousStatus string    `json:"previous_status"`
+	OrderQty       float64   `json:"order_qty,omitempty"`
+	Price          float64   `json:"price,omitempty"`
+	OrdType        string    `json:"ord_type,omitempty"`
+	TimeInForce    string    `json:"time_in_force,omitempty"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+type CancelReject struct {
+	ClOrdID    string    `json:"cl_ord_id"`
+	ResponseTo string    `json:"response_to"`
+	Reason     string    `json:"reason"`
+	ReasonText string    `json:"reason_text"`
+	Text       string    `json:"text,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+/* 6 - pending cancel, E - pending replace */
+func (p *PendingRequest) displayStatus() string {
+	if p.Action == PendingCancel {
+		return "6"
+	}
+	return "E"
+}
+
+// chainIndex maps every ClOrdID and OrderID ever used by an order to the
+// order's stable handle (its first ClOrdID).
+type chainIndex struct {
+	clOrdIDs map[string]string
+	orderIDs map[string]string
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		clOrdIDs: make(map[string]string),
+		orderIDs: make(map[string]string),
+	}
+}
+
+func (c *chainIndex) addOrder(order *OrderInfo) {
+	c.clOrdIDs[order.Handle] = order.Handle
+	for _, clOrdID := range order.ClOrdIDChain {
+		c.clOrdIDs[clOrdID] = order.Handle
+	}
+	if order.Pending != nil {
+		c.clOrdIDs[order.Pending.ClOrdID] = order.Handle
+	}
+	if order.OrderID != "" {
+		c.orderIDs[order.OrderID] = order.Handle
+	}
+}
+
+func (c *chainIndex) removeOrder(order *OrderInfo) {
+	for _, clOrdID := range order.ClOrdIDChain {
+		delete(c.clOrdIDs, clOrdID)
+	}
+	delete(c.clOrdIDs, order.Handle)
+}
+
+func (c *chainIndex) addClOrdID(clOrdID, handle string) {
+	c.clOrdIDs[clOrdID] = handle
+}
+
+func (c *chainIndex) addOrderID(orderID, handle string) {
+	c.orderIDs[orderID] = handle
+}
+
+func (c *chainIndex) resolve(id string) (string, bool) {
+	if handle, exists := c.clOrdIDs[id]; exists {
+		return handle, true
+	}
+	if handle, exists := c.orderIDs[id]; exists {
+		return handle, true
+	}
+	return "", false
+}
+
+func (c *chainIndex) resolveAny(clOrdID, origClOrdID, orderID string) (string, bool) {
+	for _, id := range []string{clOrdID, origClOrdID} {
+		if id == "" {
+			continue
+		}
+		if handle, exists := c.clOrdIDs[id]; exists {
+			return handle, true
+		}
+	}
+	if orderID != "" {
+		if handle, exists := c.orderIDs[orderID]; exists {
+			return handle, true
+		}
+	}
+	return "", false
+}
+
+func (order *OrderInfo) clone() *OrderInfo {
+	snapshot := *order
+	snapshot.ClOrdIDChain = append([]string(nil), order.ClOrdIDChain...)
+	snapshot.History = append([]StateTransition(nil), order.History...)
+	snapshot.Anomalies = append([]Anomaly(nil), order.Anomalies...)
+	if order.Pending != nil {
+		pending := *order.Pending
+		snapshot.Pending = &pending
+	}
+	if order.CancelReject != nil {
+		reject := *order.CancelReject
+		snapshot.CancelReject = &reject
+	}
+	return &snapshot
+}
+
+func (order *OrderInfo) IsTerminal() bool {
+	switch order.Status {
+	case "2", "4", "8", "C":
+		return true
+	}
+	return false
+}
+
+func (client *OrdersClient) beginPendingLocked(id, newClOrdID, action string, params *OrderInfo) (*OrderInfo, error) {
+	handle, exists := client.chain.resolve(id)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+
+	if _, taken := client.chain.resolve(newClOrdID); taken {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateClOrdID, newClOrdID)
+	}
+
+	order := client.orders[handle]
+	if order.IsTerminal() {
+		return nil, fmt.Errorf("%w: %s (status %s)", ErrOrderNotOpen, handle, order.Status)
+	}
+	if order.Pending != nil {
+		return nil, fmt.Errorf("%w: %s (%s %s)", ErrPendingRequest, handle, order.Pending.Action, order.Pending.ClOrdID)
+	}
+
+	pending := &PendingRequest{
+		Action:         action,
+		ClOrdID:        newClOrdID,
+		PreviousStatus: order.Status,
+		SentAt:         time.Now().UTC(),
+	}
+	if params != nil {
+		pending.OrderQty = params.OrderQty
+		pending.Price = params.Price
+		pending.OrdType = params.OrdType
+		pending.TimeInForce = params.TimeInForce
+	}
+
+	order.Pending = pending
+	order.Status = pending.displayStatus()
+	client.recordTransitionLocked(order, pending.PreviousStatus, "", "", action+" requested")
+	client.chain.addClOrdID(newClOrdID, handle)
+	client.saveOrder(order)
+
+	return order, nil
+}
+
+func (client *OrdersClient) abortPending(handle string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	order, exists := client.orders[handle]
+	if !exists || order.Pending == nil {
+		return
+	}
+
+	delete(client.chain.clOrdIDs, order.Pending.ClOrdID)
+	previousStatus := order.Status
+	order.Status = order.Pending.PreviousStatus
+	order.Pending = nil
+	client.recordTransitionLocked(order, previousStatus, "", "", "send failed")
+	client.saveOrder(order)
+}
+
+func (client *OrdersClient) applyReplaceLocked(order *OrderInfo, clOrdID, origClOrdID string, orderQty, price float64) {
+	if order.Pending != nil && order.Pending.ClOrdID == clOrdID {
+		order.OrderQty = order.Pending.OrderQty
+		order.Price = order.Pending.Price
+		if order.Pending.OrdType != "" {
+			order.OrdType = order.Pending.OrdType
+		}
+		if order.Pending.TimeInForce != "" {
+			order.TimeInForce = order.Pending.TimeInForce
+		}
+	}
+
+	if orderQty > 0 {
+		order.OrderQty = orderQty
+	}
+	if price > 0 {
+		order.Price = price
+	}
+
+	if clOrdID != "" && clOrdID != order.ClOrdID {
+		order.OrigClOrdID = order.ClOrdID
+		if origClOrdID != "" {
+			order.OrigClOrdID = origClOrdID
+		}
+		order.ClOrdID = clOrdID
+		order.ClOrdIDChain = append(order.ClOrdIDChain, clOrdID)
+		client.chain.addClOrdID(clOrdID, order.Handle)
+	}
+
+	order.Pending = nil
+}
+
+func cancelRejectReasonText(reason string) string {
+	switch reason {
+	case "0":
+		return "Too late to cancel"
+	case "1":
+		return "Unknown order"
+	case "2":
+		return "Broker/Exchange option"
+	case "3":
+		return "Order already in Pending Cancel or Pending Replace status"
+	case "4":
+		return "Unable to process Order Mass Cancel Request"
+	case "5":
+		return "OrigOrdModTime did not match last TransactTime of order"
+	case "6":
+		return "Duplicate ClOrdID received"
+	case "99":
+		return "Other"
+	default:
+		return ""
+	}
+}
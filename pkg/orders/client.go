@@ -1,70 +1,175 @@
 package orders
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"bcb-fix-microservice/pkg/bcb"
+	"bcb-fix-microservice/pkg/idgen"
 	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
+	"bcb-fix-microservice/pkg/store"
+	"bcb-fix-microservice/pkg/tracing"
 	"github.com/quickfixgo/quickfix"
 	"github.com/quickfixgo/tag"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var logger = logging.Component("orders")
+
 type OrdersClient struct {
 	*bcb.BCBApplication
 	initiator  *quickfix.Initiator
+	store      *store.Store
+	ids        *idgen.Generator
+	mu         sync.RWMutex
 	orders     map[string]*OrderInfo
 	executions map[string][]*ExecutionInfo
+	chain      *chainIndex
+	preTrade   PreTradeCheck
+
+	/* held from the pre-trade check until the order is registered, so concurrent checks see each other's orders */
+	preTradeMu sync.Mutex
+
+	/* listeners are added from other goroutines while the FIX goroutine emits */
+	listenersMu sync.RWMutex
+	listeners   []OrderListener
+
+	seenExecIDs    map[string]bool
+	statusRequests map[string]*statusCollector
+	massCancels    map[string]chan massCancelReport
+	killSwitch     KillSwitchState
+	rfqs           map[string]*RFQ
+	rfqWaiters     map[string]chan struct{}
+	traces         map[string]*orderTrace
 }
 
 type OrderInfo struct {
-	ClOrdID      string    `json:"cl_ord_id"`
-	OrderID      string    `json:"order_id"`
-	Symbol       string    `json:"symbol"`
-	Side         string    `json:"side"`
-	OrderQty     float64   `json:"order_qty"`
-	Price        float64   `json:"price"`
-	OrdType      string    `json:"ord_type"`
-	TimeInForce  string    `json:"time_in_force"`
-	Status       string    `json:"status"`
-	ExecType     string    `json:"exec_type"`
-	CumQty       float64   `json:"cum_qty"`
-	LeavesQty    float64   `json:"leaves_qty"`
-	AvgPx        float64   `json:"avg_px"`
-	LastPx       float64   `json:"last_px"`
-	LastQty      float64   `json:"last_qty"`
-	Commission   float64   `json:"commission"`
-	TransactTime time.Time `json:"transact_time"`
-	LastExecTime time.Time `json:"last_exec_time"`
-	RejectReason string    `json:"reject_reason"`
+	Handle         string            `json:"handle"`
+	ClOrdID        string            `json:"cl_ord_id"`
+	OrigClOrdID    string            `json:"orig_cl_ord_id,omitempty"`
+	ClOrdIDChain   []string          `json:"cl_ord_id_chain"`
+	OrderID        string            `json:"order_id"`
+	Symbol         string            `json:"symbol"`
+	Side           string            `json:"side"`
+	OrderQty       float64           `json:"order_qty"`
+	Price          float64           `json:"price"`
+	OrdType        string            `json:"ord_type"`
+	TimeInForce    string            `json:"time_in_force"`
+	Status         string            `json:"status"`
+	ExecType       string            `json:"exec_type"`
+	CumQty         float64           `json:"cum_qty"`
+	LeavesQty      float64           `json:"leaves_qty"`
+	AvgPx          float64           `json:"avg_px"`
+	LastPx         float64           `json:"last_px"`
+	LastQty        float64           `json:"last_qty"`
+	Commission     float64           `json:"commission"`
+	TransactTime   time.Time         `json:"transact_time"`
+	LastExecTime   time.Time         `json:"last_exec_time"`
+	RejectReason   string            `json:"reject_reason"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	QuoteID        string            `json:"quote_id,omitempty"`
+	ClientID       string            `json:"client_id,omitempty"`
+	Pending        *PendingRequest   `json:"pending,omitempty"`
+	CancelReject   *CancelReject     `json:"cancel_reject,omitempty"`
+	History        []StateTransition `json:"history,omitempty"`
+	Anomalies      []Anomaly         `json:"anomalies,omitempty"`
 }
 
 type ExecutionInfo struct {
-	ClOrdID    string    `json:"cl_ord_id"`
-	OrderID    string    `json:"order_id"`
-	ExecID     string    `json:"exec_id"`
-	ExecType   string    `json:"exec_type"`
-	OrdStatus  string    `json:"ord_status"`
-	Symbol     string    `json:"symbol"`
-	Side       string    `json:"side"`
-	ExecQty    float64   `json:"exec_qty"`
-	ExecPrice  float64   `json:"exec_price"`
-	LeavesQty  float64   `json:"leaves_qty"`
-	CumQty     float64   `json:"cum_qty"`
-	AvgPx      float64   `json:"avg_px"`
-	Commission float64   `json:"commission"`
-	ExecTime   time.Time `json:"exec_time"`
-	Text       string    `json:"text"`
+	Handle      string    `json:"handle"`
+	ClOrdID     string    `json:"cl_ord_id"`
+	OrigClOrdID string    `json:"orig_cl_ord_id,omitempty"`
+	OrderID     string    `json:"order_id"`
+	ExecID      string    `json:"exec_id"`
+	ExecType    string    `json:"exec_type"`
+	OrdStatus   string    `json:"ord_status"`
+	Symbol      string    `json:"symbol"`
+	Side        string    `json:"side"`
+	ExecQty     float64   `json:"exec_qty"`
+	ExecPrice   float64   `json:"exec_price"`
+	LeavesQty   float64   `json:"leaves_qty"`
+	CumQty      float64   `json:"cum_qty"`
+	AvgPx       float64   `json:"avg_px"`
+	Commission  float64   `json:"commission"`
+	ExecTime    time.Time `json:"exec_time"`
+	Text        string    `json:"text"`
 }
 
-func NewOrdersClient() *OrdersClient {
-	return &OrdersClient{
-		BCBApplication: bcb.NewBCBApplication(),
+func NewOrdersClient(st *store.Store, ids *idgen.Generator) *OrdersClient {
+	client := &OrdersClient{
+		BCBApplication: bcb.NewBCBApplication("orders"),
+		store:          st,
+		ids:            ids,
 		orders:         make(map[string]*OrderInfo),
 		executions:     make(map[string][]*ExecutionInfo),
+		chain:          newChainIndex(),
+		seenExecIDs:    make(map[string]bool),
+		statusRequests: make(map[string]*statusCollector),
+		massCancels:    make(map[string]chan massCancelReport),
+		rfqs:           make(map[string]*RFQ),
+		rfqWaiters:     make(map[string]chan struct{}),
+		traces:         make(map[string]*orderTrace),
+	}
+
+	if err := client.loadFromStore(); err != nil {
+		logger.Error("OrdersStoreLoad", logging.Err(err))
+	}
+	client.loadKillSwitch()
+	client.loadRFQs()
+
+	return client
+}
+
+func (client *OrdersClient) loadFromStore() error {
+	orders, err := store.LoadAll[OrderInfo](client.store, store.OrdersBucket)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if order.Handle == "" {
+			order.Handle = order.ClOrdID
+		}
+		if len(order.ClOrdIDChain) == 0 {
+			order.ClOrdIDChain = []string{order.ClOrdID}
+		}
+		client.orders[order.Handle] = order
+		client.chain.addOrder(order)
+	}
+
+	executions, err := store.LoadAll[ExecutionInfo](client.store, store.ExecutionsBucket)
+	if err != nil {
+		return err
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].ExecTime.Before(executions[j].ExecTime)
+	})
+	for _, execution := range executions {
+		if execution.Handle == "" {
+			execution.Handle = execution.ClOrdID
+		}
+		client.executions[execution.Handle] = append(client.executions[execution.Handle], execution)
+		client.seenExecIDs[execution.ExecID] = true
+	}
+
+	logger.Info("OrdersStoreLoaded", "orders", len(orders), "executions", len(executions))
+	return nil
+}
+
+func (client *OrdersClient) saveOrder(order *OrderInfo) {
+	if err := client.store.Put(store.OrdersBucket, order.Handle, order); err != nil {
+		logger.Error("OrderPersist", logging.KeyHandle, order.Handle, logging.KeyClOrdID, order.ClOrdID, logging.Err(err))
+	}
+}
+
+func (client *OrdersClient) saveExecution(execution *ExecutionInfo) {
+	if err := client.store.Put(store.ExecutionsBucket, execution.ExecID, execution); err != nil {
+		logger.Error("ExecutionPersist", logging.KeyExecID, execution.ExecID, logging.KeyClOrdID, execution.ClOrdID, logging.Err(err))
 	}
 }
 
@@ -81,7 +186,7 @@ func (client *OrdersClient) Start(configFile string) error {
 	}
 
 	storeFactory := quickfix.NewMemoryStoreFactory()
-	logFactory := logging.NewDebugLogFactory("log")
+	logFactory := client.LogFactory()
 
 	client.initiator, err = quickfix.NewInitiator(client, storeFactory, cfg, logFactory)
 	if err != nil {
@@ -94,7 +199,7 @@ func (client *OrdersClient) Start(configFile string) error {
 		return fmt.Errorf("failed to start initiator: %w", err)
 	}
 
-	log.Println("[EVENT (OrdersClientStarted)]")
+	logger.Info("OrdersClientStarted")
 	return nil
 }
 
@@ -102,15 +207,38 @@ func (client *OrdersClient) Stop() {
 	if client.initiator != nil {
 		client.initiator.Stop()
 
-		log.Println("[EVENT (OrdersClientStopped)]")
+		logger.Info("OrdersClientStopped")
 	}
 }
 
 func (client *OrdersClient) NewOrderSingle(order *OrderInfo) error {
+	return client.NewOrderSingleContext(context.Background(), order)
+}
+
+// NewOrderSingleContext sends the order as a child of the trace in ctx. The
+// order's lifecycle span stays open until its terminal execution report.
+func (client *OrdersClient) NewOrderSingleContext(ctx context.Context, order *OrderInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "orders.NewOrderSingle", trace.WithAttributes(
+		tracing.AttrClOrdID.String(order.ClOrdID),
+		tracing.AttrSymbol.String(order.Symbol),
+		tracing.AttrSide.String(order.Side),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	if !client.IsLoggedIn() {
 		return fmt.Errorf("not logged in")
 	}
 
+	if err := client.checkTradingAllowed(); err != nil {
+		return err
+	}
+
+	client.preTradeMu.Lock()
+	if err := client.runPreTradeCheck(order, nil); err != nil {
+		client.preTradeMu.Unlock()
+		return err
+	}
+
 	message := quickfix.NewMessage()
 	message.Header.SetString(tag.MsgType, "D")
 
@@ -122,86 +250,181 @@ func (client *OrdersClient) NewOrderSingle(order *OrderInfo) error {
 	message.Body.SetString(tag.TimeInForce, order.TimeInForce)
 	message.Body.SetString(tag.TransactTime, time.Now().UTC().Format("20060102-15:04:05.000"))
 
-	if order.OrdType == "2" && order.Price > 0 {
+	/* D - previously quoted: the price is the accepted quote's */
+	if (order.OrdType == "2" || order.OrdType == "D") && order.Price > 0 {
 		message.Body.SetString(tag.Price, fmt.Sprintf("%.8f", order.Price))
 	}
 
-	message.Body.SetString(20030, "Y")
-
-	if err := quickfix.SendToTarget(message, client.GetSessionID()); err != nil {
-		return fmt.Errorf("failed to send order: %w", err)
+	if order.QuoteID != "" {
+		message.Body.SetString(tag.QuoteID, order.QuoteID)
 	}
 
+	message.Body.SetString(20030, "Y")
+
+	order.Handle = order.ClOrdID
+	order.ClOrdIDChain = []string{order.ClOrdID}
 	order.TransactTime = time.Now()
 	order.LeavesQty = order.OrderQty
+	order.Status = "A"
+	order.History = []StateTransition{{To: "A", Reason: "submitted", Time: time.Now().UTC()}}
+
+	/* registered before sending so that a fast ack can always be matched */
+	client.mu.Lock()
+	if _, exists := client.chain.resolve(order.ClOrdID); exists {
+		client.mu.Unlock()
+		client.preTradeMu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDuplicateClOrdID, order.ClOrdID)
+	}
+	client.orders[order.Handle] = order
+	client.chain.addOrder(order)
+	ctx = client.startOrderTraceLocked(ctx, order)
+	client.mu.Unlock()
+	client.preTradeMu.Unlock()
+
+	_, sendSpan := tracer.Start(ctx, "fix.SendToTarget", trace.WithAttributes(tracing.AttrMsgType.String("D"), tracing.AttrClOrdID.String(order.ClOrdID)))
+	err = client.Send(message)
+	tracing.End(sendSpan, err)
+
+	if err != nil {
+		client.mu.Lock()
+		delete(client.orders, order.Handle)
+		client.chain.removeOrder(order)
+		client.endOrderTraceLocked(order.Handle, err)
+		client.mu.Unlock()
 
-	client.orders[order.ClOrdID] = order
+		return fmt.Errorf("failed to send order: %w", err)
+	}
 
-	log.Printf("[SEND (NewOrder)]: %s (%s %s %f @ %f)", order.ClOrdID, order.Side, order.Symbol, order.OrderQty, order.Price)
+	client.mu.Lock()
+	client.saveOrder(order)
+	client.mu.Unlock()
+
+	logger.Info("NewOrder", logging.KeyDirection, logging.DirOut, logging.KeyHandle, order.Handle, logging.KeyClOrdID, order.ClOrdID,
+		logging.KeyClientID, order.ClientID, logging.KeySymbol, order.Symbol, "side", order.Side, "qty", order.OrderQty, "price", order.Price)
 	return nil
 }
 
-func (client *OrdersClient) CancelOrder(origClOrdID, symbol, side string) error {
+// CancelOrder cancels the order identified by any ClOrdID, OrigClOrdID or
+// OrderID in its chain. It returns the ClOrdID of the cancel request.
+func (client *OrdersClient) CancelOrder(id string) (string, error) {
 	if !client.IsLoggedIn() {
-		return fmt.Errorf("not logged in")
+		return "", fmt.Errorf("not logged in")
+	}
+
+	newClOrdID := client.ids.Next(idgen.Cancel)
+
+	client.mu.Lock()
+	order, err := client.beginPendingLocked(id, newClOrdID, PendingCancel, nil)
+	if err != nil {
+		client.mu.Unlock()
+		return "", err
 	}
 
-	newClOrdID := generateOrderID()
 	message := quickfix.NewMessage()
 	message.Header.SetString(tag.MsgType, "F")
 
 	message.Body.SetString(tag.ClOrdID, newClOrdID)
-	message.Body.SetString(tag.OrigClOrdID, origClOrdID)
-	message.Body.SetString(tag.Symbol, symbol)
-	message.Body.SetString(tag.Side, side)
+	message.Body.SetString(tag.OrigClOrdID, order.ClOrdID)
+	if order.OrderID != "" {
+		message.Body.SetString(tag.OrderID, order.OrderID)
+	}
+	message.Body.SetString(tag.Symbol, order.Symbol)
+	message.Body.SetString(tag.Side, order.Side)
 	message.Body.SetString(tag.TransactTime, time.Now().UTC().Format("20060102-15:04:05.000"))
 
-	if err := quickfix.SendToTarget(message, client.GetSessionID()); err != nil {
-		return fmt.Errorf("failed to cancel order: %w", err)
+	handle := order.Handle
+	origClOrdID := order.ClOrdID
+	client.mu.Unlock()
+
+	if err := client.Send(message); err != nil {
+		client.abortPending(handle)
+		return "", fmt.Errorf("failed to cancel order: %w", err)
 	}
 
-	log.Printf("[SEND (CancelOrder)]: %s (new ClOrdID: %s)", origClOrdID, newClOrdID)
-	return nil
+	logger.Info("CancelOrder", logging.KeyDirection, logging.DirOut, logging.KeyHandle, handle, logging.KeyClOrdID, newClOrdID, "orig_cl_ord_id", origClOrdID)
+	return newClOrdID, nil
 }
 
-func (client *OrdersClient) ReplaceOrder(origClOrdID string, newOrder *OrderInfo) error {
+// ReplaceOrder amends the order identified by any ID in its chain. The new
+// parameters only take effect once BCB confirms the replace.
+func (client *OrdersClient) ReplaceOrder(id string, newOrder *OrderInfo) error {
 	if !client.IsLoggedIn() {
 		return fmt.Errorf("not logged in")
 	}
 
+	if err := client.checkTradingAllowed(); err != nil {
+		return err
+	}
+
+	client.preTradeMu.Lock()
+	if original, exists := client.GetOrderStatus(id); exists {
+		if err := client.runPreTradeCheck(newOrder, original); err != nil {
+			client.preTradeMu.Unlock()
+			return err
+		}
+	}
+
+	client.mu.Lock()
+	order, err := client.beginPendingLocked(id, newOrder.ClOrdID, PendingReplace, newOrder)
+	client.preTradeMu.Unlock()
+	if err != nil {
+		client.mu.Unlock()
+		return err
+	}
+
 	message := quickfix.NewMessage()
 	message.Header.SetString(tag.MsgType, "G")
 
 	message.Body.SetString(tag.ClOrdID, newOrder.ClOrdID)
-	message.Body.SetString(tag.OrigClOrdID, origClOrdID)
-	message.Body.SetString(tag.Symbol, newOrder.Symbol)
-	message.Body.SetString(tag.Side, newOrder.Side)
+	message.Body.SetString(tag.OrigClOrdID, order.ClOrdID)
+	if order.OrderID != "" {
+		message.Body.SetString(tag.OrderID, order.OrderID)
+	}
+	message.Body.SetString(tag.Symbol, order.Symbol)
+	message.Body.SetString(tag.Side, order.Side)
 	message.Body.SetString(tag.OrdType, newOrder.OrdType)
 	message.Body.SetString(tag.OrderQty, fmt.Sprintf("%.8f", newOrder.OrderQty))
 	message.Body.SetString(tag.TransactTime, time.Now().UTC().Format("20060102-15:04:05.000"))
 
+	if newOrder.TimeInForce != "" {
+		message.Body.SetString(tag.TimeInForce, newOrder.TimeInForce)
+	}
+
 	if newOrder.OrdType == "2" && newOrder.Price > 0 {
 		message.Body.SetString(tag.Price, fmt.Sprintf("%.8f", newOrder.Price))
 	}
 
-	if err := quickfix.SendToTarget(message, client.GetSessionID()); err != nil {
+	handle := order.Handle
+	origClOrdID := order.ClOrdID
+	client.mu.Unlock()
+
+	if err := client.Send(message); err != nil {
+		client.abortPending(handle)
 		return fmt.Errorf("failed to replace order: %w", err)
 	}
 
-	client.orders[newOrder.ClOrdID] = newOrder
-
-	log.Printf("[SEND (ReplaceOrder)]: %s -> %s", origClOrdID, newOrder.ClOrdID)
+	logger.Info("ReplaceOrder", logging.KeyDirection, logging.DirOut, logging.KeyHandle, handle, logging.KeyClOrdID, newOrder.ClOrdID, "orig_cl_ord_id", origClOrdID)
 	return nil
 }
 
 func (client *OrdersClient) FromApp(message *quickfix.Message, sessionID quickfix.SessionID) quickfix.MessageRejectError {
 	msgType, _ := message.Header.GetString(tag.MsgType)
+	client.RecordInbound(msgType)
+	client.JournalInbound(message, sessionID)
 
 	switch msgType {
 	case "8":
 		client.handleExecutionReport(message)
 	case "9":
 		client.handleOrderCancelReject(message)
+	case "r":
+		client.handleOrderMassCancelReport(message)
+	case "j":
+		client.handleBusinessMessageReject(message)
+	case "S":
+		client.handleQuote(message)
+	case "AG":
+		client.handleQuoteRequestReject(message)
 	default:
 		return client.BCBApplication.FromApp(message, sessionID)
 	}
@@ -211,6 +434,7 @@ func (client *OrdersClient) FromApp(message *quickfix.Message, sessionID quickfi
 
 func (client *OrdersClient) handleExecutionReport(message *quickfix.Message) {
 	clOrdID, _ := message.Body.GetString(tag.ClOrdID)
+	origClOrdID, _ := message.Body.GetString(tag.OrigClOrdID)
 	orderID, _ := message.Body.GetString(tag.OrderID)
 	execID, _ := message.Body.GetString(tag.ExecID)
 	execType, _ := message.Body.GetString(tag.ExecType)
@@ -218,6 +442,7 @@ func (client *OrdersClient) handleExecutionReport(message *quickfix.Message) {
 	symbol, _ := message.Body.GetString(tag.Symbol)
 	side, _ := message.Body.GetString(tag.Side)
 	text, _ := message.Body.GetString(tag.Text)
+	ordRejReason, _ := message.Body.GetString(tag.OrdRejReason)
 
 	lastQtyStr, _ := message.Body.GetString(tag.LastQty)
 	lastPxStr, _ := message.Body.GetString(tag.LastPx)
@@ -225,6 +450,8 @@ func (client *OrdersClient) handleExecutionReport(message *quickfix.Message) {
 	cumQtyStr, _ := message.Body.GetString(tag.CumQty)
 	avgPxStr, _ := message.Body.GetString(tag.AvgPx)
 	commissionStr, _ := message.Body.GetString(tag.Commission)
+	orderQtyStr, _ := message.Body.GetString(tag.OrderQty)
+	priceStr, _ := message.Body.GetString(tag.Price)
 
 	lastQty, _ := strconv.ParseFloat(lastQtyStr, 64)
 	lastPx, _ := strconv.ParseFloat(lastPxStr, 64)
@@ -232,87 +459,333 @@ func (client *OrdersClient) handleExecutionReport(message *quickfix.Message) {
 	cumQty, _ := strconv.ParseFloat(cumQtyStr, 64)
 	avgPx, _ := strconv.ParseFloat(avgPxStr, 64)
 	commission, _ := strconv.ParseFloat(commissionStr, 64)
+	orderQty, _ := strconv.ParseFloat(orderQtyStr, 64)
+	price, _ := strconv.ParseFloat(priceStr, 64)
 
 	transactTimeStr, _ := message.Body.GetString(tag.TransactTime)
-	execTime, _ := time.Parse("20060102-15:04:05.000", transactTimeStr)
+	execTime, err := time.Parse("20060102-15:04:05.000", transactTimeStr)
+	if err != nil {
+		execTime = time.Now().UTC()
+	}
+
+	/* I - order status: a reply to 35=H/AF rather than an execution */
+	if execType == "I" {
+		client.handleStatusReport(message, &StatusReport{
+			ClOrdID:   clOrdID,
+			OrderID:   orderID,
+			Symbol:    symbol,
+			Side:      side,
+			OrdStatus: ordStatus,
+			OrderQty:  orderQty,
+			CumQty:    cumQty,
+			LeavesQty: leavesQty,
+			AvgPx:     avgPx,
+			Text:      text,
+		})
+		return
+	}
+
+	if execID == "" {
+		execID = fmt.Sprintf("%s-%d", clOrdID, time.Now().UnixNano())
+	}
+
+	logger.Info("ExecutionReport", logging.KeyDirection, logging.DirIn, logging.KeyClOrdID, clOrdID, "orig_cl_ord_id", origClOrdID,
+		logging.KeyOrderID, orderID, logging.KeyExecID, execID, "exec_type", execType, "ord_status", ordStatus, logging.KeySymbol, symbol,
+		"side", side, "last_qty", lastQty, "last_px", lastPx, "cum_qty", cumQty, "leaves_qty", leavesQty)
 
-	log.Printf("[RECEIVE (ExecutionReport)]: ClOrdID=%s, OrderID=%s, ExecType=%s, OrdStatus=%s, Symbol=%s, Side=%s, LastQty=%.6f, LastPx=%.6f, CumQty=%.6f, LeavesQty=%.6f",
-		clOrdID, orderID, execType, ordStatus, symbol, side, lastQty, lastPx, cumQty, leavesQty)
+	if execType == "8" {
+		metrics.Rejects.WithLabelValues("order", ordRejReason).Inc()
+	}
 
 	execution := &ExecutionInfo{
-		ClOrdID:    clOrdID,
-		OrderID:    orderID,
-		ExecID:     execID,
-		ExecType:   execType,
-		OrdStatus:  ordStatus,
-		Symbol:     symbol,
-		Side:       side,
-		ExecQty:    lastQty,
-		ExecPrice:  lastPx,
-		LeavesQty:  leavesQty,
-		CumQty:     cumQty,
-		AvgPx:      avgPx,
-		Commission: commission,
-		ExecTime:   execTime,
-		Text:       text,
-	}
-
-	client.executions[clOrdID] = append(client.executions[clOrdID], execution)
-
-	if order, exists := client.orders[clOrdID]; exists {
-		order.OrderID = orderID
-		order.Status = ordStatus
-		order.ExecType = execType
-		order.CumQty = cumQty
-		order.LeavesQty = leavesQty
-		order.AvgPx = avgPx
-		order.LastPx = lastPx
-		order.LastQty = lastQty
+		ClOrdID:     clOrdID,
+		OrigClOrdID: origClOrdID,
+		OrderID:     orderID,
+		ExecID:      execID,
+		ExecType:    execType,
+		OrdStatus:   ordStatus,
+		Symbol:      symbol,
+		Side:        side,
+		ExecQty:     lastQty,
+		ExecPrice:   lastPx,
+		LeavesQty:   leavesQty,
+		CumQty:      cumQty,
+		AvgPx:       avgPx,
+		Commission:  commission,
+		ExecTime:    execTime,
+		Text:        text,
+	}
+
+	var events []OrderEvent
+
+	client.mu.Lock()
+	handle, found := client.chain.resolveAny(clOrdID, origClOrdID, orderID)
+	order := client.orders[handle]
+
+	if client.seenExecIDs[execID] {
+		events = append(events, client.raiseAnomalyLocked(order, Anomaly{
+			Type:     AnomalyDuplicateExecID,
+			ExecID:   execID,
+			ClOrdID:  clOrdID,
+			ToStatus: ordStatus,
+			Detail:   "execution report already processed",
+		}))
+		if order != nil {
+			client.saveOrder(order)
+		}
+		client.mu.Unlock()
+
+		for _, event := range events {
+			client.emit(event)
+		}
+		return
+	}
+	client.seenExecIDs[execID] = true
+
+	if !found {
+		handle = clOrdID
+	}
+	execution.Handle = handle
+
+	client.executions[handle] = append(client.executions[handle], execution)
+	client.saveExecution(execution)
+
+	if order != nil {
+		previousStatus := order.Status
+
+		current := order.Status
+		if order.Pending != nil {
+			current = order.Pending.PreviousStatus
+		}
+
+		if orderID != "" && order.OrderID != orderID {
+			order.OrderID = orderID
+			client.chain.addOrderID(orderID, handle)
+		}
+
+		/* commission is charged per unique execution even when the report arrives late */
 		order.Commission += commission
-		order.LastExecTime = execTime
 
-		/* 8 - rejected */
-		if ordStatus == "8" {
-			order.RejectReason = text
+		if anomalyType, detail := client.checkReport(order, current, ordStatus, cumQty, execTime); anomalyType != "" {
+			events = append(events, client.raiseAnomalyLocked(order, Anomaly{
+				Type:       anomalyType,
+				ExecID:     execID,
+				ClOrdID:    clOrdID,
+				FromStatus: current,
+				ToStatus:   ordStatus,
+				Detail:     detail,
+			}))
+		} else {
+			switch execType {
+			case "5": /* replaced */
+				client.applyReplaceLocked(order, clOrdID, origClOrdID, orderQty, price)
+			case "4", "C": /* canceled, expired */
+				order.Pending = nil
+			case "8": /* rejected */
+				order.RejectReason = text
+				order.Pending = nil
+			}
+
+			order.ExecType = execType
+			order.CumQty = cumQty
+			order.LeavesQty = leavesQty
+			order.AvgPx = avgPx
+			order.LastPx = lastPx
+			order.LastQty = lastQty
+			order.LastExecTime = execTime
+
+			if order.Pending != nil && ordStatus == "2" {
+				order.Pending = nil
+			}
+
+			/* BCB reports the live status; keep showing the pending request until it resolves */
+			if order.Pending != nil && ordStatus != "6" && ordStatus != "E" {
+				order.Pending.PreviousStatus = ordStatus
+				order.Status = order.Pending.displayStatus()
+			} else {
+				order.Status = ordStatus
+			}
+
+			client.recordTransitionLocked(order, previousStatus, execType, execID, text)
+			observeExecution(order, previousStatus, lastQty)
+			client.traceExecutionLocked(order, execType, ordStatus, text, lastQty, lastPx)
+
+			if order.Status != previousStatus {
+				events = append(events, OrderEvent{
+					Type:           EventStatusChanged,
+					Order:          *order.clone(),
+					PreviousStatus: previousStatus,
+					Execution:      execution,
+					Text:           text,
+				})
+			}
 		}
 
-		log.Printf("[UPDATE (Order)]: %s - Status=%s, CumQty=%.6f, LeavesQty=%.6f, AvgPx=%.6f, Commission=%.6f",
-			clOrdID, ordStatus, cumQty, leavesQty, avgPx, order.Commission)
+		client.saveOrder(order)
+
+		logger.Debug("OrderUpdated", logging.KeyHandle, handle, logging.KeyClOrdID, order.ClOrdID, logging.KeyOrderID, order.OrderID,
+			"status", order.Status, "cum_qty", order.CumQty, "leaves_qty", order.LeavesQty, "avg_px", order.AvgPx, "commission", order.Commission)
+	} else {
+		events = append(events, client.raiseAnomalyLocked(nil, Anomaly{
+			Type:     AnomalyUnknownOrder,
+			ExecID:   execID,
+			ClOrdID:  clOrdID,
+			ToStatus: ordStatus,
+			Detail:   fmt.Sprintf("no order matches ClOrdID=%s, OrigClOrdID=%s, OrderID=%s", clOrdID, origClOrdID, orderID),
+		}))
+	}
+	client.mu.Unlock()
+
+	for _, event := range events {
+		client.emit(event)
 	}
 }
 
 func (client *OrdersClient) handleOrderCancelReject(message *quickfix.Message) {
 	clOrdID, _ := message.Body.GetString(tag.ClOrdID)
 	origClOrdID, _ := message.Body.GetString(tag.OrigClOrdID)
+	orderID, _ := message.Body.GetString(tag.OrderID)
 	cxlRejReason, _ := message.Body.GetString(tag.CxlRejReason)
+	cxlRejResponseTo, _ := message.Body.GetString(tag.CxlRejResponseTo)
 	text, _ := message.Body.GetString(tag.Text)
 
-	log.Printf("[RECEIVE (OrderCancelReject)]: ClOrdID=%s, OrigClOrdID=%s, Reason=%s, Text=%s",
-		clOrdID, origClOrdID, cxlRejReason, text)
+	logger.Warn("OrderCancelReject", logging.KeyDirection, logging.DirIn, logging.KeyClOrdID, clOrdID, "orig_cl_ord_id", origClOrdID,
+		"reason", cxlRejReason, "text", text)
+	metrics.Rejects.WithLabelValues("cancel", cxlRejReason).Inc()
+
+	var events []OrderEvent
+
+	client.mu.Lock()
+	if handle, found := client.chain.resolveAny(clOrdID, origClOrdID, orderID); found {
+		order := client.orders[handle]
+		previousStatus := order.Status
+
+		order.CancelReject = &CancelReject{
+			ClOrdID:    clOrdID,
+			ResponseTo: cxlRejResponseTo,
+			Reason:     cxlRejReason,
+			ReasonText: cancelRejectReasonText(cxlRejReason),
+			Text:       text,
+			Time:       time.Now().UTC(),
+		}
+
+		if order.Pending != nil && order.Pending.ClOrdID == clOrdID {
+			order.Status = order.Pending.PreviousStatus
+			order.Pending = nil
+			client.recordTransitionLocked(order, previousStatus, "", "", "cancel/replace rejected: "+cancelRejectReasonText(cxlRejReason))
+		}
+
+		client.saveOrder(order)
+
+		events = append(events, OrderEvent{
+			Type:           EventCancelRejected,
+			Order:          *order.clone(),
+			PreviousStatus: previousStatus,
+			CxlRejReason:   cxlRejReason,
+			Text:           text,
+		})
+	}
+	client.mu.Unlock()
+
+	for _, event := range events {
+		client.emit(event)
+	}
 }
 
-func (client *OrdersClient) GetOrderStatus(clOrdID string) (*OrderInfo, bool) {
-	order, exists := client.orders[clOrdID]
-	return order, exists
+// GetOrderStatus looks the order up by any ClOrdID, OrigClOrdID or OrderID in
+// its chain and returns a snapshot.
+func (client *OrdersClient) GetOrderStatus(id string) (*OrderInfo, bool) {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	handle, exists := client.chain.resolve(id)
+	if !exists {
+		return nil, false
+	}
+	return client.orders[handle].clone(), true
 }
 
 func (client *OrdersClient) GetAllOrders() map[string]*OrderInfo {
-	return client.orders
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	result := make(map[string]*OrderInfo, len(client.orders))
+	for handle, order := range client.orders {
+		result[handle] = order.clone()
+	}
+	return result
+}
+
+func (client *OrdersClient) ListOrders(opts store.ListOptions) ([]*OrderInfo, string, error) {
+	client.mu.RLock()
+	var matched []*OrderInfo
+	for _, order := range client.orders {
+		if opts.MatchClient(order.ClientID) && opts.Match(order.Symbol, order.Side, order.Status, order.TransactTime) {
+			matched = append(matched, order.clone())
+		}
+	}
+	client.mu.RUnlock()
+
+	return store.Paginate(matched, func(order *OrderInfo) store.SortKey {
+		return store.SortKey{Time: order.TransactTime, ID: order.Handle}
+	}, opts)
 }
 
-func (client *OrdersClient) GetOrderExecutions(clOrdID string) ([]*ExecutionInfo, bool) {
-	executions, exists := client.executions[clOrdID]
-	return executions, exists
+func (client *OrdersClient) GetOrderExecutions(id string) ([]*ExecutionInfo, bool) {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	handle, exists := client.chain.resolve(id)
+	if !exists {
+		return nil, false
+	}
+	return append([]*ExecutionInfo(nil), client.executions[handle]...), true
 }
 
 func (client *OrdersClient) GetAllExecutions() map[string][]*ExecutionInfo {
-	return client.executions
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	result := make(map[string][]*ExecutionInfo, len(client.executions))
+	for handle, executions := range client.executions {
+		result[handle] = append([]*ExecutionInfo(nil), executions...)
+	}
+	return result
+}
+
+func (client *OrdersClient) ListExecutions(opts store.ListOptions) ([]*ExecutionInfo, string, error) {
+	client.mu.RLock()
+	var matched []*ExecutionInfo
+	for handle, executions := range client.executions {
+		/* executions of an order we no longer know have no owner, only admins see them */
+		owner := ""
+		if order, exists := client.orders[handle]; exists {
+			owner = order.ClientID
+		}
+		if !opts.MatchClient(owner) {
+			continue
+		}
+		for _, execution := range executions {
+			if opts.Match(execution.Symbol, execution.Side, execution.OrdStatus, execution.ExecTime) {
+				matched = append(matched, execution)
+			}
+		}
+	}
+	client.mu.RUnlock()
+
+	return store.Paginate(matched, func(execution *ExecutionInfo) store.SortKey {
+		return store.SortKey{Time: execution.ExecTime, ID: execution.ExecID}
+	}, opts)
 }
 
 func (client *OrdersClient) GetConnectionStatus() map[string]interface{} {
 	return client.BCBApplication.GetConnectionStatus()
 }
 
-func generateOrderID() string {
-	return fmt.Sprintf("ord-%d", time.Now().UnixNano())
+func (client *OrdersClient) NextClOrdID() string {
+	return client.ids.Next(idgen.Order)
+}
+
+func (client *OrdersClient) NextReplaceClOrdID() string {
+	return client.ids.Next(idgen.Replace)
 }
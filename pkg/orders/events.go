@@ -0,0 +1,46 @@
+package orders
+
+import "time"
+
+const (
+	EventStatusChanged  = "order.status_changed"
+	EventCancelRejected = "order.cancel_rejected"
+	EventAnomaly        = "order.anomaly"
+)
+
+type OrderEvent struct {
+	Type           string         `json:"type"`
+	Order          OrderInfo      `json:"order"`
+	PreviousStatus string         `json:"previous_status,omitempty"`
+	Execution      *ExecutionInfo `json:"execution,omitempty"`
+	Anomaly        *Anomaly       `json:"anomaly,omitempty"`
+	CxlRejReason   string         `json:"cxl_rej_reason,omitempty"`
+	Text           string         `json:"text,omitempty"`
+	Timestamp      time.Time      `json:"timestamp"`
+}
+
+type OrderListener func(event OrderEvent)
+
+// AddListener registers a callback for every order event. Register before
+// Start: events delivered on logon are not replayed to later listeners.
+func (client *OrdersClient) AddListener(listener OrderListener) {
+	client.listenersMu.Lock()
+	defer client.listenersMu.Unlock()
+
+	/* copied so that emit can range over its snapshot without the lock */
+	listeners := make([]OrderListener, len(client.listeners), len(client.listeners)+1)
+	copy(listeners, client.listeners)
+	client.listeners = append(listeners, listener)
+}
+
+func (client *OrdersClient) emit(event OrderEvent) {
+	event.Timestamp = time.Now().UTC()
+
+	client.listenersMu.RLock()
+	listeners := client.listeners
+	client.listenersMu.RUnlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,301 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+)
+
+const (
+	OutcomeAffected        = "affected"
+	OutcomeCancelRequested = "cancel_requested"
+	OutcomeFailed          = "failed"
+
+	metaBucket    = "meta"
+	killSwitchKey = "kill_switch"
+)
+
+var ErrTradingHalted = errors.New("trading halted by kill switch")
+
+type MassCancelScope struct {
+	Symbol string `json:"symbol,omitempty"`
+	Side   string `json:"side,omitempty"`
+}
+
+type CancelOutcome struct {
+	Handle        string `json:"handle"`
+	ClOrdID       string `json:"cl_ord_id"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Outcome       string `json:"outcome"`
+	CancelClOrdID string `json:"cancel_cl_ord_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type MassCancelResult struct {
+	ClOrdID             string          `json:"cl_ord_id"`
+	Scope               MassCancelScope `json:"scope"`
+	Method              string          `json:"method"`
+	MassCancelResponse  string          `json:"mass_cancel_response,omitempty"`
+	RejectReason        string          `json:"reject_reason,omitempty"`
+	TotalAffectedOrders int             `json:"total_affected_orders"`
+	Orders              []CancelOutcome `json:"orders"`
+}
+
+type KillSwitchState struct {
+	Halted   bool      `json:"halted"`
+	Reason   string    `json:"reason,omitempty"`
+	HaltedAt time.Time `json:"halted_at,omitempty"`
+}
+
+type massCancelReport struct {
+	response        string
+	rejectReason    string
+	text            string
+	totalAffected   int
+	affectedClOrdID []string
+}
+
+func (scope MassCancelScope) matches(order *OrderInfo) bool {
+	if scope.Symbol != "" && !strings.EqualFold(scope.Symbol, order.Symbol) {
+		return false
+	}
+	if scope.Side != "" && scope.Side != order.Side {
+		return false
+	}
+	return true
+}
+
+// MassCancel sends an OrderMassCancelRequest (35=q) for the scope. If BCB
+// rejects it or does not answer in time, every matching open order is
+// cancelled individually instead.
+func (client *OrdersClient) MassCancel(scope MassCancelScope, timeout time.Duration) (*MassCancelResult, error) {
+	if !client.IsLoggedIn() {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	var targets []*OrderInfo
+	for _, order := range client.OpenOrders() {
+		if scope.matches(order) {
+			targets = append(targets, order)
+		}
+	}
+
+	clOrdID := client.ids.Next(idgen.MassCancel)
+	result := &MassCancelResult{ClOrdID: clOrdID, Scope: scope, Method: "mass_cancel"}
+
+	reportCh := make(chan massCancelReport, 1)
+	client.mu.Lock()
+	client.massCancels[clOrdID] = reportCh
+	client.mu.Unlock()
+
+	defer func() {
+		client.mu.Lock()
+		delete(client.massCancels, clOrdID)
+		client.mu.Unlock()
+	}()
+
+	message := quickfix.NewMessage()
+	message.Header.SetString(tag.MsgType, "q")
+	message.Body.SetString(tag.ClOrdID, clOrdID)
+	if scope.Symbol != "" {
+		message.Body.SetString(tag.MassCancelRequestType, "1") /* cancel orders for a security */
+		message.Body.SetString(tag.Symbol, scope.Symbol)
+	} else {
+		message.Body.SetString(tag.MassCancelRequestType, "7") /* cancel all orders */
+	}
+	if scope.Side != "" {
+		message.Body.SetString(tag.Side, scope.Side)
+	}
+	message.Body.SetString(tag.TransactTime, time.Now().UTC().Format("20060102-15:04:05.000"))
+
+	if err := client.Send(message); err != nil {
+		return nil, fmt.Errorf("failed to send mass cancel: %w", err)
+	}
+
+	logger.Info("OrderMassCancelRequest", logging.KeyDirection, logging.DirOut, logging.KeyClOrdID, clOrdID, logging.KeySymbol, scope.Symbol,
+		"side", scope.Side, "open_orders", len(targets))
+
+	select {
+	case report := <-reportCh:
+		result.MassCancelResponse = report.response
+		result.RejectReason = report.rejectReason
+		result.TotalAffectedOrders = report.totalAffected
+
+		/* 0 - cancel request rejected */
+		if report.response != "0" {
+			affected := make(map[string]bool)
+			for _, id := range report.affectedClOrdID {
+				affected[id] = true
+			}
+			for _, order := range targets {
+				outcome := CancelOutcome{Handle: order.Handle, ClOrdID: order.ClOrdID, Symbol: order.Symbol, Side: order.Side, Outcome: OutcomeAffected}
+				if len(affected) > 0 && !affected[order.ClOrdID] && !affected[order.OrderID] {
+					outcome.Outcome = OutcomeFailed
+					outcome.Error = "not reported as affected by BCB"
+				}
+				result.Orders = append(result.Orders, outcome)
+			}
+			return result, nil
+		}
+
+		logger.Warn("OrderMassCancelRejected", logging.KeyClOrdID, clOrdID, "reason", report.rejectReason, "text", report.text, "fallback", "individual")
+	case <-time.After(timeout):
+		logger.Warn("OrderMassCancelTimeout", logging.KeyClOrdID, clOrdID, "fallback", "individual")
+	}
+
+	result.Method = "individual"
+	result.Orders = client.cancelIndividually(targets)
+	return result, nil
+}
+
+func (client *OrdersClient) cancelIndividually(targets []*OrderInfo) []CancelOutcome {
+	outcomes := make([]CancelOutcome, 0, len(targets))
+
+	for _, order := range targets {
+		outcome := CancelOutcome{Handle: order.Handle, ClOrdID: order.ClOrdID, Symbol: order.Symbol, Side: order.Side}
+
+		cancelClOrdID, err := client.CancelOrder(order.Handle)
+		if err != nil {
+			outcome.Outcome = OutcomeFailed
+			outcome.Error = err.Error()
+		} else {
+			outcome.Outcome = OutcomeCancelRequested
+			outcome.CancelClOrdID = cancelClOrdID
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	return outcomes
+}
+
+func (client *OrdersClient) handleOrderMassCancelReport(message *quickfix.Message) {
+	clOrdID, _ := message.Body.GetString(tag.ClOrdID)
+	response, _ := message.Body.GetString(tag.MassCancelResponse)
+	rejectReason, _ := message.Body.GetString(tag.MassCancelRejectReason)
+	totalAffected, _ := message.Body.GetInt(tag.TotalAffectedOrders)
+	text, _ := message.Body.GetString(tag.Text)
+
+	report := massCancelReport{
+		response:      response,
+		rejectReason:  rejectReason,
+		text:          text,
+		totalAffected: totalAffected,
+	}
+
+	group := quickfix.NewRepeatingGroup(tag.NoAffectedOrders, quickfix.GroupTemplate{
+		quickfix.GroupElement(tag.OrigClOrdID),
+		quickfix.GroupElement(tag.AffectedOrderID),
+		quickfix.GroupElement(tag.AffectedSecondaryOrderID),
+	})
+	if err := message.Body.GetGroup(group); err == nil {
+		for i := 0; i < group.Len(); i++ {
+			if origClOrdID, err := group.Get(i).GetString(tag.OrigClOrdID); err == nil {
+				report.affectedClOrdID = append(report.affectedClOrdID, origClOrdID)
+			}
+			if affectedOrderID, err := group.Get(i).GetString(tag.AffectedOrderID); err == nil {
+				report.affectedClOrdID = append(report.affectedClOrdID, affectedOrderID)
+			}
+		}
+	}
+
+	logger.Info("OrderMassCancelReport", logging.KeyDirection, logging.DirIn, logging.KeyClOrdID, clOrdID, "response", response,
+		"reject_reason", rejectReason, "total_affected", totalAffected, "text", text)
+
+	client.deliverMassCancelReport(clOrdID, report)
+}
+
+func (client *OrdersClient) handleBusinessMessageReject(message *quickfix.Message) {
+	refMsgType, _ := message.Body.GetString(tag.RefMsgType)
+	refID, _ := message.Body.GetString(tag.BusinessRejectRefID)
+	reason, _ := message.Body.GetString(tag.BusinessRejectReason)
+	text, _ := message.Body.GetString(tag.Text)
+
+	logger.Warn("BusinessMessageReject", logging.KeyDirection, logging.DirIn, "ref_msg_type", refMsgType, "ref_id", refID, "reason", reason, "text", text)
+	metrics.Rejects.WithLabelValues("business", reason).Inc()
+
+	switch refMsgType {
+	case "q":
+		client.deliverMassCancelReport(refID, massCancelReport{response: "0", rejectReason: reason, text: text})
+	case "R":
+		client.rejectRFQ(refID, reason, text)
+	}
+}
+
+func (client *OrdersClient) deliverMassCancelReport(clOrdID string, report massCancelReport) {
+	client.mu.RLock()
+	ch, exists := client.massCancels[clOrdID]
+	client.mu.RUnlock()
+
+	if exists {
+		select {
+		case ch <- report:
+		default:
+		}
+	}
+}
+
+// Halt engages the kill switch: every new order and replace is refused until
+// Rearm is called. The state is persisted so that it survives a restart.
+func (client *OrdersClient) Halt(reason string) KillSwitchState {
+	client.mu.Lock()
+	if !client.killSwitch.Halted {
+		client.killSwitch = KillSwitchState{Halted: true, Reason: reason, HaltedAt: time.Now().UTC()}
+		client.saveKillSwitchLocked()
+	}
+	state := client.killSwitch
+	client.mu.Unlock()
+
+	logger.Warn("KillSwitchEngaged", "reason", reason)
+	return state
+}
+
+func (client *OrdersClient) Rearm() KillSwitchState {
+	client.mu.Lock()
+	client.killSwitch = KillSwitchState{}
+	client.saveKillSwitchLocked()
+	client.mu.Unlock()
+
+	logger.Info("KillSwitchRearmed")
+	return KillSwitchState{}
+}
+
+func (client *OrdersClient) KillSwitch() KillSwitchState {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.killSwitch
+}
+
+func (client *OrdersClient) checkTradingAllowed() error {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	if client.killSwitch.Halted {
+		metrics.Rejects.WithLabelValues("halted", "kill_switch").Inc()
+		return fmt.Errorf("%w: %s", ErrTradingHalted, client.killSwitch.Reason)
+	}
+	return nil
+}
+
+func (client *OrdersClient) saveKillSwitchLocked() {
+	if err := client.store.Put(metaBucket, killSwitchKey, client.killSwitch); err != nil {
+		logger.Error("KillSwitchPersist", logging.Err(err))
+	}
+}
+
+func (client *OrdersClient) loadKillSwitch() {
+	if _, err := client.store.Get(metaBucket, killSwitchKey, &client.killSwitch); err != nil {
+		logger.Error("KillSwitchLoad", logging.Err(err))
+	}
+	if client.killSwitch.Halted {
+		logger.Warn("KillSwitchEngaged", "since", client.killSwitch.HaltedAt, "reason", client.killSwitch.Reason)
+	}
+}
@@ -0,0 +1,29 @@
+package orders
+
+import (
+	"time"
+
+	"bcb-fix-microservice/pkg/metrics"
+)
+
+// observeExecution records submit-to-ack and submit-to-fill latency, measured
+// from the TransactTime set when the NewOrderSingle was sent. Orders loaded
+// from the store after a restart are skipped.
+func observeExecution(order *OrderInfo, previousStatus string, lastQty float64) {
+	if order.TransactTime.Before(processStart) {
+		return
+	}
+	elapsed := time.Since(order.TransactTime).Seconds()
+
+	if previousStatus == "A" && order.Status != "A" {
+		metrics.AckLatency.Observe(elapsed)
+	}
+	if lastQty > 0 && order.CumQty == lastQty {
+		metrics.FillLatency.WithLabelValues("first").Observe(elapsed)
+	}
+	if order.Status == "2" && previousStatus != "2" {
+		metrics.FillLatency.WithLabelValues("complete").Observe(elapsed)
+	}
+}
+
+var processStart = time.Now()
@@ -0,0 +1,36 @@
+package orders
+
+import "bcb-fix-microservice/pkg/logging"
+
+// PreTradeCheck vets an order before it is sent. For a replace, original is
+// the order being amended and order carries the new parameters; for a new
+// order original is nil. A non-nil error blocks the request.
+type PreTradeCheck func(order *OrderInfo, original *OrderInfo) error
+
+func (client *OrdersClient) SetPreTradeCheck(check PreTradeCheck) {
+	client.mu.Lock()
+	client.preTrade = check
+	client.mu.Unlock()
+}
+
+/* called without client.mu held: checks read open orders and executions. Callers hold preTradeMu. */
+func (client *OrdersClient) runPreTradeCheck(order *OrderInfo, original *OrderInfo) error {
+	client.mu.RLock()
+	check := client.preTrade
+	client.mu.RUnlock()
+
+	if check == nil {
+		return nil
+	}
+
+	if err := check(order, original); err != nil {
+		if original != nil {
+			logger.Warn("PreTradeReject", logging.KeyHandle, original.Handle, logging.KeyClOrdID, order.ClOrdID, "action", "replace", logging.Err(err))
+		} else {
+			logger.Warn("PreTradeReject", logging.KeyClOrdID, order.ClOrdID, logging.KeyClientID, order.ClientID, logging.KeySymbol, order.Symbol,
+				"side", order.Side, "qty", order.OrderQty, "price", order.Price, logging.Err(err))
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package orders
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+)
+
+const (
+	MismatchStatus         = "status_mismatch"
+	MismatchQuantity       = "quantity_mismatch"
+	MismatchMissingAtBCB   = "missing_at_bcb"
+	MismatchUnknownLocally = "unknown_locally"
+
+	reconciliationsBucket = "reconciliations"
+	qtyTolerance          = 1e-9
+)
+
+type StatusReport struct {
+	ClOrdID   string  `json:"cl_ord_id"`
+	OrderID   string  `json:"order_id"`
+	Symbol    string  `json:"symbol"`
+	Side      string  `json:"side"`
+	OrdStatus string  `json:"ord_status"`
+	OrderQty  float64 `json:"order_qty"`
+	CumQty    float64 `json:"cum_qty"`
+	LeavesQty float64 `json:"leaves_qty"`
+	AvgPx     float64 `json:"avg_px"`
+	Text      string  `json:"text,omitempty"`
+}
+
+type Mismatch struct {
+	Handle  string `json:"handle,omitempty"`
+	ClOrdID string `json:"cl_ord_id,omitempty"`
+	OrderID string `json:"order_id,omitempty"`
+	Type    string `json:"type"`
+	Field   string `json:"field,omitempty"`
+	Local   string `json:"local,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+}
+
+type ReconciliationReport struct {
+	ID          string          `json:"id"`
+	Scope       string          `json:"scope"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at"`
+	Complete    bool            `json:"complete"`
+	Checked     int             `json:"checked"`
+	Reports     []*StatusReport `json:"reports"`
+	Mismatches  []Mismatch      `json:"mismatches"`
+}
+
+type statusCollector struct {
+	reports  []*StatusReport
+	expected int
+	done     chan struct{}
+	closed   bool
+}
+
+func (c *statusCollector) add(report *StatusReport, total int, last bool) {
+	if report != nil {
+		c.reports = append(c.reports, report)
+	}
+	if total > 0 {
+		c.expected = total
+	}
+	complete := last || (c.expected > 0 && len(c.reports) >= c.expected) || (total == 0 && report == nil)
+	if complete && !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+}
+
+func (client *OrdersClient) OnLogon(sessionID quickfix.SessionID) {
+	client.BCBApplication.OnLogon(sessionID)
+
+	go func() {
+		time.Sleep(2 * time.Second)
+		if _, err := client.ReconcileOpenOrders(30 * time.Second); err != nil {
+			logger.Error("ReconciliationFailed", logging.Err(err))
+		}
+	}()
+}
+
+// RequestOrderStatus sends an OrderStatusRequest (35=H) for a single order and
+// applies BCB's answer to the local order.
+func (client *OrdersClient) RequestOrderStatus(id string, timeout time.Duration) (*ReconciliationReport, error) {
+	if !client.IsLoggedIn() {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	client.mu.RLock()
+	handle, exists := client.chain.resolve(id)
+	var order *OrderInfo
+	if exists {
+		order = client.orders[handle].clone()
+	}
+	client.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+
+	reqID := client.ids.Next(idgen.StatusRequest)
+	collector := client.openCollector(reqID, 1)
+	defer client.closeCollector(reqID)
+
+	report := &ReconciliationReport{ID: reqID, Scope: "order", StartedAt: time.Now().UTC(), Checked: 1}
+
+	if err := client.sendOrderStatusRequest(reqID, order); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-collector.done:
+		report.Complete = true
+	case <-time.After(timeout):
+	}
+
+	client.finishReconciliation(report, collector, []*OrderInfo{order})
+	return report, nil
+}
+
+// ReconcileOpenOrders requests the status of every open order with an
+// OrderMassStatusRequest (35=AF). If BCB does not answer, it falls back to one
+// OrderStatusRequest per open order.
+func (client *OrdersClient) ReconcileOpenOrders(timeout time.Duration) (*ReconciliationReport, error) {
+	if !client.IsLoggedIn() {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	openOrders := client.OpenOrders()
+
+	reqID := client.ids.Next(idgen.MassStatusRequest)
+	collector := client.openCollector(reqID, 0)
+	defer client.closeCollector(reqID)
+
+	report := &ReconciliationReport{ID: reqID, Scope: "mass", StartedAt: time.Now().UTC(), Checked: len(openOrders)}
+
+	message := quickfix.NewMessage()
+	message.Header.SetString(tag.MsgType, "AF")
+	message.Body.SetString(tag.MassStatusReqID, reqID)
+	message.Body.SetInt(tag.MassStatusReqType, 7) /* status for all orders */
+
+	if err := client.Send(message); err != nil {
+		return nil, fmt.Errorf("failed to send mass status request: %w", err)
+	}
+
+	logger.Info("OrderMassStatusRequest", logging.KeyDirection, logging.DirOut, "mass_status_req_id", reqID, "open_orders", len(openOrders))
+
+	select {
+	case <-collector.done:
+		report.Complete = true
+	case <-time.After(timeout):
+	}
+
+	client.mu.RLock()
+	received := len(collector.reports)
+	client.mu.RUnlock()
+
+	if !report.Complete && received == 0 && len(openOrders) > 0 {
+		logger.Warn("OrderMassStatusTimeout", "mass_status_req_id", reqID, "fallback", "OrderStatusRequest")
+
+		report.Scope = "fallback"
+
+		client.mu.Lock()
+		collector.expected = len(openOrders)
+		client.mu.Unlock()
+
+		for _, order := range openOrders {
+			if err := client.sendOrderStatusRequest(reqID, order); err != nil {
+				logger.Error("OrderStatusRequestFailed", logging.KeyHandle, order.Handle, logging.KeyClOrdID, order.ClOrdID, logging.Err(err))
+			}
+		}
+
+		select {
+		case <-collector.done:
+			report.Complete = true
+		case <-time.After(timeout):
+		}
+	}
+
+	client.finishReconciliation(report, collector, openOrders)
+
+	if err := client.store.Put(reconciliationsBucket, report.ID, report); err != nil {
+		logger.Error("ReconciliationPersist", "reconciliation_id", report.ID, logging.Err(err))
+	}
+
+	logger.Info("ReconciliationCompleted", "reconciliation_id", report.ID, "checked", report.Checked, "reports", len(report.Reports),
+		"mismatches", len(report.Mismatches), "complete", report.Complete)
+	return report, nil
+}
+
+func (client *OrdersClient) sendOrderStatusRequest(reqID string, order *OrderInfo) error {
+	message := quickfix.NewMessage()
+	message.Header.SetString(tag.MsgType, "H")
+
+	message.Body.SetString(tag.ClOrdID, order.ClOrdID)
+	if order.OrderID != "" {
+		message.Body.SetString(tag.OrderID, order.OrderID)
+	}
+	message.Body.SetString(tag.Symbol, order.Symbol)
+	message.Body.SetString(tag.Side, order.Side)
+	message.Body.SetString(tag.OrdStatusReqID, reqID)
+
+	if err := client.Send(message); err != nil {
+		return fmt.Errorf("failed to send order status request: %w", err)
+	}
+
+	logger.Info("OrderStatusRequest", logging.KeyDirection, logging.DirOut, logging.KeyHandle, order.Handle, logging.KeyClOrdID, order.ClOrdID, "ord_status_req_id", reqID)
+	return nil
+}
+
+func (client *OrdersClient) OpenOrders() []*OrderInfo {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	var open []*OrderInfo
+	for _, order := range client.orders {
+		if !order.IsTerminal() {
+			open = append(open, order.clone())
+		}
+	}
+	return open
+}
+
+func (client *OrdersClient) openCollector(reqID string, expected int) *statusCollector {
+	collector := &statusCollector{expected: expected, done: make(chan struct{})}
+
+	client.mu.Lock()
+	client.statusRequests[reqID] = collector
+	client.mu.Unlock()
+
+	return collector
+}
+
+func (client *OrdersClient) closeCollector(reqID string) {
+	client.mu.Lock()
+	delete(client.statusRequests, reqID)
+	client.mu.Unlock()
+}
+
+// handleStatusReport consumes an ExecutionReport with ExecType=I. Status
+// reports are not executions and are only matched to the pending request.
+func (client *OrdersClient) handleStatusReport(message *quickfix.Message, report *StatusReport) {
+	ordStatusReqID, _ := message.Body.GetString(tag.OrdStatusReqID)
+	massStatusReqID, _ := message.Body.GetString(tag.MassStatusReqID)
+	totNumReports, totErr := message.Body.GetInt(tag.TotNumReports)
+	lastRptRequested, _ := message.Body.GetBool(tag.LastRptRequested)
+
+	logger.Info("OrderStatusReport", logging.KeyDirection, logging.DirIn, logging.KeyClOrdID, report.ClOrdID, logging.KeyOrderID, report.OrderID,
+		"ord_status", report.OrdStatus, "cum_qty", report.CumQty, "ord_status_req_id", ordStatusReqID, "mass_status_req_id", massStatusReqID)
+
+	reqID := ordStatusReqID
+	if massStatusReqID != "" {
+		reqID = massStatusReqID
+	}
+
+	if totErr != nil {
+		totNumReports = -1
+	}
+
+	if report.ClOrdID == "" && report.OrderID == "" {
+		report = nil
+	}
+
+	var events []OrderEvent
+
+	client.mu.Lock()
+	if collector, exists := client.statusRequests[reqID]; exists {
+		collector.add(report, totNumReports, lastRptRequested)
+	} else if report != nil {
+		/* unsolicited status report: still reconcile it against the local order */
+		if handle, found := client.chain.resolveAny(report.ClOrdID, "", report.OrderID); found {
+			if _, event := client.applyStatusReportLocked(client.orders[handle], report); event != nil {
+				events = append(events, *event)
+			}
+		}
+	}
+	client.mu.Unlock()
+
+	for _, event := range events {
+		client.emit(event)
+	}
+}
+
+func (client *OrdersClient) finishReconciliation(report *ReconciliationReport, collector *statusCollector, checked []*OrderInfo) {
+	var events []OrderEvent
+	defer func() {
+		for _, event := range events {
+			client.emit(event)
+		}
+	}()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	report.Reports = append([]*StatusReport(nil), collector.reports...)
+
+	seen := make(map[string]bool)
+	for _, statusReport := range collector.reports {
+		handle, found := client.chain.resolveAny(statusReport.ClOrdID, "", statusReport.OrderID)
+		if !found {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				ClOrdID: statusReport.ClOrdID,
+				OrderID: statusReport.OrderID,
+				Type:    MismatchUnknownLocally,
+				Remote:  statusReport.OrdStatus,
+			})
+			continue
+		}
+
+		seen[handle] = true
+		mismatches, event := client.applyStatusReportLocked(client.orders[handle], statusReport)
+		report.Mismatches = append(report.Mismatches, mismatches...)
+		if event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	if report.Complete {
+		for _, order := range checked {
+			if !seen[order.Handle] {
+				report.Mismatches = append(report.Mismatches, Mismatch{
+					Handle:  order.Handle,
+					ClOrdID: order.ClOrdID,
+					OrderID: order.OrderID,
+					Type:    MismatchMissingAtBCB,
+					Local:   order.Status,
+				})
+			}
+		}
+	}
+
+	report.CompletedAt = time.Now().UTC()
+}
+
+// applyStatusReportLocked treats BCB's status report as the source of truth
+// and returns the differences it corrected.
+func (client *OrdersClient) applyStatusReportLocked(order *OrderInfo, statusReport *StatusReport) ([]Mismatch, *OrderEvent) {
+	var mismatches []Mismatch
+
+	current := order.Status
+	if order.Pending != nil {
+		current = order.Pending.PreviousStatus
+	}
+
+	if current != statusReport.OrdStatus {
+		mismatches = append(mismatches, Mismatch{
+			Handle: order.Handle, ClOrdID: order.ClOrdID, OrderID: order.OrderID,
+			Type: MismatchStatus, Field: "ord_status", Local: current, Remote: statusReport.OrdStatus,
+		})
+	}
+
+	for _, field := range []struct {
+		name   string
+		local  *float64
+		remote float64
+	}{
+		{"cum_qty", &order.CumQty, statusReport.CumQty},
+		{"leaves_qty", &order.LeavesQty, statusReport.LeavesQty},
+		{"avg_px", &order.AvgPx, statusReport.AvgPx},
+	} {
+		if math.Abs(*field.local-field.remote) > qtyTolerance {
+			mismatches = append(mismatches, Mismatch{
+				Handle: order.Handle, ClOrdID: order.ClOrdID, OrderID: order.OrderID,
+				Type: MismatchQuantity, Field: field.name,
+				Local: fmt.Sprintf("%.8f", *field.local), Remote: fmt.Sprintf("%.8f", field.remote),
+			})
+			*field.local = field.remote
+		}
+	}
+
+	if statusReport.OrderID != "" && order.OrderID != statusReport.OrderID {
+		order.OrderID = statusReport.OrderID
+		client.chain.addOrderID(statusReport.OrderID, order.Handle)
+	}
+
+	if len(mismatches) == 0 {
+		return nil, nil
+	}
+
+	previousStatus := order.Status
+	if order.Pending != nil && (statusReport.OrdStatus == "2" || statusReport.OrdStatus == "4" || statusReport.OrdStatus == "8" || statusReport.OrdStatus == "C") {
+		order.Pending = nil
+	}
+	if order.Pending != nil {
+		order.Pending.PreviousStatus = statusReport.OrdStatus
+	} else {
+		order.Status = statusReport.OrdStatus
+	}
+	client.recordTransitionLocked(order, previousStatus, "I", "", "reconciled with BCB")
+	client.saveOrder(order)
+
+	logger.Info("OrderReconciled", logging.KeyHandle, order.Handle, logging.KeyClOrdID, order.ClOrdID, "mismatches", len(mismatches), "status", order.Status)
+
+	if order.Status == previousStatus {
+		return mismatches, nil
+	}
+	return mismatches, &OrderEvent{
+		Type:           EventStatusChanged,
+		Order:          *order.clone(),
+		PreviousStatus: previousStatus,
+		Text:           "reconciled with BCB",
+	}
+}
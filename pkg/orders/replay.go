@@ -0,0 +1,93 @@
+package orders
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+)
+
+// RestoreOutgoing applies an order, cancel or replace that was sent in a
+// recorded session as if it had just been sent, without sending anything, so
+// that replayed execution reports resolve against the same orders they did
+// live. Other message types are ignored.
+func (client *OrdersClient) RestoreOutgoing(message *quickfix.Message) error {
+	msgType, _ := message.Header.GetString(tag.MsgType)
+
+	clOrdID, _ := message.Body.GetString(tag.ClOrdID)
+	origClOrdID, _ := message.Body.GetString(tag.OrigClOrdID)
+	ordType, _ := message.Body.GetString(tag.OrdType)
+	timeInForce, _ := message.Body.GetString(tag.TimeInForce)
+
+	orderQtyStr, _ := message.Body.GetString(tag.OrderQty)
+	priceStr, _ := message.Body.GetString(tag.Price)
+	orderQty, _ := strconv.ParseFloat(orderQtyStr, 64)
+	price, _ := strconv.ParseFloat(priceStr, 64)
+
+	switch msgType {
+	case "D":
+		symbol, _ := message.Body.GetString(tag.Symbol)
+		side, _ := message.Body.GetString(tag.Side)
+		quoteID, _ := message.Body.GetString(tag.QuoteID)
+
+		transactTimeStr, _ := message.Body.GetString(tag.TransactTime)
+		transactTime, err := time.Parse("20060102-15:04:05.000", transactTimeStr)
+		if err != nil {
+			transactTime = time.Now().UTC()
+		}
+
+		order := &OrderInfo{
+			Handle:       clOrdID,
+			ClOrdID:      clOrdID,
+			ClOrdIDChain: []string{clOrdID},
+			Symbol:       symbol,
+			Side:         side,
+			OrderQty:     orderQty,
+			Price:        price,
+			OrdType:      ordType,
+			TimeInForce:  timeInForce,
+			QuoteID:      quoteID,
+			TransactTime: transactTime,
+			LeavesQty:    orderQty,
+			Status:       "A",
+			History:      []StateTransition{{To: "A", Reason: "submitted", Time: transactTime}},
+		}
+
+		client.mu.Lock()
+		defer client.mu.Unlock()
+
+		if _, exists := client.chain.resolve(clOrdID); exists {
+			return fmt.Errorf("%w: %s", ErrDuplicateClOrdID, clOrdID)
+		}
+		client.orders[order.Handle] = order
+		client.chain.addOrder(order)
+		client.saveOrder(order)
+
+	case "F":
+		client.mu.Lock()
+		defer client.mu.Unlock()
+
+		if _, err := client.beginPendingLocked(origClOrdID, clOrdID, PendingCancel, nil); err != nil {
+			return err
+		}
+
+	case "G":
+		params := &OrderInfo{OrderQty: orderQty, Price: price, OrdType: ordType, TimeInForce: timeInForce}
+
+		client.mu.Lock()
+		defer client.mu.Unlock()
+
+		if _, err := client.beginPendingLocked(origClOrdID, clOrdID, PendingReplace, params); err != nil {
+			return err
+		}
+
+	default:
+		return nil
+	}
+
+	logger.Debug("OrderRestored", logging.KeyMsgType, msgType, logging.KeyClOrdID, clOrdID, "orig_cl_ord_id", origClOrdID)
+	return nil
+}
@@ -0,0 +1,336 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"bcb-fix-microservice/pkg/idgen"
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/metrics"
+	"bcb-fix-microservice/pkg/store"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+)
+
+const (
+	RFQStatusPending  = "pending"
+	RFQStatusQuoted   = "quoted"
+	RFQStatusRejected = "rejected"
+	RFQStatusExpired  = "expired"
+	RFQStatusAccepted = "accepted"
+
+	rfqBucket = "rfqs"
+)
+
+var (
+	ErrQuoteNotFound  = errors.New("quote request not found")
+	ErrQuoteNotActive = errors.New("quote is not active")
+	ErrQuoteExpired   = errors.New("quote has expired")
+)
+
+type RFQ struct {
+	QuoteReqID   string    `json:"quote_req_id"`
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`
+	OrderQty     float64   `json:"order_qty"`
+	Status       string    `json:"status"`
+	QuoteID      string    `json:"quote_id,omitempty"`
+	BidPx        float64   `json:"bid_px,omitempty"`
+	OfferPx      float64   `json:"offer_px,omitempty"`
+	BidSize      float64   `json:"bid_size,omitempty"`
+	OfferSize    float64   `json:"offer_size,omitempty"`
+	ValidUntil   time.Time `json:"valid_until,omitempty"`
+	RejectReason string    `json:"reject_reason,omitempty"`
+	Text         string    `json:"text,omitempty"`
+	OrderHandle  string    `json:"order_handle,omitempty"`
+	ClientID     string    `json:"client_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RequestQuote sends a QuoteRequest (35=R) and waits up to timeout for the
+// Quote or QuoteRequestReject. If neither arrives in time the request stays
+// pending and a late answer is still recorded.
+func (client *OrdersClient) RequestQuote(clientID, symbol, side string, orderQty float64, timeout time.Duration) (*RFQ, error) {
+	if !client.IsLoggedIn() {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	if err := client.checkTradingAllowed(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	rfq := &RFQ{
+		QuoteReqID: client.ids.Next(idgen.QuoteRequest),
+		Symbol:     symbol,
+		Side:       side,
+		OrderQty:   orderQty,
+		Status:     RFQStatusPending,
+		ClientID:   clientID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	message := quickfix.NewMessage()
+	message.Header.SetString(tag.MsgType, "R")
+	message.Body.SetString(tag.QuoteReqID, rfq.QuoteReqID)
+
+	group := quickfix.NewRepeatingGroup(tag.NoRelatedSym, quickfix.GroupTemplate{
+		quickfix.GroupElement(tag.Symbol),
+		quickfix.GroupElement(tag.QuoteType),
+		quickfix.GroupElement(tag.Side),
+		quickfix.GroupElement(tag.OrderQty),
+	})
+	entry := group.Add()
+	entry.SetString(tag.Symbol, symbol)
+	entry.SetString(tag.QuoteType, "1") /* tradeable */
+	entry.SetString(tag.Side, side)
+	entry.SetString(tag.OrderQty, fmt.Sprintf("%.8f", orderQty))
+	message.Body.SetGroup(group)
+	message.Body.SetString(tag.TransactTime, now.Format("20060102-15:04:05.000"))
+
+	answered := make(chan struct{}, 1)
+
+	client.mu.Lock()
+	client.rfqs[rfq.QuoteReqID] = rfq
+	client.rfqWaiters[rfq.QuoteReqID] = answered
+	client.saveRFQLocked(rfq)
+	client.mu.Unlock()
+
+	defer func() {
+		client.mu.Lock()
+		delete(client.rfqWaiters, rfq.QuoteReqID)
+		client.mu.Unlock()
+	}()
+
+	if err := client.Send(message); err != nil {
+		client.mu.Lock()
+		delete(client.rfqs, rfq.QuoteReqID)
+		client.mu.Unlock()
+		client.store.Delete(rfqBucket, rfq.QuoteReqID)
+
+		return nil, fmt.Errorf("failed to send quote request: %w", err)
+	}
+
+	logger.Info("QuoteRequest", logging.KeyDirection, logging.DirOut, "quote_req_id", rfq.QuoteReqID, logging.KeyClientID, clientID,
+		logging.KeySymbol, symbol, "side", side, "qty", orderQty)
+
+	select {
+	case <-answered:
+	case <-time.After(timeout):
+		logger.Warn("QuoteTimeout", "quote_req_id", rfq.QuoteReqID, "timeout", timeout)
+	}
+
+	quote, _ := client.GetRFQ(rfq.QuoteReqID)
+	return quote, nil
+}
+
+// AcceptQuote sends a previously quoted NewOrderSingle (OrdType D) that
+// references the QuoteID, at the dealer's price for the requested side.
+func (client *OrdersClient) AcceptQuote(quoteReqID, clOrdID string) (*OrderInfo, error) {
+	client.mu.Lock()
+	rfq, exists := client.rfqs[quoteReqID]
+	if !exists {
+		client.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrQuoteNotFound, quoteReqID)
+	}
+	client.expireRFQLocked(rfq)
+	if rfq.Status == RFQStatusExpired {
+		client.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrQuoteExpired, quoteReqID)
+	}
+	if rfq.Status != RFQStatusQuoted {
+		client.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s is %s", ErrQuoteNotActive, quoteReqID, rfq.Status)
+	}
+
+	order := &OrderInfo{
+		ClOrdID:     clOrdID,
+		Symbol:      rfq.Symbol,
+		Side:        rfq.Side,
+		OrderQty:    rfq.OrderQty,
+		OrdType:     "D",
+		TimeInForce: "4", /* fill or kill at the quoted price */
+		QuoteID:     rfq.QuoteID,
+		Price:       rfq.OfferPx,
+		ClientID:    rfq.ClientID,
+	}
+	if rfq.Side == "2" {
+		order.Price = rfq.BidPx
+	}
+	/* a one-sided quote may not price the requested side */
+	if order.Price <= 0 {
+		client.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s has no price for side %s", ErrQuoteNotActive, quoteReqID, rfq.Side)
+	}
+
+	/* reserved before sending so that a quote is never accepted twice */
+	rfq.Status = RFQStatusAccepted
+	rfq.OrderHandle = clOrdID
+	rfq.UpdatedAt = time.Now().UTC()
+	client.saveRFQLocked(rfq)
+	client.mu.Unlock()
+
+	if err := client.NewOrderSingle(order); err != nil {
+		client.mu.Lock()
+		rfq.Status = RFQStatusQuoted
+		rfq.OrderHandle = ""
+		client.saveRFQLocked(rfq)
+		client.mu.Unlock()
+		return nil, err
+	}
+
+	logger.Info("QuoteAccepted", "quote_req_id", quoteReqID, "quote_id", rfq.QuoteID, logging.KeyClOrdID, clOrdID)
+	return order, nil
+}
+
+func (client *OrdersClient) GetRFQ(quoteReqID string) (*RFQ, bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	rfq, exists := client.rfqs[quoteReqID]
+	if !exists {
+		return nil, false
+	}
+	client.expireRFQLocked(rfq)
+
+	copied := *rfq
+	return &copied, true
+}
+
+func (client *OrdersClient) ListRFQs(opts store.ListOptions) ([]*RFQ, string, error) {
+	client.mu.Lock()
+	var matched []*RFQ
+	for _, rfq := range client.rfqs {
+		client.expireRFQLocked(rfq)
+		if opts.MatchClient(rfq.ClientID) && opts.Match(rfq.Symbol, rfq.Side, rfq.Status, rfq.CreatedAt) {
+			copied := *rfq
+			matched = append(matched, &copied)
+		}
+	}
+	client.mu.Unlock()
+
+	return store.Paginate(matched, func(rfq *RFQ) store.SortKey {
+		return store.SortKey{Time: rfq.CreatedAt, ID: rfq.QuoteReqID}
+	}, opts)
+}
+
+func (client *OrdersClient) handleQuote(message *quickfix.Message) {
+	quoteReqID, _ := message.Body.GetString(tag.QuoteReqID)
+	quoteID, _ := message.Body.GetString(tag.QuoteID)
+	bidPx := getFloat(message, tag.BidPx)
+	offerPx := getFloat(message, tag.OfferPx)
+	bidSize := getFloat(message, tag.BidSize)
+	offerSize := getFloat(message, tag.OfferSize)
+
+	validUntilStr, _ := message.Body.GetString(tag.ValidUntilTime)
+	validUntil, _ := time.Parse("20060102-15:04:05.000", validUntilStr)
+	if validUntil.IsZero() {
+		validUntil, _ = time.Parse("20060102-15:04:05", validUntilStr)
+	}
+
+	logger.Info("Quote", logging.KeyDirection, logging.DirIn, "quote_req_id", quoteReqID, "quote_id", quoteID,
+		"bid", bidPx, "offer", offerPx, "valid_until", validUntilStr)
+
+	client.mu.Lock()
+	rfq, exists := client.rfqs[quoteReqID]
+	if !exists {
+		client.mu.Unlock()
+		logger.Warn("QuoteUnknownRequest", "quote_req_id", quoteReqID, "quote_id", quoteID)
+		return
+	}
+	if rfq.Status != RFQStatusPending && rfq.Status != RFQStatusQuoted {
+		client.mu.Unlock()
+		return
+	}
+
+	rfq.Status = RFQStatusQuoted
+	rfq.QuoteID = quoteID
+	rfq.BidPx, rfq.OfferPx = bidPx, offerPx
+	rfq.BidSize, rfq.OfferSize = bidSize, offerSize
+	rfq.ValidUntil = validUntil
+	rfq.UpdatedAt = time.Now().UTC()
+	client.saveRFQLocked(rfq)
+
+	if !validUntil.IsZero() {
+		time.AfterFunc(time.Until(validUntil), func() {
+			client.mu.Lock()
+			client.expireRFQLocked(rfq)
+			client.mu.Unlock()
+		})
+	}
+	client.notifyRFQLocked(quoteReqID)
+	client.mu.Unlock()
+}
+
+func (client *OrdersClient) handleQuoteRequestReject(message *quickfix.Message) {
+	quoteReqID, _ := message.Body.GetString(tag.QuoteReqID)
+	reason, _ := message.Body.GetString(tag.QuoteRequestRejectReason)
+	text, _ := message.Body.GetString(tag.Text)
+
+	logger.Warn("QuoteRequestReject", logging.KeyDirection, logging.DirIn, "quote_req_id", quoteReqID, "reason", reason, "text", text)
+	metrics.Rejects.WithLabelValues("quote_request", reason).Inc()
+
+	client.rejectRFQ(quoteReqID, reason, text)
+}
+
+func (client *OrdersClient) rejectRFQ(quoteReqID, reason, text string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	rfq, exists := client.rfqs[quoteReqID]
+	if !exists {
+		return
+	}
+
+	rfq.Status = RFQStatusRejected
+	rfq.RejectReason = reason
+	rfq.Text = text
+	rfq.UpdatedAt = time.Now().UTC()
+	client.saveRFQLocked(rfq)
+	client.notifyRFQLocked(quoteReqID)
+}
+
+func (client *OrdersClient) expireRFQLocked(rfq *RFQ) {
+	if rfq.Status == RFQStatusQuoted && !rfq.ValidUntil.IsZero() && time.Now().After(rfq.ValidUntil) {
+		rfq.Status = RFQStatusExpired
+		rfq.UpdatedAt = time.Now().UTC()
+		client.saveRFQLocked(rfq)
+		logger.Info("QuoteExpired", "quote_req_id", rfq.QuoteReqID, "quote_id", rfq.QuoteID)
+	}
+}
+
+func (client *OrdersClient) notifyRFQLocked(quoteReqID string) {
+	if ch, exists := client.rfqWaiters[quoteReqID]; exists {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (client *OrdersClient) saveRFQLocked(rfq *RFQ) {
+	if err := client.store.Put(rfqBucket, rfq.QuoteReqID, rfq); err != nil {
+		logger.Error("RFQPersist", "quote_req_id", rfq.QuoteReqID, logging.Err(err))
+	}
+}
+
+func (client *OrdersClient) loadRFQs() {
+	rfqs, err := store.LoadAll[RFQ](client.store, rfqBucket)
+	if err != nil {
+		logger.Error("RFQStoreLoad", logging.Err(err))
+		return
+	}
+	for _, rfq := range rfqs {
+		client.rfqs[rfq.QuoteReqID] = rfq
+	}
+}
+
+func getFloat(message *quickfix.Message, t quickfix.Tag) float64 {
+	value, _ := message.Body.GetString(t)
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
@@ -0,0 +1,104 @@
+package orders
+
+import (
+	"fmt"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+)
+
+const (
+	AnomalyDuplicateExecID   = "duplicate_exec_id"
+	AnomalyIllegalTransition = "illegal_transition"
+	AnomalyOutOfSequence     = "out_of_sequence"
+	AnomalyUnknownOrder      = "unknown_order"
+)
+
+type StateTransition struct {
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	ExecType string    `json:"exec_type,omitempty"`
+	ExecID   string    `json:"exec_id,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type Anomaly struct {
+	Type       string    `json:"type"`
+	ExecID     string    `json:"exec_id,omitempty"`
+	ClOrdID    string    `json:"cl_ord_id,omitempty"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status,omitempty"`
+	Detail     string    `json:"detail"`
+	Time       time.Time `json:"time"`
+}
+
+// legalTransitions follows the FIX 4.4 OrdStatus state model (Appendix D).
+// Filled (2), Canceled (4), Rejected (8) and Expired (C) are terminal.
+var legalTransitions = map[string]map[string]bool{
+	"":  {"A": true, "0": true, "1": true, "2": true, "4": true, "6": true, "8": true, "C": true, "E": true},
+	"A": {"A": true, "0": true, "1": true, "2": true, "4": true, "6": true, "8": true, "C": true, "E": true},
+	"0": {"0": true, "1": true, "2": true, "3": true, "4": true, "6": true, "C": true, "E": true},
+	"1": {"1": true, "2": true, "3": true, "4": true, "6": true, "C": true, "E": true},
+	"3": {"0": true, "1": true, "3": true, "4": true, "C": true},
+	"6": {"0": true, "1": true, "2": true, "4": true, "6": true, "C": true, "E": true},
+	"E": {"0": true, "1": true, "2": true, "4": true, "6": true, "C": true, "E": true},
+}
+
+func IsLegalTransition(from, to string) bool {
+	return legalTransitions[from][to]
+}
+
+func (client *OrdersClient) recordTransitionLocked(order *OrderInfo, from, execType, execID, reason string) {
+	if from == order.Status {
+		return
+	}
+
+	order.History = append(order.History, StateTransition{
+		From:     from,
+		To:       order.Status,
+		ExecType: execType,
+		ExecID:   execID,
+		Reason:   reason,
+		Time:     time.Now().UTC(),
+	})
+}
+
+func (client *OrdersClient) raiseAnomalyLocked(order *OrderInfo, anomaly Anomaly) OrderEvent {
+	anomaly.Time = time.Now().UTC()
+
+	handle := ""
+	if order != nil {
+		handle = order.Handle
+		order.Anomalies = append(order.Anomalies, anomaly)
+	}
+
+	logger.Warn("OrderAnomaly", logging.KeyHandle, handle, "type", anomaly.Type, logging.KeyExecID, anomaly.ExecID, logging.KeyClOrdID, anomaly.ClOrdID,
+		"from", anomaly.FromStatus, "to", anomaly.ToStatus, "detail", anomaly.Detail)
+
+	event := OrderEvent{Type: EventAnomaly, Anomaly: &anomaly}
+	if order != nil {
+		event.Order = *order.clone()
+	}
+	return event
+}
+
+// checkReport decides whether an execution report may be applied to the
+// order. Reports that would regress the order are kept as executions but do
+// not change its state.
+func (client *OrdersClient) checkReport(order *OrderInfo, current, ordStatus string, cumQty float64, execTime time.Time) (string, string) {
+	if cumQty < order.CumQty {
+		return AnomalyOutOfSequence, fmt.Sprintf("CumQty went backwards (%.8f < %.8f)", cumQty, order.CumQty)
+	}
+
+	if !order.LastExecTime.IsZero() && execTime.Before(order.LastExecTime) {
+		return AnomalyOutOfSequence, fmt.Sprintf("TransactTime %s is older than last report %s",
+			execTime.Format(time.RFC3339Nano), order.LastExecTime.Format(time.RFC3339Nano))
+	}
+
+	if !IsLegalTransition(current, ordStatus) {
+		return AnomalyIllegalTransition, fmt.Sprintf("OrdStatus %s cannot follow %s", ordStatus, current)
+	}
+
+	return "", ""
+}
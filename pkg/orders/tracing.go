@@ -0,0 +1,99 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"bcb-fix-microservice/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/* a resting order's lifecycle span is closed after this long so that open orders do not hold spans forever */
+const orderTraceTimeout = 5 * time.Minute
+
+var tracer = tracing.Tracer("orders")
+
+// orderTrace follows one order from NewOrderSingle to its terminal execution
+// report. ack covers the time until BCB's first execution report.
+type orderTrace struct {
+	lifecycle trace.Span
+	ack       trace.Span
+	timer     *time.Timer
+}
+
+func (client *OrdersClient) startOrderTraceLocked(ctx context.Context, order *OrderInfo) context.Context {
+	attrs := trace.WithAttributes(
+		tracing.AttrClOrdID.String(order.ClOrdID),
+		tracing.AttrSymbol.String(order.Symbol),
+		tracing.AttrSide.String(order.Side),
+	)
+
+	ctx, lifecycle := tracer.Start(ctx, "order.lifecycle", attrs)
+	_, ack := tracer.Start(ctx, "order.ack", attrs)
+
+	handle := order.Handle
+	client.traces[handle] = &orderTrace{
+		lifecycle: lifecycle,
+		ack:       ack,
+		timer: time.AfterFunc(orderTraceTimeout, func() {
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			client.endOrderTraceLocked(handle, nil, attribute.Bool("order.open", true))
+		}),
+	}
+	return ctx
+}
+
+func (client *OrdersClient) traceExecutionLocked(order *OrderInfo, execType, ordStatus, text string, lastQty, lastPx float64) {
+	orderTrace, exists := client.traces[order.Handle]
+	if !exists {
+		return
+	}
+
+	if orderTrace.ack != nil {
+		orderTrace.ack.SetAttributes(tracing.AttrExecType.String(execType), tracing.AttrStatus.String(ordStatus))
+		if execType == "8" {
+			orderTrace.ack.SetStatus(codes.Error, text)
+		}
+		orderTrace.ack.End()
+		orderTrace.ack = nil
+	}
+
+	if lastQty > 0 {
+		orderTrace.lifecycle.AddEvent("fill", trace.WithAttributes(
+			attribute.Float64("last_qty", lastQty),
+			attribute.Float64("last_px", lastPx),
+			attribute.Float64("cum_qty", order.CumQty),
+		))
+	}
+
+	if order.IsTerminal() {
+		var err error
+		if ordStatus == "8" {
+			err = fmt.Errorf("order rejected: %s", text)
+		}
+		client.endOrderTraceLocked(order.Handle, err,
+			tracing.AttrStatus.String(order.Status),
+			attribute.Float64("cum_qty", order.CumQty),
+			attribute.Float64("avg_px", order.AvgPx),
+		)
+	}
+}
+
+func (client *OrdersClient) endOrderTraceLocked(handle string, err error, attrs ...attribute.KeyValue) {
+	orderTrace, exists := client.traces[handle]
+	if !exists {
+		return
+	}
+	delete(client.traces, handle)
+
+	orderTrace.timer.Stop()
+	if orderTrace.ack != nil {
+		tracing.End(orderTrace.ack, err)
+	}
+	orderTrace.lifecycle.SetAttributes(attrs...)
+	tracing.End(orderTrace.lifecycle, err)
+}
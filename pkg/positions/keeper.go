@@ -0,0 +1,369 @@
+package positions
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"bcb-fix-microservice/pkg/marketdata"
+	"bcb-fix-microservice/pkg/orders"
+)
+
+type QuoteSource interface {
+	GetQuote(symbol string) (*marketdata.Quote, bool)
+	RetainQuotes(symbols []string)
+}
+
+// Balance is the net amount held in one currency. Value is the balance
+// expressed in the reporting currency, or nil if no conversion rate is known.
+type Balance struct {
+	Currency string   `json:"currency"`
+	Balance  float64  `json:"balance"`
+	Value    *float64 `json:"value,omitempty"`
+}
+
+// Position is the net position in the base currency of a symbol. Prices and
+// P&L are in the quote currency of the symbol; the *Reporting fields are the
+// same amounts converted to the reporting currency.
+type Position struct {
+	Symbol              string   `json:"symbol"`
+	BaseCurrency        string   `json:"base_currency"`
+	QuoteCurrency       string   `json:"quote_currency"`
+	NetQty              float64  `json:"net_qty"`
+	AvgCost             float64  `json:"avg_cost"`
+	MarkPrice           float64  `json:"mark_price,omitempty"`
+	BoughtQty           float64  `json:"bought_qty"`
+	SoldQty             float64  `json:"sold_qty"`
+	Commission          float64  `json:"commission"`
+	RealizedPnL         float64  `json:"realized_pnl"`
+	UnrealizedPnL       float64  `json:"unrealized_pnl"`
+	RealizedReporting   *float64 `json:"realized_pnl_reporting,omitempty"`
+	UnrealizedReporting *float64 `json:"unrealized_pnl_reporting,omitempty"`
+	CommissionReporting *float64 `json:"commission_reporting,omitempty"`
+	Executions          int      `json:"executions"`
+}
+
+type Snapshot struct {
+	ReportingCurrency string     `json:"reporting_currency"`
+	Balances          []Balance  `json:"balances"`
+	Positions         []Position `json:"positions"`
+	Unmarked          []string   `json:"unmarked,omitempty"`
+	AsOf              time.Time  `json:"as_of"`
+}
+
+type PnL struct {
+	ReportingCurrency string     `json:"reporting_currency"`
+	Realized          float64    `json:"realized"`
+	Unrealized        float64    `json:"unrealized"`
+	Commission        float64    `json:"commission"`
+	Net               float64    `json:"net"`
+	Unconverted       []string   `json:"unconverted,omitempty"`
+	Unmarked          []string   `json:"unmarked,omitempty"`
+	Positions         []Position `json:"positions"`
+	AsOf              time.Time  `json:"as_of"`
+}
+
+// Keeper derives balances, positions and P&L from the executions recorded by
+// the orders client. Positions are rebuilt from the execution history on each
+// call, so they always agree with /api/executions, including after restarts.
+// Commission is assumed to be charged in the quote currency of the symbol.
+//
+// Marks and conversion rates come from the quote cache only. The conversion
+// pairs are kept subscribed from construction on; position symbols are marked
+// when something else keeps them subscribed. Open positions without a fresh
+// quote are listed in Unmarked, their unrealized P&L left at zero.
+type Keeper struct {
+	orders            *orders.OrdersClient
+	quotes            QuoteSource
+	reportingCurrency string
+	pairs             map[string]bool
+}
+
+// NewKeeper subscribes to conversionPairs, the listed symbols such as
+// USDT-BRL that convert balances into the reporting currency.
+func NewKeeper(ordersClient *orders.OrdersClient, quotes QuoteSource, reportingCurrency string, conversionPairs []string) *Keeper {
+	keeper := &Keeper{
+		orders:            ordersClient,
+		quotes:            quotes,
+		reportingCurrency: strings.ToUpper(reportingCurrency),
+		pairs:             make(map[string]bool, len(conversionPairs)),
+	}
+
+	var symbols []string
+	for _, pair := range conversionPairs {
+		pair = strings.ToUpper(strings.TrimSpace(pair))
+		if pair != "" && !keeper.pairs[pair] {
+			keeper.pairs[pair] = true
+			symbols = append(symbols, pair)
+		}
+	}
+	if len(symbols) > 0 && quotes != nil {
+		quotes.RetainQuotes(symbols)
+	}
+
+	return keeper
+}
+
+func (keeper *Keeper) ReportingCurrency() string {
+	return keeper.reportingCurrency
+}
+
+// Positions returns balances and positions valued in currency, or in the
+// configured reporting currency if currency is empty. A non-empty clientID
+// restricts them to the orders of that API client.
+func (keeper *Keeper) Positions(currency, clientID string) *Snapshot {
+	currency = keeper.currency(currency)
+	positions, balances := keeper.aggregate(clientID)
+	rates := keeper.rates(positions, balances, currency)
+
+	snapshot := &Snapshot{ReportingCurrency: currency, AsOf: time.Now().UTC()}
+
+	for _, position := range positions {
+		if !rates.mark(position) {
+			snapshot.Unmarked = append(snapshot.Unmarked, position.Symbol)
+		}
+		snapshot.Positions = append(snapshot.Positions, *position)
+	}
+
+	for ccy, amount := range balances {
+		balance := Balance{Currency: ccy, Balance: amount}
+		if rate, ok := rates.convert(ccy, currency); ok {
+			value := amount * rate
+			balance.Value = &value
+		}
+		snapshot.Balances = append(snapshot.Balances, balance)
+	}
+
+	sort.Slice(snapshot.Balances, func(i, j int) bool { return snapshot.Balances[i].Currency < snapshot.Balances[j].Currency })
+	return snapshot
+}
+
+func (keeper *Keeper) PnL(currency, clientID string) *PnL {
+	currency = keeper.currency(currency)
+	positions, balances := keeper.aggregate(clientID)
+	rates := keeper.rates(positions, balances, currency)
+
+	pnl := &PnL{ReportingCurrency: currency, AsOf: time.Now().UTC()}
+
+	for _, position := range positions {
+		if !rates.mark(position) {
+			pnl.Unmarked = append(pnl.Unmarked, position.Symbol)
+		}
+
+		if rate, ok := rates.convert(position.QuoteCurrency, currency); ok {
+			realized := position.RealizedPnL * rate
+			unrealized := position.UnrealizedPnL * rate
+			commission := position.Commission * rate
+			position.RealizedReporting = &realized
+			position.UnrealizedReporting = &unrealized
+			position.CommissionReporting = &commission
+
+			pnl.Realized += realized
+			pnl.Unrealized += unrealized
+			pnl.Commission += commission
+		} else {
+			pnl.Unconverted = append(pnl.Unconverted, position.Symbol)
+		}
+
+		pnl.Positions = append(pnl.Positions, *position)
+	}
+
+	pnl.Net = pnl.Realized + pnl.Unrealized - pnl.Commission
+	return pnl
+}
+
+func (keeper *Keeper) currency(currency string) string {
+	if currency == "" {
+		return keeper.reportingCurrency
+	}
+	return strings.ToUpper(currency)
+}
+
+// aggregate replays all fills in execution time order using average cost.
+func (keeper *Keeper) aggregate(clientID string) ([]*Position, map[string]float64) {
+	var owned map[string]*orders.OrderInfo
+	if clientID != "" {
+		owned = keeper.orders.GetAllOrders()
+	}
+
+	var fills []*orders.ExecutionInfo
+	for handle, executions := range keeper.orders.GetAllExecutions() {
+		if owned != nil && (owned[handle] == nil || owned[handle].ClientID != clientID) {
+			continue
+		}
+		for _, execution := range executions {
+			if execution.ExecQty > 0 && execution.ExecPrice > 0 {
+				fills = append(fills, execution)
+			}
+		}
+	}
+
+	sort.Slice(fills, func(i, j int) bool {
+		if fills[i].ExecTime.Equal(fills[j].ExecTime) {
+			return fills[i].ExecID < fills[j].ExecID
+		}
+		return fills[i].ExecTime.Before(fills[j].ExecTime)
+	})
+
+	bySymbol := make(map[string]*Position)
+	balances := make(map[string]float64)
+
+	for _, fill := range fills {
+		position, exists := bySymbol[fill.Symbol]
+		if !exists {
+			base, quote := splitSymbol(fill.Symbol)
+			position = &Position{Symbol: fill.Symbol, BaseCurrency: base, QuoteCurrency: quote}
+			bySymbol[fill.Symbol] = position
+		}
+
+		direction := 1.0
+		if fill.Side == "1" {
+			position.BoughtQty += fill.ExecQty
+		} else {
+			direction = -1.0
+			position.SoldQty += fill.ExecQty
+		}
+
+		position.apply(direction*fill.ExecQty, fill.ExecPrice)
+		position.Commission += fill.Commission
+		position.Executions++
+
+		if position.BaseCurrency != "" {
+			balances[position.BaseCurrency] += direction * fill.ExecQty
+			balances[position.QuoteCurrency] -= direction*fill.ExecQty*fill.ExecPrice + fill.Commission
+		}
+	}
+
+	positions := make([]*Position, 0, len(bySymbol))
+	for _, position := range bySymbol {
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+
+	return positions, balances
+}
+
+func (position *Position) apply(qty, price float64) {
+	if position.NetQty == 0 || math.Signbit(position.NetQty) == math.Signbit(qty) {
+		total := math.Abs(position.NetQty) + math.Abs(qty)
+		position.AvgCost = (position.AvgCost*math.Abs(position.NetQty) + price*math.Abs(qty)) / total
+		position.NetQty += qty
+		return
+	}
+
+	closing := math.Min(math.Abs(qty), math.Abs(position.NetQty))
+	if position.NetQty > 0 {
+		position.RealizedPnL += closing * (price - position.AvgCost)
+	} else {
+		position.RealizedPnL += closing * (position.AvgCost - price)
+	}
+
+	position.NetQty += qty
+	switch {
+	case math.Abs(position.NetQty) < 1e-12:
+		position.NetQty = 0
+		position.AvgCost = 0
+	case math.Abs(qty) > closing:
+		/* position flipped: the remainder opens at this price */
+		position.AvgCost = price
+	}
+}
+
+func splitSymbol(symbol string) (string, string) {
+	parts := strings.SplitN(symbol, "-", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+type rateTable map[string]*marketdata.Quote
+
+// rates reads the cached quotes of every position symbol and of one pair per
+// currency converting it into the reporting currency. Nothing is subscribed
+// here, so a read never changes what the market data session streams.
+func (keeper *Keeper) rates(positions []*Position, balances map[string]float64, currency string) rateTable {
+	table := make(rateTable)
+	if keeper.quotes == nil {
+		return table
+	}
+
+	/* traded symbols are listed as well */
+	listed := make(map[string]bool, len(keeper.pairs)+len(positions))
+	for pair := range keeper.pairs {
+		listed[pair] = true
+	}
+	for _, position := range positions {
+		listed[position.Symbol] = true
+	}
+
+	symbols := make(map[string]bool)
+	for _, position := range positions {
+		symbols[position.Symbol] = true
+		if position.QuoteCurrency != "" && position.QuoteCurrency != currency {
+			symbols[keeper.pair(listed, position.QuoteCurrency, currency)] = true
+		}
+	}
+	for ccy := range balances {
+		if ccy != currency {
+			symbols[keeper.pair(listed, ccy, currency)] = true
+		}
+	}
+
+	for symbol := range symbols {
+		if quote, exists := keeper.quotes.GetQuote(symbol); exists {
+			table[symbol] = quote
+		}
+	}
+	return table
+}
+
+/* pair picks the listed direction between two currencies; unlisted ones fall back to whichever direction is cached */
+func (keeper *Keeper) pair(listed map[string]bool, from, to string) string {
+	forward := from + "-" + to
+	reverse := to + "-" + from
+
+	switch {
+	case listed[forward]:
+		return forward
+	case listed[reverse]:
+		return reverse
+	}
+	if _, exists := keeper.quotes.GetQuote(reverse); exists {
+		return reverse
+	}
+	return forward
+}
+
+func (table rateTable) mid(symbol string) (float64, bool) {
+	quote, exists := table[symbol]
+	if !exists || quote.Stale || quote.Bid <= 0 || quote.Ask <= 0 {
+		return 0, false
+	}
+	return (quote.Bid + quote.Ask) / 2, true
+}
+
+func (table rateTable) convert(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	if mid, ok := table.mid(from + "-" + to); ok {
+		return mid, true
+	}
+	if mid, ok := table.mid(to + "-" + from); ok {
+		return 1 / mid, true
+	}
+	return 0, false
+}
+
+/* mark reports false for an open position it could not mark; a flat one needs no mark */
+func (table rateTable) mark(position *Position) bool {
+	mid, ok := table.mid(position.Symbol)
+	if !ok {
+		return position.NetQty == 0
+	}
+	position.MarkPrice = mid
+	position.UnrealizedPnL = position.NetQty * (mid - position.AvgCost)
+	return true
+}
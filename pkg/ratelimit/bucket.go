@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a sustained rate in events per second and the burst allowed on
+// top of it.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// ParseLimit reads "rate/burst", e.g. "10/20". A bare rate uses the rate,
+// rounded up, as the burst.
+func ParseLimit(value string) (Limit, error) {
+	rateText, burstText, hasBurst := strings.Cut(strings.TrimSpace(value), "/")
+
+	rate, err := strconv.ParseFloat(rateText, 64)
+	if err != nil || rate <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate %q", rateText)
+	}
+
+	limit := Limit{Rate: rate, Burst: int(math.Ceil(rate))}
+	if hasBurst {
+		burst, err := strconv.Atoi(burstText)
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst %q", burstText)
+		}
+		limit.Burst = burst
+	}
+	return limit, nil
+}
+
+func (limit Limit) String() string {
+	return fmt.Sprintf("%g/%d", limit.Rate, limit.Burst)
+}
+
+type Bucket struct {
+	mu     sync.Mutex
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(limit Limit) *Bucket {
+	return &Bucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// Reserve takes a token if one is available within maxWait and returns how
+// long the caller must wait before using it. If not, nothing is taken and the
+// returned duration is the time until a token would be available.
+func (bucket *Bucket) Reserve(maxWait time.Duration) (time.Duration, bool) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	bucket.tokens = math.Min(float64(bucket.limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.limit.Rate)
+	bucket.last = now
+
+	/* tokens may go negative: each queued caller holds a slot in the future */
+	wait := time.Duration(0)
+	if bucket.tokens < 1 {
+		wait = time.Duration((1 - bucket.tokens) / bucket.limit.Rate * float64(time.Second))
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+
+	bucket.tokens--
+	return wait, true
+}
+
+func (bucket *Bucket) Allow() (time.Duration, bool) {
+	return bucket.Reserve(0)
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limiter keeps one bucket per key and class. Keys are API client IDs, so the
+// number of buckets is bounded by the configured clients.
+type Limiter struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	buckets map[string]*Bucket
+	stats   map[string]*ClassStats
+}
+
+type ClassStats struct {
+	Key      string `json:"key"`
+	Class    string `json:"class"`
+	Limit    string `json:"limit"`
+	Allowed  int64  `json:"allowed"`
+	Rejected int64  `json:"rejected"`
+}
+
+func NewLimiter(limits map[string]Limit) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		buckets: make(map[string]*Bucket),
+		stats:   make(map[string]*ClassStats),
+	}
+}
+
+// Allow reports whether key may make another request of class, and if not,
+// how long it should wait. Classes without a configured limit are unlimited.
+func (limiter *Limiter) Allow(key, class string) (time.Duration, bool) {
+	limit, limited := limiter.limits[class]
+	if !limited {
+		return 0, true
+	}
+
+	id := key + "|" + class
+
+	limiter.mu.Lock()
+	bucket, exists := limiter.buckets[id]
+	if !exists {
+		bucket = NewBucket(limit)
+		limiter.buckets[id] = bucket
+		limiter.stats[id] = &ClassStats{Key: key, Class: class, Limit: limit.String()}
+	}
+	stats := limiter.stats[id]
+	limiter.mu.Unlock()
+
+	retryAfter, ok := bucket.Allow()
+
+	limiter.mu.Lock()
+	if ok {
+		stats.Allowed++
+	} else {
+		stats.Rejected++
+	}
+	limiter.mu.Unlock()
+
+	return retryAfter, ok
+}
+
+func (limiter *Limiter) Limits() map[string]Limit {
+	return limiter.limits
+}
+
+func (limiter *Limiter) Stats() []ClassStats {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	stats := make([]ClassStats, 0, len(limiter.stats))
+	for _, s := range limiter.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Key == stats[j].Key {
+			return stats[i].Class < stats[j].Class
+		}
+		return stats[i].Key < stats[j].Key
+	})
+	return stats
+}
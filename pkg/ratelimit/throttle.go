@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var ErrThrottled = errors.New("outbound message rate exceeded")
+
+const (
+	ModeQueue  = "queue"
+	ModeReject = "reject"
+)
+
+type ThrottleConfig struct {
+	Limit Limit
+	/* queue waits up to MaxWait for a slot; reject fails as soon as the bucket is empty */
+	Mode    string
+	MaxWait time.Duration
+	/* cancels always queue, for up to UrgentMaxWait, so a kill switch is never dropped */
+	UrgentMaxWait time.Duration
+}
+
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		Limit:         Limit{Rate: 10, Burst: 20},
+		Mode:          ModeQueue,
+		MaxWait:       2 * time.Second,
+		UrgentMaxWait: 10 * time.Second,
+	}
+}
+
+// Throttle keeps outbound FIX application messages under the counterparty's
+// allowed message rate.
+type Throttle struct {
+	config ThrottleConfig
+	bucket *Bucket
+
+	sent     atomic.Int64
+	queued   atomic.Int64
+	rejected atomic.Int64
+	waiting  atomic.Int64
+}
+
+type ThrottleStats struct {
+	Limit    string `json:"limit"`
+	Mode     string `json:"mode"`
+	Sent     int64  `json:"sent"`
+	Queued   int64  `json:"queued"`
+	Rejected int64  `json:"rejected"`
+	Waiting  int64  `json:"waiting"`
+}
+
+func NewThrottle(config ThrottleConfig) *Throttle {
+	return &Throttle{config: config, bucket: NewBucket(config.Limit)}
+}
+
+// Wait blocks until the message may be sent, or returns ErrThrottled. It
+// returns how long the caller was held back.
+func (throttle *Throttle) Wait(urgent bool) (time.Duration, error) {
+	maxWait := time.Duration(0)
+	switch {
+	case urgent:
+		maxWait = throttle.config.UrgentMaxWait
+	case throttle.config.Mode == ModeQueue:
+		maxWait = throttle.config.MaxWait
+	}
+
+	wait, ok := throttle.bucket.Reserve(maxWait)
+	if !ok {
+		throttle.rejected.Add(1)
+		return 0, fmt.Errorf("%w: %s, retry in %s", ErrThrottled, throttle.config.Limit, wait.Round(time.Millisecond))
+	}
+
+	if wait > 0 {
+		throttle.queued.Add(1)
+		throttle.waiting.Add(1)
+		time.Sleep(wait)
+		throttle.waiting.Add(-1)
+	}
+
+	throttle.sent.Add(1)
+	return wait, nil
+}
+
+func (throttle *Throttle) Stats() ThrottleStats {
+	return ThrottleStats{
+		Limit:    throttle.config.Limit.String(),
+		Mode:     throttle.config.Mode,
+		Sent:     throttle.sent.Load(),
+		Queued:   throttle.queued.Load(),
+		Rejected: throttle.rejected.Load(),
+		Waiting:  throttle.waiting.Load(),
+	}
+}
@@ -0,0 +1,96 @@
+package replay
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+/* each testdata/<name>.log is replayed on its own and compared with testdata/<name>.golden.json */
+func TestGolden(t *testing.T) {
+	logs, err := filepath.Glob(filepath.Join("testdata", "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 {
+		t.Fatal("no fixtures in testdata")
+	}
+
+	for _, path := range logs {
+		name := strings.TrimSuffix(filepath.Base(path), ".log")
+
+		t.Run(name, func(t *testing.T) {
+			got := replayFiles(t, path)
+			golden := filepath.Join("testdata", name+".golden.json")
+
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("%s does not exist, run go test -update to create it", golden)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := Diff(want, got); diff != "" {
+				t.Errorf("state differs from %s, run go test -update if the change is intended\n%s", golden, diff)
+			}
+		})
+	}
+}
+
+func TestReplayIsDeterministic(t *testing.T) {
+	path := filepath.Join("testdata", "cancel_replace.log")
+
+	first := replayFiles(t, path)
+	second := replayFiles(t, path)
+	if diff := Diff(first, second); diff != "" {
+		t.Errorf("two replays of %s differ\n%s", path, diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if diff := Diff([]byte("a\nb\n"), []byte("a\nb\n")); diff != "" {
+		t.Errorf("Diff of equal dumps = %q, want empty", diff)
+	}
+
+	diff := Diff([]byte("a\nb\nc\n"), []byte("a\nx\nc\n"))
+	if want := "line 2:\n- b\n+ x\n"; diff != want {
+		t.Errorf("Diff = %q, want %q", diff, want)
+	}
+}
+
+func replayFiles(t *testing.T, paths ...string) []byte {
+	t.Helper()
+
+	records, err := ReadFiles(paths)
+	if err != nil {
+		t.Fatalf("ReadFiles: %v", err)
+	}
+
+	harness, err := New(Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer harness.Close()
+
+	harness.Run(records)
+
+	dump, err := harness.State().Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return dump
+}
@@ -0,0 +1,160 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bcb-fix-microservice/pkg/orders"
+)
+
+// Counts tallies the application messages replayed per MsgType. Skipped
+// counts the messages that could not be parsed or restored.
+type Counts struct {
+	Incoming map[string]int `json:"incoming"`
+	Outgoing map[string]int `json:"outgoing"`
+	Skipped  int            `json:"skipped"`
+}
+
+type QuoteState struct {
+	Symbol  string  `json:"symbol"`
+	Bid     float64 `json:"bid"`
+	Ask     float64 `json:"ask"`
+	Last    float64 `json:"last"`
+	Size    float64 `json:"size"`
+	Updates int     `json:"updates"`
+}
+
+// State is the outcome of a replay. Every timestamp is zeroed because the
+// clients stamp most of them with the wall clock, which would make two runs
+// of the same log differ.
+type State struct {
+	Messages   Counts                  `json:"messages"`
+	Orders     []*orders.OrderInfo     `json:"orders"`
+	Executions []*orders.ExecutionInfo `json:"executions"`
+	Unmatched  []orders.Anomaly        `json:"unmatched_anomalies"`
+	Quotes     []QuoteState            `json:"quotes"`
+}
+
+// State snapshots the clients in a stable order: orders by handle, their
+// executions in arrival order and quotes by symbol.
+func (h *Harness) State() *State {
+	state := &State{
+		Orders:     []*orders.OrderInfo{},
+		Executions: []*orders.ExecutionInfo{},
+		Unmatched:  []orders.Anomaly{},
+		Quotes:     []QuoteState{},
+	}
+
+	for _, order := range h.Orders.GetAllOrders() {
+		order.TransactTime = time.Time{}
+		order.LastExecTime = time.Time{}
+		for i := range order.History {
+			order.History[i].Time = time.Time{}
+		}
+		for i := range order.Anomalies {
+			order.Anomalies[i].Time = time.Time{}
+		}
+		if order.Pending != nil {
+			order.Pending.SentAt = time.Time{}
+		}
+		if order.CancelReject != nil {
+			order.CancelReject.Time = time.Time{}
+		}
+		state.Orders = append(state.Orders, order)
+	}
+	sort.Slice(state.Orders, func(i, j int) bool {
+		return state.Orders[i].Handle < state.Orders[j].Handle
+	})
+
+	executions := h.Orders.GetAllExecutions()
+	handles := make([]string, 0, len(executions))
+	for handle := range executions {
+		handles = append(handles, handle)
+	}
+	sort.Strings(handles)
+	for _, handle := range handles {
+		for _, execution := range executions[handle] {
+			copied := *execution
+			copied.ExecTime = time.Time{}
+			state.Executions = append(state.Executions, &copied)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state.Messages = Counts{Incoming: copyCounts(h.counts.Incoming), Outgoing: copyCounts(h.counts.Outgoing), Skipped: h.counts.Skipped}
+
+	for _, anomaly := range h.unmatched {
+		anomaly.Time = time.Time{}
+		state.Unmatched = append(state.Unmatched, anomaly)
+	}
+
+	for _, quote := range h.quotes {
+		state.Quotes = append(state.Quotes, *quote)
+	}
+	sort.Slice(state.Quotes, func(i, j int) bool {
+		return state.Quotes[i].Symbol < state.Quotes[j].Symbol
+	})
+
+	return state
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for msgType, n := range counts {
+		copied[msgType] = n
+	}
+	return copied
+}
+
+// Marshal renders the state as indented JSON, the format of golden files.
+func (s *State) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Diff compares two dumps line by line and describes where they differ, or
+// returns "" when they are identical. Dumps are indented JSON in a stable
+// order, so the first few differing lines are usually enough to spot the
+// regression.
+func Diff(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+
+	var b strings.Builder
+	shown := 0
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+
+		if shown == maxDiffLines {
+			b.WriteString("...\n")
+			break
+		}
+		fmt.Fprintf(&b, "line %d:\n- %s\n+ %s\n", i+1, w, g)
+		shown++
+	}
+	return b.String()
+}
+
+const maxDiffLines = 20
@@ -0,0 +1,252 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/marketdata"
+	"bcb-fix-microservice/pkg/metrics"
+	"bcb-fix-microservice/pkg/orders"
+)
+
+var logger = logging.Component("risk")
+
+const (
+	ReasonMaxOrderQty      = "MAX_ORDER_QTY"
+	ReasonMaxNotional      = "MAX_NOTIONAL"
+	ReasonMaxOpenOrders    = "MAX_OPEN_ORDERS"
+	ReasonMaxDailyNotional = "MAX_DAILY_NOTIONAL"
+	ReasonPriceCollar      = "PRICE_COLLAR"
+	ReasonNoReferencePrice = "NO_REFERENCE_PRICE"
+
+	referenceQuoteTimeout = 2 * time.Second
+)
+
+var ErrNoLimitsFile = errors.New("no risk limits file configured")
+
+// Rejection is returned by Check when an order breaches a limit.
+type Rejection struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%s: %s", r.Code, r.Message)
+}
+
+type QuoteSource interface {
+	ReferenceQuote(symbol string, timeout time.Duration) (*marketdata.Quote, bool)
+}
+
+type Snapshot struct {
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Config   Config    `json:"config"`
+}
+
+// Engine enforces pre-trade limits. Limits are read from a JSON file and can
+// be reloaded at runtime without a restart.
+type Engine struct {
+	path     string
+	quotes   QuoteSource
+	orders   *orders.OrdersClient
+	mu       sync.RWMutex
+	config   Config
+	loadedAt time.Time
+}
+
+// NewEngine fails if the limits file cannot be loaded. An empty path is the
+// explicit opt-out: the engine then enforces no limits.
+func NewEngine(path string, quotes QuoteSource, ordersClient *orders.OrdersClient) (*Engine, error) {
+	engine := &Engine{
+		path:   path,
+		quotes: quotes,
+		orders: ordersClient,
+	}
+
+	if path == "" {
+		logger.Warn("RiskLimitsDisabled", "pretrade_limits", "disabled")
+		return engine, nil
+	}
+
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+// Reload re-reads the limits file. On error the previous limits stay active.
+func (engine *Engine) Reload() error {
+	if engine.path == "" {
+		return ErrNoLimitsFile
+	}
+
+	config, err := LoadConfig(engine.path)
+	if err != nil {
+		return err
+	}
+
+	engine.mu.Lock()
+	engine.config = config
+	engine.loadedAt = time.Now().UTC()
+	engine.mu.Unlock()
+
+	logger.Info("RiskLimitsLoaded", "path", engine.path, "symbol_overrides", len(config.Symbols))
+	return nil
+}
+
+func (engine *Engine) Limits() Snapshot {
+	engine.mu.RLock()
+	defer engine.mu.RUnlock()
+
+	return Snapshot{Path: engine.path, LoadedAt: engine.loadedAt, Config: engine.config}
+}
+
+// Check implements orders.PreTradeCheck. For a replace only the fields that
+// the amendment changes are taken from order; symbol and side come from the
+// original.
+func (engine *Engine) Check(order *orders.OrderInfo, original *orders.OrderInfo) error {
+	err := engine.check(order, original)
+
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		metrics.Rejects.WithLabelValues("risk", rejection.Code).Inc()
+	}
+	return err
+}
+
+func (engine *Engine) check(order *orders.OrderInfo, original *orders.OrderInfo) error {
+	symbol, side := order.Symbol, order.Side
+	if original != nil {
+		symbol, side = original.Symbol, original.Side
+	}
+
+	engine.mu.RLock()
+	limits := engine.config.For(symbol)
+	engine.mu.RUnlock()
+
+	if limits.MaxOrderQty > 0 && order.OrderQty > limits.MaxOrderQty {
+		return &Rejection{Code: ReasonMaxOrderQty, Message: fmt.Sprintf("order quantity %.8f exceeds %.8f for %s", order.OrderQty, limits.MaxOrderQty, symbol)}
+	}
+
+	if original == nil && limits.MaxOpenOrders > 0 {
+		open := 0
+		for _, o := range engine.orders.OpenOrders() {
+			if strings.EqualFold(o.Symbol, symbol) {
+				open++
+			}
+		}
+		if open >= limits.MaxOpenOrders {
+			return &Rejection{Code: ReasonMaxOpenOrders, Message: fmt.Sprintf("%d open orders for %s (limit %d)", open, symbol, limits.MaxOpenOrders)}
+		}
+	}
+
+	if limits.MaxNotional == 0 && limits.MaxDailyNotional == 0 && limits.PriceCollarPct == 0 {
+		return nil
+	}
+
+	var quote *marketdata.Quote
+	if engine.quotes != nil {
+		quote, _ = engine.quotes.ReferenceQuote(symbol, referenceQuoteTimeout)
+	}
+
+	/* market orders have no price of their own; quoted (D) and limit orders do */
+	price := order.Price
+	if order.OrdType == "1" || price <= 0 {
+		price = marketPrice(quote, side)
+	}
+
+	needsPrice := limits.MaxNotional > 0 || limits.MaxDailyNotional > 0
+	if needsPrice && price <= 0 {
+		return &Rejection{Code: ReasonNoReferencePrice, Message: fmt.Sprintf("no usable quote to price %s order", symbol)}
+	}
+
+	notional := order.OrderQty * price
+	if limits.MaxNotional > 0 && notional > limits.MaxNotional {
+		return &Rejection{Code: ReasonMaxNotional, Message: fmt.Sprintf("order notional %.2f exceeds %.2f for %s", notional, limits.MaxNotional, symbol)}
+	}
+
+	if limits.MaxDailyNotional > 0 {
+		remaining := order.OrderQty
+		exclude := ""
+		if original != nil {
+			remaining = math.Max(order.OrderQty-original.CumQty, 0)
+			exclude = original.Handle
+		}
+
+		traded := engine.dailyNotional(symbol)
+		open := engine.openNotional(symbol, exclude, quote)
+		if traded+open+remaining*price > limits.MaxDailyNotional {
+			return &Rejection{Code: ReasonMaxDailyNotional, Message: fmt.Sprintf("traded %.2f today for %s with %.2f still open, order would add %.2f (limit %.2f)", traded, symbol, open, remaining*price, limits.MaxDailyNotional)}
+		}
+	}
+
+	if limits.PriceCollarPct > 0 && order.OrdType == "2" {
+		if quote == nil || quote.Stale || quote.Bid <= 0 || quote.Ask <= 0 {
+			return &Rejection{Code: ReasonNoReferencePrice, Message: fmt.Sprintf("no fresh two-sided quote for %s to apply price collar", symbol)}
+		}
+
+		mid := (quote.Bid + quote.Ask) / 2
+		deviation := math.Abs(order.Price-mid) / mid * 100
+		if deviation > limits.PriceCollarPct {
+			return &Rejection{Code: ReasonPriceCollar, Message: fmt.Sprintf("price %.8f is %.2f%% from mid %.8f for %s (collar %.2f%%)", order.Price, deviation, mid, symbol, limits.PriceCollarPct)}
+		}
+	}
+
+	return nil
+}
+
+// dailyNotional sums the notional traded on symbol since midnight UTC.
+func (engine *Engine) dailyNotional(symbol string) float64 {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	total := 0.0
+	for _, executions := range engine.orders.GetAllExecutions() {
+		for _, execution := range executions {
+			if execution.ExecQty <= 0 || !strings.EqualFold(execution.Symbol, symbol) {
+				continue
+			}
+			if execution.ExecTime.Before(midnight) {
+				continue
+			}
+			total += execution.ExecQty * execution.ExecPrice
+		}
+	}
+	return total
+}
+
+// openNotional sums the unfilled notional of the open orders on symbol, so
+// that orders resting at once cannot together exceed the daily limit. The
+// order being replaced is excluded; its new quantity is checked instead.
+func (engine *Engine) openNotional(symbol, exclude string, quote *marketdata.Quote) float64 {
+	total := 0.0
+	for _, order := range engine.orders.OpenOrders() {
+		if order.Handle == exclude || !strings.EqualFold(order.Symbol, symbol) {
+			continue
+		}
+		price := order.Price
+		if order.OrdType == "1" || price <= 0 {
+			price = marketPrice(quote, order.Side)
+		}
+		total += order.LeavesQty * price
+	}
+	return total
+}
+
+/* market orders are priced off the side of the book they would take */
+func marketPrice(quote *marketdata.Quote, side string) float64 {
+	if quote == nil || quote.Stale {
+		return 0
+	}
+	if side == "1" {
+		return quote.Ask
+	}
+	return quote.Bid
+}
@@ -0,0 +1,98 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Limits are expressed in the quote currency of the symbol. A zero value
+// disables the corresponding check.
+type Limits struct {
+	MaxOrderQty      float64 `json:"max_order_qty,omitempty"`
+	MaxNotional      float64 `json:"max_notional,omitempty"`
+	MaxOpenOrders    int     `json:"max_open_orders,omitempty"`
+	MaxDailyNotional float64 `json:"max_daily_notional,omitempty"`
+	PriceCollarPct   float64 `json:"price_collar_pct,omitempty"`
+}
+
+// Config holds the default limits and per-symbol overrides. Non-zero fields
+// of a symbol entry replace the corresponding default.
+type Config struct {
+	Default Limits            `json:"default"`
+	Symbols map[string]Limits `json:"symbols,omitempty"`
+}
+
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid risk limits in %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func (config Config) Validate() error {
+	if err := config.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for symbol, limits := range config.Symbols {
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("%s: %w", symbol, err)
+		}
+	}
+	return nil
+}
+
+func (config Config) For(symbol string) Limits {
+	limits := config.Default
+
+	override, exists := config.Symbols[symbol]
+	if !exists {
+		for key, value := range config.Symbols {
+			if strings.EqualFold(key, symbol) {
+				override, exists = value, true
+				break
+			}
+		}
+	}
+	if !exists {
+		return limits
+	}
+
+	if override.MaxOrderQty > 0 {
+		limits.MaxOrderQty = override.MaxOrderQty
+	}
+	if override.MaxNotional > 0 {
+		limits.MaxNotional = override.MaxNotional
+	}
+	if override.MaxOpenOrders > 0 {
+		limits.MaxOpenOrders = override.MaxOpenOrders
+	}
+	if override.MaxDailyNotional > 0 {
+		limits.MaxDailyNotional = override.MaxDailyNotional
+	}
+	if override.PriceCollarPct > 0 {
+		limits.PriceCollarPct = override.PriceCollarPct
+	}
+	return limits
+}
+
+func (limits Limits) validate() error {
+	if limits.MaxOrderQty < 0 || limits.MaxNotional < 0 || limits.MaxOpenOrders < 0 || limits.MaxDailyNotional < 0 || limits.PriceCollarPct < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
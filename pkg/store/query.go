@@ -0,0 +1,129 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+type ListOptions struct {
+	Symbol     string
+	Side       string
+	Status     string
+	From       time.Time
+	To         time.Time
+	Descending bool
+	Limit      int
+	Cursor     string
+	ClientID   string
+}
+
+type SortKey struct {
+	Time time.Time
+	ID   string
+}
+
+func (opts ListOptions) Match(symbol, side, status string, t time.Time) bool {
+	if opts.Symbol != "" && !strings.EqualFold(opts.Symbol, symbol) {
+		return false
+	}
+	if opts.Side != "" && opts.Side != side {
+		return false
+	}
+	if opts.Status != "" && !strings.EqualFold(opts.Status, status) {
+		return false
+	}
+	if !opts.From.IsZero() && t.Before(opts.From) {
+		return false
+	}
+	if !opts.To.IsZero() && !t.Before(opts.To) {
+		return false
+	}
+	return true
+}
+
+// MatchClient restricts results to records owned by opts.ClientID. An empty
+// ClientID leaves the results unrestricted.
+func (opts ListOptions) MatchClient(clientID string) bool {
+	return opts.ClientID == "" || opts.ClientID == clientID
+}
+
+// Paginate orders items by (time, id) so that pages stay stable while new
+// records are appended, and returns the cursor for the next page.
+func Paginate[T any](items []T, keyOf func(T) SortKey, opts ListOptions) ([]T, string, error) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if opts.Descending {
+			return keyOf(items[j]).before(keyOf(items[i]))
+		}
+		return keyOf(items[i]).before(keyOf(items[j]))
+	})
+
+	start := 0
+	if opts.Cursor != "" {
+		after, err := DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		start = sort.Search(len(items), func(i int) bool {
+			if opts.Descending {
+				return keyOf(items[i]).before(after)
+			}
+			return after.before(keyOf(items[i]))
+		})
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	end := start + limit
+	if end >= len(items) {
+		return items[start:], "", nil
+	}
+
+	page := items[start:end]
+	return page, EncodeCursor(keyOf(page[len(page)-1])), nil
+}
+
+func (k SortKey) before(other SortKey) bool {
+	if !k.Time.Equal(other.Time) {
+		return k.Time.Before(other.Time)
+	}
+	return k.ID < other.ID
+}
+
+func EncodeCursor(key SortKey) string {
+	raw := fmt.Sprintf("%s|%s", key.Time.UTC().Format(time.RFC3339Nano), key.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (SortKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return SortKey{}, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return SortKey{}, fmt.Errorf("invalid cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return SortKey{}, fmt.Errorf("invalid cursor")
+	}
+
+	return SortKey{Time: t, ID: parts[1]}, nil
+}
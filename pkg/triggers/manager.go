@@ -0,0 +1,412 @@
+package triggers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/marketdata"
+	"bcb-fix-microservice/pkg/orders"
+	"bcb-fix-microservice/pkg/store"
+)
+
+var logger = logging.Component("triggers")
+
+const (
+	TypeStopLoss     = "stop_loss"
+	TypeTakeProfit   = "take_profit"
+	TypeTrailingStop = "trailing_stop"
+
+	StatusWaiting   = "waiting"
+	StatusTriggered = "triggered"
+	StatusSubmitted = "submitted"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+
+	triggersBucket = "trigger_orders"
+
+	/* how often moved trailing-stop watermarks are written, at most */
+	watermarkFlushInterval = time.Second
+)
+
+var (
+	ErrTriggerNotFound   = errors.New("trigger order not found")
+	ErrTriggerNotWaiting = errors.New("trigger order is no longer waiting")
+)
+
+// Trigger is an order held locally until the market reaches its trigger
+// price. When it fires, a NewOrderSingle is sent with ClOrdID equal to ID, so
+// the resulting order can be looked up under the same identifier.
+type Trigger struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	OrderQty       float64   `json:"order_qty"`
+	OrdType        string    `json:"ord_type"`
+	Price          float64   `json:"price,omitempty"`
+	TimeInForce    string    `json:"time_in_force"`
+	TriggerPrice   float64   `json:"trigger_price"`
+	TrailAmount    float64   `json:"trail_amount,omitempty"`
+	TrailPercent   float64   `json:"trail_percent,omitempty"`
+	WaterMark      float64   `json:"water_mark,omitempty"`
+	LastPrice      float64   `json:"last_price,omitempty"`
+	Status         string    `json:"status"`
+	TriggeredPrice float64   `json:"triggered_price,omitempty"`
+	TriggeredAt    time.Time `json:"triggered_at,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	IdempotencyKey string    `json:"idempotency_key,omitempty"`
+	ClientID       string    `json:"client_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type QuoteFeed interface {
+	AddQuoteListener(listener marketdata.QuoteListener)
+	RetainQuotes(symbols []string)
+	ReleaseQuotes(symbols []string)
+}
+
+// Manager holds stop-loss, take-profit and trailing-stop orders and fires
+// them from market data quote updates. Status changes are written as they
+// happen; trailing-stop watermarks, which move with every favourable quote,
+// are marked dirty and written in batches off the FIX goroutine.
+type Manager struct {
+	store    *store.Store
+	orders   *orders.OrdersClient
+	quotes   QuoteFeed
+	mu       sync.RWMutex
+	triggers map[string]*Trigger
+	dirty    map[string]bool
+
+	/* orders writes so that a batch copied before a status change never lands after it; taken after mu */
+	persistMu sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func NewManager(st *store.Store, ordersClient *orders.OrdersClient, quotes QuoteFeed) *Manager {
+	manager := &Manager{
+		store:    st,
+		orders:   ordersClient,
+		quotes:   quotes,
+		triggers: make(map[string]*Trigger),
+		dirty:    make(map[string]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	loaded, err := store.LoadAll[Trigger](st, triggersBucket)
+	if err != nil {
+		logger.Error("TriggersStoreLoad", logging.Err(err))
+	}
+	for _, trigger := range loaded {
+		/* a trigger that fired but was not confirmed as sent must not be resent blindly */
+		if trigger.Status == StatusTriggered {
+			trigger.Status = StatusFailed
+			trigger.Error = "service restarted before the order was confirmed as sent"
+			manager.save(trigger)
+		}
+		manager.triggers[trigger.ID] = trigger
+	}
+
+	quotes.AddQuoteListener(manager.onQuote)
+	return manager
+}
+
+// Start subscribes to market data for every waiting trigger. It must be called
+// once the market data session is up.
+func (manager *Manager) Start() {
+	manager.mu.RLock()
+	var symbols []string
+	for _, trigger := range manager.triggers {
+		if trigger.Status == StatusWaiting {
+			symbols = append(symbols, trigger.Symbol)
+		}
+	}
+	manager.mu.RUnlock()
+
+	manager.quotes.RetainQuotes(symbols)
+	go manager.flushLoop()
+	logger.Info("TriggersStarted", "waiting", len(symbols))
+}
+
+// Stop writes the pending watermarks and stops the background writer.
+func (manager *Manager) Stop() {
+	close(manager.stop)
+	<-manager.done
+}
+
+func (manager *Manager) flushLoop() {
+	defer close(manager.done)
+
+	ticker := time.NewTicker(watermarkFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			manager.flush()
+		case <-manager.stop:
+			manager.flush()
+			return
+		}
+	}
+}
+
+func (manager *Manager) flush() {
+	manager.mu.Lock()
+	if len(manager.dirty) == 0 {
+		manager.mu.Unlock()
+		return
+	}
+
+	manager.persistMu.Lock()
+	defer manager.persistMu.Unlock()
+
+	values := make(map[string]interface{}, len(manager.dirty))
+	for id := range manager.dirty {
+		copied := *manager.triggers[id]
+		values[id] = &copied
+	}
+	manager.dirty = make(map[string]bool)
+	manager.mu.Unlock()
+
+	if err := manager.store.PutAll(triggersBucket, values); err != nil {
+		logger.Error("TriggerPersist", "triggers", len(values), logging.Err(err))
+	}
+}
+
+func Validate(trigger *Trigger) error {
+	switch trigger.Type {
+	case TypeStopLoss, TypeTakeProfit:
+		if trigger.TriggerPrice <= 0 {
+			return fmt.Errorf("trigger_price is required for %s orders", trigger.Type)
+		}
+	case TypeTrailingStop:
+		if (trigger.TrailAmount <= 0) == (trigger.TrailPercent <= 0) {
+			return fmt.Errorf("exactly one of trail_amount or trail_percent is required for trailing_stop orders")
+		}
+		if trigger.TrailPercent >= 100 {
+			return fmt.Errorf("trail_percent must be below 100")
+		}
+	default:
+		return fmt.Errorf("trigger_type must be '%s', '%s' or '%s'", TypeStopLoss, TypeTakeProfit, TypeTrailingStop)
+	}
+
+	if trigger.OrdType != "1" && trigger.OrdType != "2" {
+		return fmt.Errorf("triggered orders must be '1' (Market) or '2' (Limit)")
+	}
+	return nil
+}
+
+func (manager *Manager) Create(trigger *Trigger) error {
+	if err := Validate(trigger); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	trigger.Status = StatusWaiting
+	trigger.CreatedAt = now
+	trigger.UpdatedAt = now
+
+	manager.mu.Lock()
+	if _, exists := manager.triggers[trigger.ID]; exists {
+		manager.mu.Unlock()
+		return fmt.Errorf("%w: %s", orders.ErrDuplicateClOrdID, trigger.ID)
+	}
+	manager.triggers[trigger.ID] = trigger
+	manager.save(trigger)
+	manager.mu.Unlock()
+
+	manager.quotes.RetainQuotes([]string{trigger.Symbol})
+
+	logger.Info("TriggerCreated", "trigger_id", trigger.ID, "type", trigger.Type, logging.KeyClientID, trigger.ClientID, logging.KeySymbol, trigger.Symbol,
+		"side", trigger.Side, "qty", trigger.OrderQty, "trigger_price", trigger.TriggerPrice)
+	return nil
+}
+
+func (manager *Manager) Cancel(id string) (*Trigger, error) {
+	manager.mu.Lock()
+	trigger, exists := manager.triggers[id]
+	if !exists {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrTriggerNotFound, id)
+	}
+	if trigger.Status != StatusWaiting {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s is %s", ErrTriggerNotWaiting, id, trigger.Status)
+	}
+
+	trigger.Status = StatusCancelled
+	trigger.UpdatedAt = time.Now().UTC()
+	manager.save(trigger)
+	cancelled := *trigger
+	manager.mu.Unlock()
+
+	manager.quotes.ReleaseQuotes([]string{trigger.Symbol})
+
+	logger.Info("TriggerCancelled", "trigger_id", id)
+	return &cancelled, nil
+}
+
+func (manager *Manager) Get(id string) (*Trigger, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	trigger, exists := manager.triggers[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *trigger
+	return &copied, true
+}
+
+func (manager *Manager) List(opts store.ListOptions) ([]*Trigger, string, error) {
+	manager.mu.RLock()
+	var matched []*Trigger
+	for _, trigger := range manager.triggers {
+		if opts.MatchClient(trigger.ClientID) && opts.Match(trigger.Symbol, trigger.Side, trigger.Status, trigger.CreatedAt) {
+			copied := *trigger
+			matched = append(matched, &copied)
+		}
+	}
+	manager.mu.RUnlock()
+
+	return store.Paginate(matched, func(trigger *Trigger) store.SortKey {
+		return store.SortKey{Time: trigger.CreatedAt, ID: trigger.ID}
+	}, opts)
+}
+
+func (manager *Manager) onQuote(quote marketdata.Quote) {
+	var fired []*Trigger
+
+	manager.mu.Lock()
+	for _, trigger := range manager.triggers {
+		if trigger.Status != StatusWaiting || trigger.Symbol != quote.Symbol {
+			continue
+		}
+
+		moved, fire := trigger.evaluate(quote)
+		if fire {
+			trigger.Status = StatusTriggered
+			trigger.TriggeredPrice = trigger.LastPrice
+			trigger.TriggeredAt = time.Now().UTC()
+			fired = append(fired, trigger)
+		}
+		if moved || fire {
+			trigger.UpdatedAt = time.Now().UTC()
+		}
+		if fire {
+			manager.save(trigger)
+		} else if moved {
+			manager.dirty[trigger.ID] = true
+		}
+	}
+	manager.mu.Unlock()
+
+	/* sent off the FIX goroutine: pre-trade checks may wait for quotes */
+	for _, trigger := range fired {
+		logger.Info("TriggerFired", "trigger_id", trigger.ID, "type", trigger.Type, logging.KeySymbol, trigger.Symbol, "price", trigger.TriggeredPrice, "trigger_price", trigger.TriggerPrice)
+		go manager.submit(trigger.ID)
+	}
+}
+
+// evaluate updates the trigger with the latest observed price and reports
+// whether its stored state moved and whether it should fire. Sells watch the
+// bid and buys watch the ask, the side of the book the order would trade on.
+func (trigger *Trigger) evaluate(quote marketdata.Quote) (bool, bool) {
+	price := quote.Ask
+	if trigger.Side == "2" {
+		price = quote.Bid
+	}
+	if price <= 0 {
+		price = quote.Last
+	}
+	if price <= 0 {
+		return false, false
+	}
+	trigger.LastPrice = price
+
+	sell := trigger.Side == "2"
+
+	switch trigger.Type {
+	case TypeStopLoss:
+		if sell {
+			return false, price <= trigger.TriggerPrice
+		}
+		return false, price >= trigger.TriggerPrice
+	case TypeTakeProfit:
+		if sell {
+			return false, price >= trigger.TriggerPrice
+		}
+		return false, price <= trigger.TriggerPrice
+	case TypeTrailingStop:
+		moved := false
+		if trigger.WaterMark == 0 || (sell && price > trigger.WaterMark) || (!sell && price < trigger.WaterMark) {
+			trigger.WaterMark = price
+			trail := trigger.TrailAmount
+			if trail <= 0 {
+				trail = price * trigger.TrailPercent / 100
+			}
+			if sell {
+				trigger.TriggerPrice = price - trail
+			} else {
+				trigger.TriggerPrice = price + trail
+			}
+			moved = true
+		}
+		if sell {
+			return moved, price <= trigger.TriggerPrice
+		}
+		return moved, price >= trigger.TriggerPrice
+	}
+	return false, false
+}
+
+func (manager *Manager) submit(id string) {
+	manager.mu.RLock()
+	trigger := manager.triggers[id]
+	order := &orders.OrderInfo{
+		ClOrdID:        trigger.ID,
+		Symbol:         trigger.Symbol,
+		Side:           trigger.Side,
+		OrderQty:       trigger.OrderQty,
+		Price:          trigger.Price,
+		OrdType:        trigger.OrdType,
+		TimeInForce:    trigger.TimeInForce,
+		IdempotencyKey: trigger.IdempotencyKey,
+		ClientID:       trigger.ClientID,
+	}
+	symbol := trigger.Symbol
+	manager.mu.RUnlock()
+
+	err := manager.orders.NewOrderSingle(order)
+
+	manager.mu.Lock()
+	if err != nil {
+		trigger.Status = StatusFailed
+		trigger.Error = err.Error()
+		logger.Error("TriggerSubmit", "trigger_id", id, logging.Err(err))
+	} else {
+		trigger.Status = StatusSubmitted
+	}
+	trigger.UpdatedAt = time.Now().UTC()
+	manager.save(trigger)
+	manager.mu.Unlock()
+
+	manager.quotes.ReleaseQuotes([]string{symbol})
+}
+
+/* save writes trigger now; callers hold mu */
+func (manager *Manager) save(trigger *Trigger) {
+	manager.persistMu.Lock()
+	defer manager.persistMu.Unlock()
+
+	delete(manager.dirty, trigger.ID)
+	if err := manager.store.Put(triggersBucket, trigger.ID, trigger); err != nil {
+		logger.Error("TriggerPersist", "trigger_id", trigger.ID, logging.Err(err))
+	}
+}
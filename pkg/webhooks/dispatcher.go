@@ -0,0 +1,365 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"bcb-fix-microservice/pkg/logging"
+	"bcb-fix-microservice/pkg/store"
+)
+
+var logger = logging.Component("webhooks")
+
+const (
+	webhooksBucket    = "webhooks"
+	deadLettersBucket = "webhook_dead_letters"
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type Config struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	/* events waiting per webhook; once full, new events go straight to the dead letters */
+	QueueSize int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        10 * time.Second,
+		QueueSize:      1000,
+	}
+}
+
+type Webhook struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	ExchangeID string    `json:"exchange_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	ExchangeID string      `json:"exchange_id,omitempty"`
+	ClOrdID    string      `json:"cl_ord_id,omitempty"`
+	Data       interface{} `json:"data"`
+	Timestamp  time.Time   `json:"timestamp"`
+}
+
+type DeadLetter struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	URL       string          `json:"url"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+// Dispatcher delivers events through one worker per webhook, so a webhook
+// receives events in the order they were published and a slow or failing
+// endpoint only holds up its own queue.
+type Dispatcher struct {
+	config   Config
+	store    *store.Store
+	client   *http.Client
+	mu       sync.RWMutex
+	webhooks map[string]*Webhook
+	workers  map[string]*worker
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+type delivery struct {
+	event   Event
+	payload []byte
+}
+
+type worker struct {
+	webhook Webhook
+	queue   chan delivery
+	stop    chan struct{}
+}
+
+func NewDispatcher(st *store.Store, config Config) *Dispatcher {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultConfig().QueueSize
+	}
+
+	dispatcher := &Dispatcher{
+		config:   config,
+		store:    st,
+		client:   &http.Client{Timeout: config.Timeout},
+		webhooks: make(map[string]*Webhook),
+		workers:  make(map[string]*worker),
+	}
+
+	webhooks, err := store.LoadAll[Webhook](st, webhooksBucket)
+	if err != nil {
+		logger.Error("WebhooksStoreLoad", logging.Err(err))
+	}
+	for _, webhook := range webhooks {
+		dispatcher.webhooks[webhook.ID] = webhook
+		dispatcher.startWorkerLocked(webhook)
+	}
+
+	return dispatcher
+}
+
+// Close stops the workers. Events still queued are not delivered.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	for id, w := range d.workers {
+		close(w.stop)
+		delete(d.workers, id)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) startWorkerLocked(webhook *Webhook) {
+	w := &worker{
+		webhook: *webhook,
+		queue:   make(chan delivery, d.config.QueueSize),
+		stop:    make(chan struct{}),
+	}
+	d.workers[webhook.ID] = w
+
+	d.wg.Add(1)
+	go d.run(w)
+}
+
+func (d *Dispatcher) run(w *worker) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case next := <-w.queue:
+			d.deliver(w, next.event, next.payload)
+		}
+	}
+}
+
+func (d *Dispatcher) Register(rawURL, secret, exchangeID string) (*Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http(s) URL")
+	}
+
+	if secret == "" {
+		secret = randomHex(32)
+	}
+
+	webhook := &Webhook{
+		ID:         "wh-" + randomHex(8),
+		URL:        rawURL,
+		Secret:     secret,
+		ExchangeID: exchangeID,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	if err := d.store.Put(webhooksBucket, webhook.ID, webhook); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.webhooks[webhook.ID] = webhook
+	if !d.closed {
+		d.startWorkerLocked(webhook)
+	}
+	d.mu.Unlock()
+
+	logger.Info("WebhookRegistered", "webhook_id", webhook.ID, "url", webhook.URL, "exchange_id", exchangeID)
+	return webhook, nil
+}
+
+func (d *Dispatcher) Unregister(id string) bool {
+	d.mu.Lock()
+	_, exists := d.webhooks[id]
+	delete(d.webhooks, id)
+	if w, running := d.workers[id]; running {
+		close(w.stop)
+		delete(d.workers, id)
+	}
+	d.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+
+	if err := d.store.Delete(webhooksBucket, id); err != nil {
+		logger.Error("WebhookDelete", "webhook_id", id, logging.Err(err))
+	}
+	return true
+}
+
+func (d *Dispatcher) List() []Webhook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	result := make([]Webhook, 0, len(d.webhooks))
+	for _, webhook := range d.webhooks {
+		redacted := *webhook
+		redacted.Secret = ""
+		result = append(result, redacted)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+func (d *Dispatcher) DeadLetters() ([]*DeadLetter, error) {
+	letters, err := store.LoadAll[DeadLetter](d.store, deadLettersBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(letters, func(i, j int) bool { return letters[i].FailedAt.Before(letters[j].FailedAt) })
+	return letters, nil
+}
+
+// Publish queues the event for every global webhook and for webhooks scoped
+// to the event's exchange. It never blocks: when a webhook's queue is full
+// the event is dead-lettered for that webhook instead.
+func (d *Dispatcher) Publish(eventType, exchangeID, clOrdID string, data interface{}) {
+	event := Event{
+		ID:         "evt-" + randomHex(8),
+		Type:       eventType,
+		ExchangeID: exchangeID,
+		ClOrdID:    clOrdID,
+		Data:       data,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("WebhookEncode", "event_type", event.Type, logging.Err(err))
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, w := range d.workers {
+		if w.webhook.ExchangeID != "" && w.webhook.ExchangeID != exchangeID {
+			continue
+		}
+
+		select {
+		case w.queue <- delivery{event: event, payload: payload}:
+		default:
+			logger.Error("WebhookQueueFull", "webhook_id", w.webhook.ID, "event_id", event.ID, "event_type", event.Type, "queue_size", d.config.QueueSize)
+			d.deadLetter(w.webhook, event, payload, 0, fmt.Errorf("delivery queue full"))
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(w *worker, event Event, payload []byte) {
+	webhook := w.webhook
+	backoff := d.config.InitialBackoff
+	var lastErr error
+
+	for attempt := 1; attempt <= d.config.MaxAttempts; attempt++ {
+		if lastErr = d.send(webhook, event, payload); lastErr == nil {
+			logger.Debug("Webhook", logging.KeyDirection, logging.DirOut, "event_id", event.ID, "event_type", event.Type, "url", webhook.URL, "attempt", attempt)
+			return
+		}
+
+		logger.Error("WebhookDelivery", "event_id", event.ID, "event_type", event.Type, "url", webhook.URL,
+			"attempt", attempt, "max_attempts", d.config.MaxAttempts, logging.Err(lastErr))
+
+		if attempt < d.config.MaxAttempts {
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > d.config.MaxBackoff {
+				backoff = d.config.MaxBackoff
+			}
+		}
+	}
+
+	d.deadLetter(webhook, event, payload, d.config.MaxAttempts, lastErr)
+}
+
+func (d *Dispatcher) deadLetter(webhook Webhook, event Event, payload []byte, attempts int, lastErr error) {
+	letter := &DeadLetter{
+		ID:        fmt.Sprintf("%s-%s", event.ID, webhook.ID),
+		WebhookID: webhook.ID,
+		URL:       webhook.URL,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   payload,
+		Attempts:  attempts,
+		LastError: lastErr.Error(),
+		FailedAt:  time.Now().UTC(),
+	}
+
+	if err := d.store.Put(deadLettersBucket, letter.ID, letter); err != nil {
+		logger.Error("WebhookDeadLetter", "dead_letter_id", letter.ID, logging.Err(err))
+	}
+}
+
+func (d *Dispatcher) send(webhook Webhook, event Event, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func Sign(secret string, payload []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,254 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"bcb-fix-microservice/pkg/store"
+)
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	t.Helper()
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatalf("store.Open: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.MaxAttempts = 3
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 5 * time.Millisecond
+	config.Timeout = time.Second
+
+	dispatcher := NewDispatcher(st, config)
+	t.Cleanup(func() {
+		dispatcher.Close()
+		st.Close()
+	})
+	return dispatcher
+}
+
+/* receiver records every request and answers with the status statusFor picks for the attempt */
+type receiver struct {
+	mu        sync.Mutex
+	requests  []receivedRequest
+	statusFor func(attempt int) int
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rv.mu.Lock()
+	rv.requests = append(rv.requests, receivedRequest{header: r.Header.Clone(), body: body})
+	attempt := len(rv.requests)
+	rv.mu.Unlock()
+
+	status := http.StatusOK
+	if rv.statusFor != nil {
+		status = rv.statusFor(attempt)
+	}
+	w.WriteHeader(status)
+}
+
+func (rv *receiver) received() []receivedRequest {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return append([]receivedRequest(nil), rv.requests...)
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverySignsPayload(t *testing.T) {
+	rv := &receiver{}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	if _, err := dispatcher.Register(server.URL, "s3cret", ""); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	dispatcher.Publish("order.filled", "EX1", "ORD-1", map[string]string{"status": "2"})
+	waitFor(t, "delivery", func() bool { return len(rv.received()) == 1 })
+
+	request := rv.received()[0]
+	if got, want := request.header.Get(SignatureHeader), "sha256="+Sign("s3cret", request.body); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+	if got := request.header.Get(EventHeader); got != "order.filled" {
+		t.Errorf("%s = %q, want order.filled", EventHeader, got)
+	}
+
+	var event Event
+	if err := json.Unmarshal(request.body, &event); err != nil {
+		t.Fatalf("payload is not an event: %v", err)
+	}
+	if event.ClOrdID != "ORD-1" || event.ExchangeID != "EX1" || request.header.Get(DeliveryHeader) != event.ID {
+		t.Errorf("unexpected event %+v with delivery %q", event, request.header.Get(DeliveryHeader))
+	}
+}
+
+func TestDeliveryRetriesServerErrors(t *testing.T) {
+	rv := &receiver{statusFor: func(attempt int) int {
+		if attempt < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	if _, err := dispatcher.Register(server.URL, "s3cret", ""); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	dispatcher.Publish("order.new", "", "ORD-1", nil)
+	waitFor(t, "third attempt", func() bool { return len(rv.received()) == 3 })
+
+	/* give a fourth attempt the chance to show up */
+	time.Sleep(50 * time.Millisecond)
+	requests := rv.received()
+	if len(requests) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(requests))
+	}
+	for i, request := range requests[1:] {
+		if string(request.body) != string(requests[0].body) {
+			t.Errorf("attempt %d sent a different payload", i+2)
+		}
+	}
+
+	letters, err := dispatcher.DeadLetters()
+	if err != nil {
+		t.Fatalf("DeadLetters: %v", err)
+	}
+	if len(letters) != 0 {
+		t.Errorf("got %d dead letters after a successful retry, want 0", len(letters))
+	}
+}
+
+func TestDeliveryDeadLettersAfterMaxAttempts(t *testing.T) {
+	rv := &receiver{statusFor: func(int) int { return http.StatusInternalServerError }}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	webhook, err := dispatcher.Register(server.URL, "s3cret", "")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	dispatcher.Publish("order.rejected", "", "ORD-1", nil)
+
+	var letters []*DeadLetter
+	waitFor(t, "dead letter", func() bool {
+		letters, err = dispatcher.DeadLetters()
+		return err == nil && len(letters) == 1
+	})
+
+	letter := letters[0]
+	if letter.WebhookID != webhook.ID || letter.EventType != "order.rejected" {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+	if letter.Attempts != dispatcher.config.MaxAttempts {
+		t.Errorf("Attempts = %d, want %d", letter.Attempts, dispatcher.config.MaxAttempts)
+	}
+	if letter.LastError != "unexpected status 500" {
+		t.Errorf("LastError = %q", letter.LastError)
+	}
+	if got := len(rv.received()); got != dispatcher.config.MaxAttempts {
+		t.Errorf("got %d attempts, want %d", got, dispatcher.config.MaxAttempts)
+	}
+}
+
+func TestDeliveryKeepsOrderPerWebhook(t *testing.T) {
+	/* every other request fails once so that retries would reorder unsynchronised deliveries */
+	rv := &receiver{statusFor: func(attempt int) int {
+		if attempt%2 == 1 {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	}}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	if _, err := dispatcher.Register(server.URL, "", ""); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	const events = 20
+	for i := 0; i < events; i++ {
+		dispatcher.Publish("order.status_changed", "", string(rune('a'+i)), nil)
+	}
+	waitFor(t, "all deliveries", func() bool { return len(rv.received()) == 2*events })
+
+	var delivered []string
+	for i, request := range rv.received() {
+		if i%2 == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(request.body, &event); err != nil {
+			t.Fatalf("payload is not an event: %v", err)
+		}
+		delivered = append(delivered, event.ClOrdID)
+	}
+
+	for i, clOrdID := range delivered {
+		if want := string(rune('a' + i)); clOrdID != want {
+			t.Fatalf("delivery %d is %q, want %q: %v", i, clOrdID, want, delivered)
+		}
+	}
+}
+
+func TestPublishSkipsOtherExchanges(t *testing.T) {
+	rv := &receiver{}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	if _, err := dispatcher.Register(server.URL, "", "EX1"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	dispatcher.Publish("order.new", "EX2", "ORD-1", nil)
+	dispatcher.Publish("order.new", "EX1", "ORD-2", nil)
+	waitFor(t, "delivery", func() bool { return len(rv.received()) >= 1 })
+
+	time.Sleep(50 * time.Millisecond)
+	requests := rv.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(requests))
+	}
+
+	var event Event
+	if err := json.Unmarshal(requests[0].body, &event); err != nil {
+		t.Fatalf("payload is not an event: %v", err)
+	}
+	if event.ClOrdID != "ORD-2" {
+		t.Errorf("delivered %q, want ORD-2", event.ClOrdID)
+	}
+}